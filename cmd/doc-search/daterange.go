@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/daterange"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// lastRunFile records when a download or export last succeeded, for -range since-last-run.
+const lastRunFile = "last-run.json"
+
+// rangeFilters returns the filters for a -range value, with days in loc. since-last-run reads the time of the
+// last run recorded in dir; when none is recorded it matches every date.
+func rangeFilters(spec, dir string, loc *time.Location) ([]scraper.FilterFunc, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	lastRun, err := daterange.LoadLastRun(filepath.Join(dir, lastRunFile))
+	if err != nil {
+		return nil, err
+	}
+	r, err := daterange.Parse(spec, daterange.Options{Location: loc, LastRun: lastRun})
+	if errors.Is(err, daterange.ErrNoLastRun) {
+		log.Printf("range: no previous run recorded in %s; matching every date", dir)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("range: meetings from %s", r)
+	return r.Filters(), nil
+}
+
+// recordRun saves start as the time of the last run in dir, when dir exists. Callers record only runs that
+// downloaded everything they matched.
+func recordRun(dir string, start time.Time) {
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	if err := daterange.SaveLastRun(filepath.Join(dir, lastRunFile), start); err != nil {
+		log.Printf("range: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/digest"
+	"github.com/dntiontk/civic-code/pkg/feed"
+)
+
+// digestState records, in the download directory, when the last digest was sent.
+type digestState struct {
+	LastSent time.Time `json:"lastSent"`
+}
+
+const digestStateFile = "digest-state.json"
+
+// runDigest emails a digest of the documents first seen since the last digest.
+func runDigest(args []string) {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	dir := fs.String("downloadDir", "./downloads", "directory holding metadata.json, first-seen.json and digest state")
+	since := fs.Duration("since", 0, "include documents first seen within this duration instead of since the last digest")
+	from := fs.String("from", "", "sender address")
+	var to stringsFlag
+	fs.Var(&to, "to", "recipient address (repeatable)")
+	smtpAddr := fs.String("smtp", "localhost:587", "SMTP server host:port")
+	smtpUser := fs.String("smtpUser", "", "SMTP username")
+	smtpPassword := fs.String("smtpPassword", os.Getenv("CIVIC_SMTP_PASSWORD"), "SMTP password (default $CIVIC_SMTP_PASSWORD)")
+	startTLS := fs.String("starttls", string(digest.StartTLSRequired), "STARTTLS mode: required, opportunistic or disabled")
+	dryRun := fs.String("dryRun", "", "write the digest as an .eml file to this directory instead of sending it")
+	sendEmpty := fs.Bool("sendEmpty", false, "send a digest even when there are no new documents")
+	timeout := fs.Duration("timeout", 2*time.Minute, "timeout for scraping the listing and sending")
+	crawl := addCrawlFlags(fs)
+	_ = fs.Parse(args)
+
+	if *dryRun == "" && (*from == "" || len(to) == 0) {
+		log.Fatal("digest: -from and -to are required unless -dryRun is set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	docs, err := crawl.documents(ctx, crawl.client(nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if meta, err := loadMetadata(*dir); err == nil {
+		mergeKnown(docs, meta.Items)
+	}
+
+	now := time.Now()
+	seenPath := filepath.Join(*dir, firstSeenFile)
+	seen, err := feed.LoadFirstSeen(seenPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	seen.Observe(docs, now)
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	if err := seen.Save(seenPath); err != nil {
+		log.Fatal(err)
+	}
+
+	statePath := filepath.Join(*dir, digestStateFile)
+	state, err := loadDigestState(statePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cutoff := state.LastSent
+	if *since > 0 {
+		cutoff = now.Add(-*since)
+	} else if cutoff.IsZero() {
+		cutoff = now.AddDate(0, 0, -7)
+	}
+
+	fresh := digest.NewSince(docs, seen, cutoff)
+	if len(fresh) == 0 && !*sendEmpty {
+		log.Printf("digest: no new documents since %s", cutoff.Format(time.RFC3339))
+		return
+	}
+	msg, err := digest.New(fresh, cutoff).Message(*from, to, now)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *dryRun != "" {
+		path, err := digest.WriteEML(*dryRun, msg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("digest: wrote %d documents to %s", len(fresh), path)
+		return
+	}
+
+	cfg := digest.SMTPConfig{
+		Addr:     *smtpAddr,
+		Username: *smtpUser,
+		Password: *smtpPassword,
+		TLS:      digest.TLSMode(*startTLS),
+	}
+	if err := digest.Send(ctx, cfg, msg); err != nil {
+		log.Fatal(err)
+	}
+	if err := saveDigestState(statePath, digestState{LastSent: now}); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("digest: sent %d documents to %d recipients", len(fresh), len(to))
+}
+
+func loadDigestState(path string) (digestState, error) {
+	var state digestState
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	return state, json.Unmarshal(data, &state)
+}
+
+func saveDigestState(path string, state digestState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// duplicatesReport is the JSON printed by the duplicates command.
+type duplicatesReport struct {
+	Len   int                    `json:"len"`
+	Items []scraper.DuplicateSet `json:"items"`
+}
+
+// runDuplicates reports downloaded documents with identical content at different links.
+func runDuplicates(args []string) {
+	fs := flag.NewFlagSet("duplicates", flag.ExitOnError)
+	dir := fs.String("downloadDir", "./downloads", "directory holding metadata.json")
+	crossMeeting := fs.Bool("crossMeeting", false, "only report documents duplicated across different meetings")
+	_ = fs.Parse(args)
+
+	meta, err := loadMetadata(*dir)
+	if err != nil {
+		log.Fatalf("duplicates: %v (run doc-search -download first)", err)
+	}
+
+	sets := scraper.Duplicates(meta.Items)
+	if *crossMeeting {
+		filtered := make([]scraper.DuplicateSet, 0)
+		for _, set := range sets {
+			if set.Meetings > 1 {
+				filtered = append(filtered, set)
+			}
+		}
+		sets = filtered
+	}
+	if err := writeJSON(os.Stdout, duplicatesReport{Len: len(sets), Items: sets}); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/archive"
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/dntiontk/civic-code/pkg/storage"
+)
+
+var exportIndex = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Council documents</title></head>
+<body>
+<h1>Council documents</h1>
+<p>{{len .}} documents. Metadata for each is in metadata.json.</p>
+<table>
+<thead><tr><th>Date</th><th>Meeting</th><th>Document</th><th>Source</th></tr></thead>
+<tbody>
+{{- range .}}
+<tr><td>{{.Date.Format "2006-01-02"}}</td><td>{{.Meeting.Name}}</td><td><a href="pdfs/{{.FileName}}">{{.Name}}</a></td><td><a href="{{.Link}}">link</a></td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// runExport bundles the PDFs matching the search flags, their metadata and an index into one archive.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	year := fs.Int("year", -1, "filter documents by year")
+	before := fs.String("before", "", "filter documents on or before date")
+	after := fs.String("after", "", "filter documents on or after date")
+	dateRange := fs.String("range", "", "filter documents by a date range: last-30d, this-year, 2024-Q2, 2023-09..2024-03, since-last-run, ...")
+	meetingType := fs.String("meetingType", "", "filter documents by meeting type")
+	docName := fs.String("docName", "", "filter documents with string in name")
+	format := fs.String("format", "zip", "archive format: zip or tar.gz")
+	out := fs.String("out", "", `archive to write, or "-" for stdout (default export.<format>)`)
+	dir := fs.String("downloadDir", "./downloads", "directory holding downloaded PDFs and metadata.json")
+	workers := fs.Int("concurrency", 4, "number of concurrent downloads")
+	timeout := fs.Duration("timeout", 10*time.Minute, "timeout for scraping and downloading")
+	crawl := addCrawlFlags(fs)
+	naming := addNameTemplateFlag(fs)
+	progressMode := fs.String("progress", "auto", "download progress: bar, json, log or none (auto picks bar on a terminal, json otherwise)")
+	_ = fs.Parse(args)
+
+	f, err := archive.ParseFormat(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *out == "" {
+		*out = "export." + f.Ext()
+	}
+	start := time.Now()
+	filters, err := buildFilters(*year, *before, *after, *meetingType, *docName, crawl.location())
+	if err != nil {
+		log.Fatal(err)
+	}
+	ranged, err := rangeFilters(*dateRange, *dir, crawl.location())
+	if err != nil {
+		log.Fatal(err)
+	}
+	filters = append(filters, ranged...)
+	progress, finishProgress, err := newProgress(*progressMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	client := crawl.client(nil)
+	docs, err := crawl.documents(ctx, client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	naming.nameDocuments(docs)
+	for _, filter := range filters {
+		docs = filter(docs)
+	}
+	if meta, err := loadMetadata(*dir); err == nil {
+		mergeKnown(docs, meta.Items)
+	}
+	log.Printf("export: %d documents match the provided filters", len(docs))
+
+	// Download whatever isn't mirrored yet; files with a known checksum are skipped.
+	if len(docs) > 0 {
+		if err := os.MkdirAll(*dir, 0o755); err != nil {
+			log.Fatal(err)
+		}
+		d, err := downloader.New(downloader.Options{
+			Storage:     storage.NewLocal(*dir),
+			Client:      client,
+			Progress:    progress,
+			FileName:    naming.fileName(),
+			Concurrency: *workers,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		downloaded, err := d.Download(ctx, docs)
+		finishProgress()
+		if downloaded != nil {
+			docs = downloaded
+		}
+		if metaErr := updateMetadata(*dir, docs); metaErr != nil {
+			log.Printf("export: %v", metaErr)
+		}
+		if err != nil {
+			log.Fatalf("export: %v", err)
+		}
+	}
+
+	if err := writeExport(*out, f, *dir, docs); err != nil {
+		log.Fatal(err)
+	}
+	if *out != "-" {
+		log.Printf("export: wrote %d documents to %s", len(docs), *out)
+	}
+	recordRun(*dir, start)
+}
+
+// writeExport writes the archive. Its timestamps are the latest meeting date, so the same documents always
+// produce the same bytes.
+func writeExport(out string, format archive.Format, dir string, docs []scraper.Document) error {
+	docs = slices.Clone(docs)
+	slices.SortStableFunc(docs, func(a, b scraper.Document) int {
+		if c := a.Date.Compare(b.Date); c != 0 {
+			return c
+		}
+		return strings.Compare(a.FileName, b.FileName)
+	})
+
+	var modTime time.Time
+	entries := make([]archive.Entry, 0, len(docs)+2)
+	for _, doc := range docs {
+		if doc.Date.After(modTime) {
+			modTime = doc.Date
+		}
+		path := filepath.Join(dir, doc.FileName)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, archive.Entry{
+			Name: "pdfs/" + doc.FileName,
+			Size: info.Size(),
+			Open: func() (io.ReadCloser, error) { return os.Open(path) },
+		})
+	}
+
+	var meta, index bytes.Buffer
+	if err := writeJSON(&meta, &Result{Len: len(docs), Items: docs}); err != nil {
+		return err
+	}
+	if err := exportIndex.Execute(&index, docs); err != nil {
+		return err
+	}
+	entries = append(entries, archive.Bytes("metadata.json", meta.Bytes()), archive.Bytes("index.html", index.Bytes()))
+
+	if out == "-" {
+		return archive.Write(os.Stdout, format, entries, modTime)
+	}
+	tmp := out + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := archive.Write(file, format, entries, modTime); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, out)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/feed"
+)
+
+// firstSeenFile records, in the download directory, when each document was first observed.
+const firstSeenFile = "first-seen.json"
+
+// runFeed writes Atom and RSS feeds of all documents and of each meeting type.
+func runFeed(args []string) {
+	fs := flag.NewFlagSet("feed", flag.ExitOnError)
+	out := fs.String("out", "./feeds", "directory to write the feeds to")
+	baseURL := fs.String("baseURL", "", "absolute URL the feeds directory is published under, used for self links")
+	dir := fs.String("downloadDir", "./downloads", "directory holding metadata.json and first-seen.json")
+	limit := fs.Int("limit", feed.DefaultLimit, "maximum number of entries per feed")
+	timeout := fs.Duration("timeout", 2*time.Minute, "timeout for scraping the listing")
+	crawl := addCrawlFlags(fs)
+	_ = fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	docs, err := crawl.documents(ctx, crawl.client(nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if meta, err := loadMetadata(*dir); err == nil {
+		mergeKnown(docs, meta.Items)
+	}
+
+	statePath := filepath.Join(*dir, firstSeenFile)
+	seen, err := feed.LoadFirstSeen(statePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	seen.Observe(docs, time.Now())
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	if err := seen.Save(statePath); err != nil {
+		log.Fatal(err)
+	}
+
+	opts := feed.Options{BaseURL: *baseURL, FirstSeen: seen, Limit: *limit}
+	if err := feed.WriteFiles(*out, docs, opts); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("feed: wrote feeds for %d documents to %s", len(docs), *out)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/ical"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// runICal writes an iCalendar file with one event per meeting.
+func runICal(args []string) {
+	fs := flag.NewFlagSet("ical", flag.ExitOnError)
+	out := fs.String("out", "meetings.ics", "file to write the calendar to")
+	meetingType := fs.String("meetingType", "", "only include meetings of this type")
+	year := fs.Int("year", -1, "only include meetings in this year")
+	timeout := fs.Duration("timeout", 2*time.Minute, "timeout for scraping the listing")
+	crawl := addCrawlFlags(fs)
+	_ = fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	docs, err := crawl.documents(ctx, crawl.client(nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *meetingType != "" {
+		docs = scraper.ByMeetingType(scraper.GetMeetingType(*meetingType))(docs)
+	}
+	if *year != -1 {
+		docs = scraper.ByYear(*year)(docs)
+	}
+
+	meetings := scraper.GroupMeetings(docs)
+	data, err := ical.Calendar(meetings, ical.Options{Location: crawl.location()})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("ical: wrote %d meetings to %s", len(meetings), *out)
+}
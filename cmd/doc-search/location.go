@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/dntiontk/civic-code/pkg/location"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// loadAddressPoints reads the optional address-point CSV used for geocoding.
+func loadAddressPoints(path string) (location.AddressPoints, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return location.LoadAddressPoints(f)
+}
+
+// tagLocations records the addresses and wards mentioned by each Document that has been downloaded to dir.
+func tagLocations(docs []scraper.Document, dir string, points location.AddressPoints) {
+	tagged := 0
+	for i := range docs {
+		pages, err := documentPages(dir, docs[i])
+		if err != nil {
+			continue
+		}
+		location.Tag(&docs[i], pages, points)
+		tagged++
+	}
+	if tagged < len(docs) {
+		log.Printf("location: %d of %d documents are not downloaded to %s and were not tagged", len(docs)-tagged, len(docs), dir)
+	}
+}
+
+// writeGeoJSON writes the geocoded addresses mentioned by docs to path.
+func writeGeoJSON(path string, docs []scraper.Document, points location.AddressPoints) error {
+	if points == nil {
+		log.Printf("location: no -addressPoints given; the GeoJSON export will be empty")
+	}
+	fc, missing := location.GeoJSON(docs, points)
+	if len(missing) > 0 {
+		log.Printf("location: %d addresses could not be geocoded", len(missing))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(f, fc); err != nil {
+		f.Close()
+		return err
+	}
+	log.Printf("location: wrote %d features to %s", len(fc.Features), path)
+	return f.Close()
+}
@@ -2,15 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"log"
+	"net/http"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/location"
 	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/dntiontk/civic-code/pkg/storage"
 	"github.com/itlightning/dateparse"
 )
 
@@ -18,24 +19,73 @@ var (
 	yearFlag        int
 	beforeFlag      string
 	afterFlag       string
+	rangeFlag       string
 	meetingTypeFlag string
 	docNameFlag     string
 	downloadDirFlag string
 	downloadWorkers int
 	downloadFlag    bool
 	timeoutFlag     time.Duration
+	wardFlag        int
+	addressFlag     string
+	addrPointsFlag  string
+	geojsonFlag     string
+	storageFlag     string
+	layoutFlag      string
+	warcFlag        string
+	progressFlag    string
+	maxSizeFlag     int64
+	quarantineFlag  string
 )
 
+// commands maps subcommand names to their entry points. Without a subcommand, doc-search searches the
+// listing and prints (or downloads) the matching documents.
+var commands = map[string]func(args []string){
+	"digest":       runDigest,
+	"duplicates":   runDuplicates,
+	"export":       runExport,
+	"feed":         runFeed,
+	"ical":         runICal,
+	"prune":        runPrune,
+	"refs":         runRefs,
+	"rename":       runRename,
+	"retry-failed": runRetryFailed,
+	"serve":        runServe,
+	"site":         runSite,
+	"verify-warc":  runVerifyWARC,
+	"watch":        runWatch,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	flag.IntVar(&yearFlag, "year", -1, "filter documents by year")
-	flag.StringVar(&beforeFlag, "before", "", "filter documents before date")
-	flag.StringVar(&afterFlag, "after", "", "filter documents after date")
+	flag.StringVar(&beforeFlag, "before", "", "filter documents on or before date")
+	flag.StringVar(&afterFlag, "after", "", "filter documents on or after date")
+	flag.StringVar(&rangeFlag, "range", "", "filter documents by a date range: last-30d, this-year, 2024-Q2, 2023-09..2024-03, since-last-run, ...")
 	flag.StringVar(&meetingTypeFlag, "meetingType", "", "filter documents by meeting type")
 	flag.StringVar(&docNameFlag, "docName", "", "filter documents with string in name")
 	flag.StringVar(&downloadDirFlag, "downloadDir", "./downloads", "directory to store downloaded PDFs")
 	flag.IntVar(&downloadWorkers, "concurrency", 4, "number of concurrent downloads")
 	flag.BoolVar(&downloadFlag, "download", false, "download matching PDFs to disk")
 	flag.DurationVar(&timeoutFlag, "timeout", 10*time.Minute, "overall timeout for scraping and downloading (e.g. 1m, 30s); zero disables the timeout")
+	flag.IntVar(&wardFlag, "ward", 0, "filter downloaded documents that mention a ward")
+	flag.StringVar(&addressFlag, "address", "", "filter downloaded documents that mention an address or street")
+	flag.StringVar(&addrPointsFlag, "addressPoints", "", "address-point CSV used to geocode addresses and infer wards")
+	flag.StringVar(&geojsonFlag, "geojson", "", "write a GeoJSON file of the addresses mentioned by matching documents")
+	flag.StringVar(&storageFlag, "storage", "", "where to store downloaded PDFs: a directory or s3://bucket/prefix?endpoint=URL (default downloadDir)")
+	flag.StringVar(&layoutFlag, "layout", "", "store each distinct PDF once and name it by hardlink, symlink or manifest")
+	flag.StringVar(&warcFlag, "warc", "", "record the listing and PDF responses to this WARC file (.warc or .warc.gz)")
+	flag.StringVar(&progressFlag, "progress", "auto", "download progress: bar, json, log or none (auto picks bar on a terminal, json otherwise)")
+	flag.Int64Var(&maxSizeFlag, "maxSize", 0, "fail documents larger than this many bytes; zero disables the limit")
+	flag.StringVar(&quarantineFlag, "quarantine", "quarantine/", "keep responses that are not the expected kind of file under this prefix of the storage; empty discards them")
+	crawl := addCrawlFlags(flag.CommandLine)
+	naming := addNameTemplateFlag(flag.CommandLine)
 	flag.Parse()
 
 	var (
@@ -49,58 +99,85 @@ func main() {
 	}
 	defer cancel()
 
-	filters := make([]scraper.FilterFunc, 0)
-	if yearFlag != -1 {
-		filters = append(filters, scraper.ByYear(yearFlag))
+	start := time.Now()
+	filters, err := buildFilters(yearFlag, beforeFlag, afterFlag, meetingTypeFlag, docNameFlag, crawl.location())
+	if err != nil {
+		log.Fatal(err)
 	}
-	if beforeFlag != "" {
-		before, err := dateparse.ParseAny(beforeFlag)
-		if err != nil {
-			log.Fatal(err)
-		}
-		filters = append(filters, scraper.Before(before))
+	ranged, err := rangeFilters(rangeFlag, downloadDirFlag, crawl.location())
+	if err != nil {
+		log.Fatal(err)
 	}
+	filters = append(filters, ranged...)
 
-	if afterFlag != "" {
-		after, err := dateparse.ParseAny(afterFlag)
+	// One client paces the listing and the downloads together; with -warc it records both.
+	var transport http.RoundTripper
+	if warcFlag != "" {
+		recorder, closeWARC, err := openWARC(warcFlag)
 		if err != nil {
 			log.Fatal(err)
 		}
-		filters = append(filters, scraper.After(after))
-	}
-
-	if meetingTypeFlag != "" {
-		meetingType := scraper.GetMeetingType(meetingTypeFlag)
-		filters = append(filters, scraper.ByMeetingType(meetingType))
+		defer closeWARC()
+		transport = recorder
 	}
+	client := crawl.client(transport)
 
-	if docNameFlag != "" {
-		filters = append(filters, scraper.ByStringInName(docNameFlag))
-	}
-
-	docs, err := scraper.GetDocuments(ctx)
+	docs, err := crawl.documents(ctx, client)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Printf("scraper: fetched %d documents before filtering", len(docs))
+	collisions := naming.nameDocuments(docs)
 	for _, filter := range filters {
 		docs = filter(docs)
 	}
 	log.Printf("scraper: %d documents match the provided filters", len(docs))
 
-	var downloadErrors []string
+	var (
+		downloadErrors   []string
+		downloadFailures []failure
+	)
 	if downloadFlag && len(docs) > 0 {
-		log.Printf("downloader: starting download of %d documents to %s with concurrency=%d", len(docs), downloadDirFlag, downloadWorkers)
 		if downloadWorkers < 1 {
 			downloadWorkers = 1
 		}
-		downloaded, err := downloader.DownloadDocuments(ctx, docs, downloadDirFlag, downloadWorkers)
+		location := downloadDirFlag
+		if storageFlag != "" {
+			location = storageFlag
+		}
+		store, err := openStorage(ctx, location, layoutFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		progress, finishProgress, err := newProgress(progressFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("downloader: starting download of %d documents to %s with concurrency=%d", len(docs), location, downloadWorkers)
+		d, err := downloader.New(downloader.Options{
+			Storage:     store,
+			Client:      client,
+			Progress:    progress,
+			FileName:    naming.fileName(),
+			Concurrency: downloadWorkers,
+			MaxSize:     maxSizeFlag,
+			Quarantine:  quarantineFlag,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		downloaded, err := d.Download(ctx, docs)
+		finishProgress()
 		if downloaded != nil {
 			docs = downloaded
 		}
+		if ferr := recordFailures(downloadDirFlag, docs, err); ferr != nil {
+			log.Printf("downloader: %v", ferr)
+		}
 		if err != nil {
 			log.Printf("download errors: %v", err)
 			downloadErrors = append(downloadErrors, err.Error())
+			downloadFailures = failures(err)
 		} else {
 			log.Printf("downloader: completed download of %d documents", len(docs))
 		}
@@ -108,49 +185,87 @@ func main() {
 		log.Printf("downloader: skipping download (pass -download to enable)")
 	}
 
-	type Result struct {
-		Len    int                `json:"len"`
-		Items  []scraper.Document `json:"items"`
-		Errors []string           `json:"errors,omitempty"`
+	if wardFlag != 0 || addressFlag != "" || geojsonFlag != "" {
+		points, err := loadAddressPoints(addrPointsFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tagLocations(docs, downloadDirFlag, points)
+
+		if wardFlag != 0 {
+			docs = location.ByWard(wardFlag)(docs)
+		}
+		if addressFlag != "" {
+			docs = location.ByAddress(addressFlag)(docs)
+		}
+		log.Printf("location: %d documents match the location filters", len(docs))
+
+		if geojsonFlag != "" {
+			if err := writeGeoJSON(geojsonFlag, docs, points); err != nil {
+				log.Fatal(err)
+			}
+		}
 	}
 
 	res := &Result{
-		Len:    len(docs),
-		Items:  docs,
-		Errors: downloadErrors,
+		Len:        len(docs),
+		Items:      docs,
+		Errors:     downloadErrors,
+		Failures:   downloadFailures,
+		Collisions: collisions,
 	}
 
-	var (
-		output       = os.Stdout
-		metadataFile *os.File
-	)
-	if downloadFlag {
-		if err := os.MkdirAll(downloadDirFlag, 0o755); err != nil {
+	if !downloadFlag {
+		if err := writeJSON(os.Stdout, res); err != nil {
 			log.Fatal(err)
 		}
-		metadataPath := filepath.Join(downloadDirFlag, "metadata.json")
-		f, err := os.Create(metadataPath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		metadataFile = f
-		output = f
-		log.Printf("metadata: writing results to %s", metadataPath)
+		return
 	}
-
-	enc := json.NewEncoder(output)
-	enc.SetEscapeHTML(false)
-	enc.SetIndent("", "  ")
-
-	if err := enc.Encode(res); err != nil {
+	if err := saveMetadata(downloadDirFlag, res); err != nil {
 		log.Fatal(err)
 	}
+	// A search that only prints, or a download with failures, must not move since-last-run past documents
+	// that were never downloaded.
+	if len(downloadErrors) == 0 {
+		recordRun(downloadDirFlag, start)
+	}
+}
 
-	if metadataFile != nil {
-		if err := metadataFile.Close(); err != nil {
-			log.Printf("metadata: failed to close metadata.json: %v", err)
-		} else {
-			log.Printf("metadata: wrote results to %s", metadataFile.Name())
+// openStorage returns the store at location, wrapped in a content-addressed layout when layout is set.
+func openStorage(ctx context.Context, location, layout string) (storage.Storage, error) {
+	base, err := storage.Open(location)
+	if err != nil || layout == "" {
+		return base, err
+	}
+	return storage.NewCAS(ctx, base, storage.LinkMode(layout))
+}
+
+// buildFilters returns the listing filters for the search flags shared by several commands, reading dates in loc.
+// A year of -1 and empty strings disable the corresponding filter.
+func buildFilters(year int, before, after, meetingType, docName string, loc *time.Location) ([]scraper.FilterFunc, error) {
+	filters := make([]scraper.FilterFunc, 0)
+	if year != -1 {
+		filters = append(filters, scraper.ByYear(year))
+	}
+	if before != "" {
+		t, err := dateparse.ParseIn(before, loc)
+		if err != nil {
+			return nil, err
 		}
+		filters = append(filters, scraper.OnOrBefore(t))
+	}
+	if after != "" {
+		t, err := dateparse.ParseIn(after, loc)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, scraper.OnOrAfter(t))
+	}
+	if meetingType != "" {
+		filters = append(filters, scraper.ByMeetingType(scraper.GetMeetingType(meetingType)))
+	}
+	if docName != "" {
+		filters = append(filters, scraper.ByStringInName(docName))
 	}
+	return filters, nil
 }
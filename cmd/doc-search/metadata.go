@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// Result is the JSON document printed to stdout or written to metadata.json.
+type Result struct {
+	Len    int                `json:"len"`
+	Items  []scraper.Document `json:"items"`
+	Errors []string           `json:"errors,omitempty"`
+	// Failures repeats Errors with machine-readable codes.
+	Failures []failure `json:"failures,omitempty"`
+	// Collisions lists the file names in the listing that documents at different links would have shared.
+	Collisions []downloader.Collision `json:"collisions,omitempty"`
+}
+
+// failure is a download error in Result. Code is one of the downloader.Code constants.
+type failure struct {
+	ID     string `json:"id,omitempty"`
+	Link   string `json:"link,omitempty"`
+	Code   string `json:"code"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error"`
+}
+
+// failures returns an entry for each failed document in err, an error returned by a download.
+func failures(err error) []failure {
+	if err == nil {
+		return nil
+	}
+	out := make([]failure, 0)
+	for _, derr := range downloader.Failures(err) {
+		out = append(out, failure{
+			ID:     derr.Document.ID,
+			Link:   derr.Document.Link,
+			Code:   derr.Code(),
+			Status: derr.Status,
+			Error:  derr.Err.Error(),
+		})
+	}
+	if len(out) == 0 {
+		out = append(out, failure{Code: downloader.Code(err), Error: err.Error()})
+	}
+	return out
+}
+
+// loadMetadata reads the metadata.json written by a previous -download run.
+func loadMetadata(dir string) (*Result, error) {
+	path := filepath.Join(dir, "metadata.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{}
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, fmt.Errorf("metadata: decode %s: %w", path, err)
+	}
+	return res, nil
+}
+
+// saveMetadata writes res to metadata.json in dir.
+func saveMetadata(dir string, res *Result) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "metadata.json")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	log.Printf("metadata: writing results to %s", path)
+	if err := writeJSON(f, res); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("metadata: close %s: %w", path, err)
+	}
+	log.Printf("metadata: wrote results to %s", path)
+	return nil
+}
+
+// updateMetadata adds docs to metadata.json in dir, replacing entries with the same link.
+func updateMetadata(dir string, docs []scraper.Document) error {
+	res, err := loadMetadata(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		res = &Result{}
+	} else if err != nil {
+		return err
+	}
+	index := make(map[string]int, len(res.Items))
+	for i, doc := range res.Items {
+		index[doc.Link] = i
+	}
+	for _, doc := range docs {
+		if doc.Link == "" {
+			continue
+		}
+		if i, ok := index[doc.Link]; ok {
+			res.Items[i] = doc
+			continue
+		}
+		index[doc.Link] = len(res.Items)
+		res.Items = append(res.Items, doc)
+	}
+	res.Len = len(res.Items)
+	return saveMetadata(dir, res)
+}
+
+// mergeKnown copies checksums and location tags recorded for the same link in a previous run onto docs, so
+// unchanged files are not downloaded again.
+func mergeKnown(docs []scraper.Document, previous []scraper.Document) {
+	known := make(map[string]scraper.Document, len(previous))
+	for _, doc := range previous {
+		known[doc.Link] = doc
+	}
+	for i := range docs {
+		prev, ok := known[docs[i].Link]
+		if !ok {
+			continue
+		}
+		if docs[i].Checksum == "" {
+			docs[i].Checksum = prev.Checksum
+		}
+		if docs[i].Wards == nil {
+			docs[i].Wards = prev.Wards
+		}
+		if docs[i].Addresses == nil {
+			docs[i].Addresses = prev.Addresses
+		}
+	}
+}
+
+// writeJSON encodes v as indented JSON without HTML escaping.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
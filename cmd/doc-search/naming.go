@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// templateFlag is a flag.Value holding a file name template.
+type templateFlag struct {
+	t *scraper.FileNameTemplate
+}
+
+// addNameTemplateFlag defines -nameTemplate on fs, defaulting to the default schema.
+func addNameTemplateFlag(fs *flag.FlagSet) *templateFlag {
+	f := &templateFlag{t: scraper.MustParseFileNameTemplate(scraper.DefaultFileNameTemplate)}
+	fs.Var(f, "nameTemplate", "file name template for downloaded documents, e.g. {year}/{meeting.code}/{date}-{role}-{name}{ext}")
+	return f
+}
+
+func (f *templateFlag) String() string {
+	if f == nil || f.t == nil {
+		return ""
+	}
+	return f.t.String()
+}
+
+func (f *templateFlag) Set(s string) error {
+	t, err := scraper.ParseFileNameTemplate(s)
+	if err != nil {
+		return err
+	}
+	f.t = t
+	return nil
+}
+
+// fileName returns the downloader.Options.FileName for documents named by nameDocuments, or recorded by an
+// earlier run: it keeps the name a document has and names the others by the template.
+func (f *templateFlag) fileName() func(scraper.Document) string {
+	byTemplate := downloader.TemplateFileName(f.t)
+	return func(doc scraper.Document) string {
+		if doc.FileName != "" {
+			return doc.FileName
+		}
+		return byTemplate(doc)
+	}
+}
+
+// nameDocuments names each document by the template. Documents at different links that the template gives the
+// same name get a suffix from their link hash; the collisions are logged and returned. Naming the whole
+// listing this way, rather than only the documents being downloaded, keeps the names stable from run to run.
+func (f *templateFlag) nameDocuments(docs []scraper.Document) []downloader.Collision {
+	names, collisions := downloader.ResolveFileNames(docs, downloader.TemplateFileName(f.t))
+	for i := range docs {
+		docs[i].FileName = names[i]
+	}
+	for _, c := range collisions {
+		log.Printf("downloader: %d documents would be named %s; adding a suffix to each", len(c.Documents), c.FileName)
+	}
+	return collisions
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/polite"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// crawlFlags are the flags that pace requests to the City's server, shared by every command that fetches.
+type crawlFlags struct {
+	rate      float64
+	bandwidth int64
+	perHost   int
+	userAgent string
+	robots    bool
+	// upgradeHTTPS and timezone are not about pacing, but every command that fetches the listing must agree on
+	// them: links, and so document IDs, differ with and without upgradeHTTPS, and meeting dates with timezone.
+	upgradeHTTPS bool
+	timezone     locationFlag
+}
+
+func addCrawlFlags(fs *flag.FlagSet) *crawlFlags {
+	c := &crawlFlags{}
+	fs.Float64Var(&c.rate, "rate", 2, "maximum requests per second; zero disables the limit")
+	fs.Int64Var(&c.bandwidth, "bandwidth", 0, "maximum download bytes per second; zero disables the limit")
+	fs.IntVar(&c.perHost, "perHost", 2, "maximum concurrent requests to one host; zero disables the cap")
+	fs.StringVar(&c.userAgent, "userAgent", downloader.DefaultUserAgent, "User-Agent sent with every request")
+	fs.BoolVar(&c.robots, "robots", true, "honour robots.txt and its Crawl-delay")
+	fs.BoolVar(&c.upgradeHTTPS, "upgradeHTTPS", false, "rewrite http document links on the listing to https")
+	c.timezone.loc = scraper.DefaultLocation
+	fs.Var(&c.timezone, "timezone", "IANA time zone meeting dates on the listing and in date filters are read in")
+	return c
+}
+
+// location returns the time zone set by -timezone.
+func (c *crawlFlags) location() *time.Location {
+	return c.timezone.loc
+}
+
+// locationFlag is a flag.Value holding an IANA time zone.
+type locationFlag struct {
+	loc *time.Location
+}
+
+func (f *locationFlag) String() string {
+	if f == nil || f.loc == nil {
+		return ""
+	}
+	return f.loc.String()
+}
+
+func (f *locationFlag) Set(s string) error {
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return err
+	}
+	f.loc = loc
+	return nil
+}
+
+// client returns a client that sends requests through next, or http.DefaultTransport, within the limits.
+func (c *crawlFlags) client(next http.RoundTripper) *http.Client {
+	return polite.New(polite.Config{
+		Next:              next,
+		RequestsPerSecond: c.rate,
+		BytesPerSecond:    c.bandwidth,
+		PerHost:           c.perHost,
+		UserAgent:         c.userAgent,
+		Robots:            c.robots,
+	}).Client()
+}
+
+// documents scrapes the listing through client.
+func (c *crawlFlags) documents(ctx context.Context, client *http.Client) ([]scraper.Document, error) {
+	return scraper.GetDocumentsWithOptions(ctx, scraper.Options{
+		Client:       client,
+		Location:     c.location(),
+		UpgradeHTTPS: c.upgradeHTTPS,
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+)
+
+// newProgress returns the download progress reporter for mode: "bar" draws a live progress bar on stderr,
+// "json" writes one JSON event per line to stderr, "log" logs each download and "none" reports nothing.
+// "auto" picks bar when stderr is a terminal and json otherwise.
+func newProgress(mode string) (downloader.ProgressFunc, func(), error) {
+	if mode == "auto" {
+		mode = "json"
+		if isTerminal(os.Stderr) {
+			mode = "bar"
+		}
+	}
+	switch mode {
+	case "bar":
+		bar := &progressBar{w: os.Stderr, active: make(map[int]downloader.Event)}
+		return bar.update, bar.finish, nil
+	case "json":
+		return downloader.JSONProgress(os.Stderr), func() {}, nil
+	case "log":
+		return downloader.LogProgress, func() {}, nil
+	case "none":
+		return nil, func() {}, nil
+	}
+	return nil, nil, fmt.Errorf("unknown progress mode %q (want auto, bar, json, log or none)", mode)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar aggregates download events into a single redrawn status line.
+type progressBar struct {
+	w        io.Writer
+	total    int
+	done     int
+	skipped  int
+	failed   int
+	bytes    int64
+	active   map[int]downloader.Event
+	drawn    time.Time
+	lastLine int
+}
+
+func (b *progressBar) update(e downloader.Event) {
+	switch e.Type {
+	case downloader.EventQueued:
+		b.total++
+	case downloader.EventStarted, downloader.EventProgress:
+		b.active[e.Index] = e
+	case downloader.EventSkipped:
+		b.skipped++
+		b.done++
+	case downloader.EventFinished:
+		delete(b.active, e.Index)
+		b.bytes += e.Bytes
+		b.done++
+	case downloader.EventFailed:
+		delete(b.active, e.Index)
+		b.failed++
+		b.done++
+	}
+	// Redraw at most ten times a second, but always show the final state.
+	if b.done < b.total && time.Since(b.drawn) < 100*time.Millisecond {
+		return
+	}
+	b.drawn = time.Now()
+	b.draw()
+}
+
+func (b *progressBar) draw() {
+	const width = 30
+	inFlight := b.bytes
+	for _, e := range b.active {
+		inFlight += e.Bytes
+	}
+	filled := 0
+	if b.total > 0 {
+		filled = width * b.done / b.total
+	}
+	line := fmt.Sprintf("[%s%s] %d/%d documents  %s", strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		b.done, b.total, formatBytes(inFlight))
+	if b.skipped > 0 {
+		line += fmt.Sprintf("  %d unchanged", b.skipped)
+	}
+	if b.failed > 0 {
+		line += fmt.Sprintf("  %d failed", b.failed)
+	}
+	pad := ""
+	if n := b.lastLine - len(line); n > 0 {
+		pad = strings.Repeat(" ", n)
+	}
+	b.lastLine = len(line)
+	fmt.Fprintf(b.w, "\r%s%s", line, pad)
+}
+
+// finish ends the status line so later output starts on a new line.
+func (b *progressBar) finish() {
+	if b.total > 0 {
+		b.draw()
+		fmt.Fprintln(b.w)
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/feed"
+	"github.com/dntiontk/civic-code/pkg/prune"
+	"github.com/dntiontk/civic-code/pkg/storage"
+)
+
+// stateFiles are the files and directories other commands keep in the download directory. prune never
+// touches them.
+var stateFiles = []string{
+	"metadata.json", firstSeenFile, failuresFile, digestStateFile, lastRunFile, "refs.json", "watch-state.json",
+	"webhook-queue.json", "webhook-log.jsonl", "*.warc", "*.warc.gz", "*.tmp", "quarantine/",
+}
+
+// pruneReport is the output of prune.
+type pruneReport struct {
+	DryRun bool `json:"dryRun"`
+	*prune.Plan
+}
+
+// runPrune removes downloaded files that a retention policy no longer wants, and their metadata.json entries.
+func runPrune(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	dir := fs.String("downloadDir", "./downloads", "directory holding downloaded PDFs and metadata.json")
+	unlisted := fs.Bool("unlisted", false, "remove documents no longer in the upstream listing")
+	keepYears := fs.Int("keepYears", 0, "keep only documents from the last N calendar years, this year included; zero keeps all")
+	latestOnly := fs.Bool("latestOnly", false, "keep only the most recently posted of documents sharing a meeting and name")
+	orphans := fs.Bool("orphans", false, "remove files not recorded in metadata.json (requires -force)")
+	force := fs.Bool("force", false, "also remove files of unknown provenance: orphans and files modified since download")
+	dryRun := fs.Bool("dryRun", false, "list what would be removed without removing anything")
+	timeout := fs.Duration("timeout", 2*time.Minute, "timeout for fetching the listing")
+	crawl := addCrawlFlags(fs)
+	_ = fs.Parse(args)
+
+	if !*unlisted && *keepYears <= 0 && !*latestOnly && !*orphans {
+		log.Fatal("prune: choose at least one of -unlisted, -keepYears, -latestOnly or -orphans")
+	}
+	if _, err := os.Stat(filepath.Join(*dir, storage.ManifestKey)); err == nil {
+		log.Fatalf("prune: %s uses a content-addressed layout, which prune does not support", *dir)
+	}
+	meta, err := loadMetadata(*dir)
+	if errors.Is(err, os.ErrNotExist) {
+		meta = &Result{}
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	policy := prune.Policy{
+		KeepYears:  *keepYears,
+		Now:        time.Now(),
+		LatestOnly: *latestOnly,
+		Orphans:    *orphans,
+		Force:      *force,
+		Protect:    stateFiles,
+	}
+	if *unlisted {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		listed, err := crawl.documents(ctx, crawl.client(nil))
+		if err != nil {
+			log.Fatal(err)
+		}
+		policy.Listed = listed
+	}
+	if *latestOnly {
+		firstSeen, err := feed.LoadFirstSeen(filepath.Join(*dir, firstSeenFile))
+		if err != nil {
+			log.Fatal(err)
+		}
+		policy.FirstSeen = firstSeen
+	}
+
+	plan, err := prune.NewPlan(*dir, meta.Items, policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !*dryRun {
+		if err := plan.Apply(*dir); err != nil {
+			log.Print(err)
+		}
+		if len(plan.Keep) != len(meta.Items) {
+			meta.Items, meta.Len = plan.Keep, len(plan.Keep)
+			if err := saveMetadata(*dir, meta); err != nil {
+				log.Fatal(err)
+			}
+		}
+		log.Printf("prune: removed %d files (%d bytes); skipped %d", len(plan.Remove), plan.Bytes, len(plan.Skipped))
+	}
+	if err := writeJSON(os.Stdout, pruneReport{DryRun: *dryRun, Plan: plan}); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/dntiontk/civic-code/pkg/pdftext"
+	"github.com/dntiontk/civic-code/pkg/refs"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// runRefs lists every downloaded Document and page that mentions the given by-law, resolution or report numbers.
+func runRefs(args []string) {
+	fs := flag.NewFlagSet("refs", flag.ExitOnError)
+	dir := fs.String("downloadDir", "./downloads", "directory containing downloaded PDFs and metadata.json")
+	rebuild := fs.Bool("rebuild", false, "re-extract text from every document instead of reusing refs.json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: doc-search refs [flags] ID...\n\nExamples: \"CR456/2024\", \"By-law 123-2024\", \"S 89/2024\"\n\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	queries := make([]refs.Ref, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		ref, err := refs.Parse(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		queries = append(queries, ref)
+	}
+
+	idx, err := buildRefIndex(*dir, *rebuild)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	type refResult struct {
+		Ref     refs.Ref     `json:"ref"`
+		Len     int          `json:"len"`
+		Matches []refs.Match `json:"matches"`
+	}
+	out := make([]refResult, 0, len(queries))
+	for _, ref := range queries {
+		matches := idx.Lookup(ref)
+		out = append(out, refResult{Ref: ref, Len: len(matches), Matches: matches})
+	}
+	if err := writeJSON(os.Stdout, out); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// buildRefIndex loads refs.json from dir and indexes any downloaded documents that are new or changed.
+func buildRefIndex(dir string, rebuild bool) (*refs.Index, error) {
+	meta, err := loadMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	indexPath := filepath.Join(dir, "refs.json")
+	idx := refs.NewIndex()
+	if !rebuild {
+		if idx, err = refs.Load(indexPath); err != nil {
+			return nil, err
+		}
+	}
+
+	updated := 0
+	for _, doc := range meta.Items {
+		if idx.Indexed(doc) {
+			continue
+		}
+		pages, err := documentPages(dir, doc)
+		if err != nil {
+			log.Printf("refs: skipping %s: %v", doc.Name, err)
+			continue
+		}
+		idx.Add(doc, pages)
+		updated++
+	}
+
+	if updated > 0 {
+		log.Printf("refs: indexed %d documents", updated)
+		if err := idx.Save(indexPath); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// documentPages extracts the text of each page of a downloaded Document.
+func documentPages(dir string, doc scraper.Document) ([]string, error) {
+	if doc.FileName == "" {
+		doc.ApplyFileNameSchema()
+	}
+	return pdftext.ReadFile(filepath.Join(dir, doc.FileName))
+}
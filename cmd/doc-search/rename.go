@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/rename"
+	"github.com/dntiontk/civic-code/pkg/storage"
+)
+
+// renameReport is the output of rename.
+type renameReport struct {
+	DryRun     bool                   `json:"dryRun"`
+	Template   string                 `json:"template"`
+	Moves      []rename.Move          `json:"moves"`
+	Collisions []downloader.Collision `json:"collisions,omitempty"`
+}
+
+// runRename moves the files in a download directory to the names a new file name template gives them and
+// rewrites metadata.json to match.
+func runRename(args []string) {
+	fs := flag.NewFlagSet("rename", flag.ExitOnError)
+	dir := fs.String("downloadDir", "./downloads", "directory holding downloaded PDFs and metadata.json")
+	dryRun := fs.Bool("dryRun", false, "list the moves without making them")
+	naming := addNameTemplateFlag(fs)
+	_ = fs.Parse(args)
+
+	if _, err := os.Stat(filepath.Join(*dir, storage.ManifestKey)); err == nil {
+		log.Fatalf("rename: %s uses a content-addressed layout, which rename does not support", *dir)
+	}
+	meta, err := loadMetadata(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	names, collisions := downloader.ResolveFileNames(meta.Items, downloader.TemplateFileName(naming.t))
+	for _, c := range collisions {
+		log.Printf("rename: %d documents would be named %s; adding a suffix to each", len(c.Documents), c.FileName)
+	}
+	plan, err := rename.NewPlan(*dir, meta.Items, names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !*dryRun {
+		// A failed move is undone, so metadata.json still matches the files.
+		if err := plan.Apply(*dir); err != nil {
+			log.Fatal(err)
+		}
+		for i, doc := range meta.Items {
+			if doc.FileName != "" {
+				meta.Items[i].FileName = names[i]
+			}
+		}
+		if err := saveMetadata(*dir, meta); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("rename: moved %d files", plan.Moved())
+	}
+	if err := writeJSON(os.Stdout, renameReport{DryRun: *dryRun, Template: naming.String(), Moves: plan.Moves, Collisions: collisions}); err != nil {
+		log.Fatal(err)
+	}
+}
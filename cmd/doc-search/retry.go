@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// failuresFile records, in the download directory, the documents whose last download failed.
+const failuresFile = "failures.json"
+
+// recordFailures updates the failures manifest in dir with the outcome of downloading docs.
+func recordFailures(dir string, docs []scraper.Document, err error) error {
+	path := filepath.Join(dir, failuresFile)
+	m, loadErr := downloader.LoadFailures(path)
+	if loadErr != nil {
+		return loadErr
+	}
+	m.Update(docs, err, time.Now())
+	if len(m) > 0 {
+		log.Printf("downloader: %d failed documents recorded in %s", len(m), path)
+	}
+	return m.Save(path)
+}
+
+// retryReport is the output of retry-failed.
+type retryReport struct {
+	Retried   int                  `json:"retried"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    []downloader.Failure `json:"failed"`
+}
+
+// runRetryFailed downloads again only the documents in the failures manifest, without scraping the listing.
+func runRetryFailed(args []string) {
+	fs := flag.NewFlagSet("retry-failed", flag.ExitOnError)
+	dir := fs.String("downloadDir", "./downloads", "directory holding failures.json and metadata.json")
+	storageLoc := fs.String("storage", "", "where downloaded PDFs are stored (default downloadDir)")
+	layout := fs.String("layout", "", "storage layout used for the download: hardlink, symlink or manifest")
+	workers := fs.Int("concurrency", 4, "number of concurrent downloads")
+	maxSize := fs.Int64("maxSize", 0, "fail documents larger than this many bytes; zero disables the limit")
+	quarantine := fs.String("quarantine", "quarantine/", "keep responses that are not the expected kind of file under this prefix of the storage; empty discards them")
+	progressMode := fs.String("progress", "auto", "download progress: bar, json, log or none (auto picks bar on a terminal, json otherwise)")
+	timeout := fs.Duration("timeout", 10*time.Minute, "timeout for the downloads")
+	crawl := addCrawlFlags(fs)
+	naming := addNameTemplateFlag(fs)
+	_ = fs.Parse(args)
+
+	path := filepath.Join(*dir, failuresFile)
+	m, err := downloader.LoadFailures(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(m) == 0 {
+		log.Printf("retry-failed: no failed documents in %s", path)
+		return
+	}
+	previous := m.List()
+	docs := m.Documents()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	location := *dir
+	if *storageLoc != "" {
+		location = *storageLoc
+	}
+	store, err := openStorage(ctx, location, *layout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	progress, finishProgress, err := newProgress(*progressMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	d, err := downloader.New(downloader.Options{
+		Storage:     store,
+		Client:      crawl.client(nil),
+		Progress:    progress,
+		FileName:    naming.fileName(),
+		Concurrency: *workers,
+		MaxSize:     *maxSize,
+		Quarantine:  *quarantine,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("retry-failed: retrying %d documents", len(docs))
+	downloaded, dlErr := d.Download(ctx, docs)
+	finishProgress()
+
+	m.Update(downloaded, dlErr, time.Now())
+	if err := m.Save(path); err != nil {
+		log.Fatal(err)
+	}
+
+	// Record the recovered documents and drop the quarantined responses they replace.
+	recovered := make([]scraper.Document, 0)
+	for i, doc := range downloaded {
+		if _, failed := m[previous[i].ID]; failed {
+			continue
+		}
+		recovered = append(recovered, doc)
+		if key := previous[i].Quarantined; key != "" {
+			if err := store.Delete(ctx, key); err != nil {
+				log.Printf("retry-failed: remove %s: %v", key, err)
+			}
+		}
+	}
+	if len(recovered) > 0 {
+		if err := updateMetadata(*dir, recovered); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	report := retryReport{Retried: len(docs), Succeeded: len(recovered), Failed: m.List()}
+	if err := writeJSON(os.Stdout, report); err != nil {
+		log.Fatal(err)
+	}
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/dntiontk/civic-code/pkg/server"
+	"github.com/dntiontk/civic-code/pkg/storage"
+)
+
+// runServe serves the document catalogue as a JSON API, refreshing it in the background.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	dir := fs.String("downloadDir", "./downloads", "directory to store and serve downloaded PDFs")
+	refresh := fs.Duration("refresh", time.Hour, "interval between catalogue refreshes; zero disables them")
+	download := fs.Bool("download", false, "download new PDFs on every refresh")
+	workers := fs.Int("concurrency", 4, "number of concurrent downloads")
+	baseURL := fs.String("baseURL", "", "public URL of the server that feeds link to (default the scheme and host of each request)")
+	trustProxy := fs.Bool("trustProxy", false, "take the scheme and host from X-Forwarded-Proto and X-Forwarded-Host; set only behind a proxy that sets them")
+	crawl := addCrawlFlags(fs)
+	naming := addNameTemplateFlag(fs)
+	_ = fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	srv := server.New(server.Config{
+		DownloadDir:     *dir,
+		RefreshInterval: *refresh,
+		Fetch:           catalogueFetcher(*dir, *download, *workers, crawl, naming),
+		FirstSeenPath:   filepath.Join(*dir, firstSeenFile),
+		Location:        crawl.location(),
+		BaseURL:         *baseURL,
+		TrustProxy:      *trustProxy,
+	})
+
+	// Serve the last known catalogue while the first scrape runs.
+	if meta, err := loadMetadata(*dir); err == nil {
+		srv.SetDocuments(meta.Items)
+		log.Printf("server: loaded %d documents from metadata.json", len(meta.Items))
+	}
+	go func() {
+		if err := srv.Refresh(ctx); err != nil {
+			log.Print(err)
+		}
+		srv.Run(ctx)
+	}()
+
+	httpServer := &http.Server{Addr: *addr, Handler: srv.Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("server: shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("server: listening on %s", *addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// catalogueFetcher scrapes the listing, carries over what metadata.json knows about each document and, when
+// download is set, downloads new documents and rewrites metadata.json.
+func catalogueFetcher(dir string, download bool, workers int, crawl *crawlFlags, naming *templateFlag) server.FetchFunc {
+	client := crawl.client(nil)
+	return func(ctx context.Context) ([]scraper.Document, error) {
+		docs, err := crawl.documents(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		collisions := naming.nameDocuments(docs)
+		if meta, err := loadMetadata(dir); err == nil {
+			mergeKnown(docs, meta.Items)
+		}
+		if !download {
+			return docs, nil
+		}
+
+		d, err := downloader.New(downloader.Options{
+			Storage:     storage.NewLocal(dir),
+			Client:      client,
+			Progress:    downloader.LogProgress,
+			FileName:    naming.fileName(),
+			Concurrency: workers,
+			// A refresh picks up PDFs the City replaced rather than failing them on every run.
+			ReplaceChanged: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		res := &Result{Collisions: collisions}
+		downloaded, err := d.Download(ctx, docs)
+		if downloaded != nil {
+			docs = downloaded
+		}
+		if err != nil {
+			log.Printf("download errors: %v", err)
+			res.Errors = append(res.Errors, err.Error())
+			res.Failures = failures(err)
+		}
+		res.Len, res.Items = len(docs), docs
+		if err := saveMetadata(dir, res); err != nil {
+			return nil, err
+		}
+		return docs, nil
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/dntiontk/civic-code/pkg/site"
+)
+
+// runSite renders a static HTML archive of the documents in metadata.json.
+func runSite(args []string) {
+	fs := flag.NewFlagSet("site", flag.ExitOnError)
+	out := fs.String("out", "./public", "directory to write the site to")
+	dir := fs.String("downloadDir", "./downloads", "directory holding metadata.json and the downloaded PDFs")
+	templates := fs.String("templates", "", "directory of templates and assets overriding the defaults")
+	title := fs.String("title", "", "site title")
+	noPDFs := fs.Bool("noPDFs", false, "link to the city's website instead of copying downloaded PDFs into the site")
+	_ = fs.Parse(args)
+
+	meta, err := loadMetadata(*dir)
+	if err != nil {
+		log.Fatalf("site: %v (run doc-search -download first)", err)
+	}
+
+	opts := site.Options{Title: *title, TemplateDir: *templates}
+	if !*noPDFs {
+		opts.PDFDir = *dir
+	}
+	if err := site.Generate(*out, meta.Items, opts); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("site: wrote %d documents to %s", len(meta.Items), *out)
+}
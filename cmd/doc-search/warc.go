@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/warc"
+)
+
+// openWARC creates a WARC file at path, compressed when it ends in .gz, and returns a recorder writing to it.
+func openWARC(path string) (*warc.Recorder, func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := warc.NewWriter(f, strings.HasSuffix(path, ".gz"))
+	info := map[string]string{
+		"software": "civic-code doc-search",
+		"format":   "WARC File Format 1.1",
+		"isPartOf": "City of Windsor council agendas",
+	}
+	if err := w.WriteWarcinfo(time.Now(), filepath.Base(path), info); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	closeFile := func() {
+		if err := f.Close(); err != nil {
+			log.Printf("warc: close %s: %v", path, err)
+		}
+	}
+	return &warc.Recorder{Writer: w}, closeFile, nil
+}
+
+// warcReport is the JSON printed by verify-warc.
+type warcReport struct {
+	File     string        `json:"file"`
+	Records  int           `json:"records"`
+	Problems []warcProblem `json:"problems,omitempty"`
+}
+
+type warcProblem struct {
+	RecordID  string `json:"recordId"`
+	TargetURI string `json:"targetUri,omitempty"`
+	Error     string `json:"error"`
+}
+
+// runVerifyWARC checks the record and payload digests of WARC files and exits non-zero if any fail.
+func runVerifyWARC(args []string) {
+	fs := flag.NewFlagSet("verify-warc", flag.ExitOnError)
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		log.Fatal("verify-warc: pass one or more WARC files")
+	}
+
+	failed := false
+	reports := make([]warcReport, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		count, problems, err := warc.Verify(f)
+		f.Close()
+		report := warcReport{File: path, Records: count}
+		for _, p := range problems {
+			report.Problems = append(report.Problems, warcProblem{RecordID: p.RecordID, TargetURI: p.TargetURI, Error: p.Err.Error()})
+		}
+		if err != nil {
+			report.Problems = append(report.Problems, warcProblem{Error: err.Error()})
+		}
+		failed = failed || len(report.Problems) > 0
+		reports = append(reports, report)
+	}
+	if err := writeJSON(os.Stdout, reports); err != nil {
+		log.Fatal(err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/notifier"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/dntiontk/civic-code/pkg/storage"
+	"github.com/dntiontk/civic-code/pkg/watch"
+)
+
+// stringsFlag collects the values of a repeatable string flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// runWatch re-scrapes the listing on a schedule and runs actions for new, changed and removed documents.
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", 15*time.Minute, "time between polls")
+	jitter := fs.Duration("jitter", time.Minute, "maximum random delay added to each interval")
+	dir := fs.String("downloadDir", "./downloads", "directory for downloaded PDFs, metadata.json and watch state")
+	statePath := fs.String("state", "", "file to persist known documents to (default downloadDir/watch-state.json)")
+	download := fs.Bool("download", false, "download new and changed documents")
+	workers := fs.Int("concurrency", 4, "number of concurrent downloads")
+	notifyExisting := fs.Bool("notifyExisting", false, "run actions for every listed document on the first poll without state")
+	eventsFile := fs.String("eventsFile", "", "append each event as a line of JSON to this file")
+	var commands, webhooks stringsFlag
+	fs.Var(&commands, "exec", "shell command to run for each event with the event JSON on stdin (repeatable)")
+	fs.Var(&webhooks, "webhook", "URL to POST each event to as signed JSON (repeatable)")
+	webhookSecret := fs.String("webhookSecret", os.Getenv("CIVIC_WEBHOOK_SECRET"), "key for the HMAC-SHA256 webhook signature (default $CIVIC_WEBHOOK_SECRET)")
+	crawl := addCrawlFlags(fs)
+	naming := addNameTemplateFlag(fs)
+	_ = fs.Parse(args)
+
+	if *statePath == "" {
+		*statePath = filepath.Join(*dir, "watch-state.json")
+	}
+
+	actions := make([]watch.Action, 0)
+	for _, c := range commands {
+		actions = append(actions, watch.Command(c))
+	}
+	if *eventsFile != "" {
+		actions = append(actions, watch.File(*eventsFile))
+	}
+	var notify *notifier.Notifier
+	if len(webhooks) > 0 {
+		endpoints := make([]notifier.Endpoint, 0, len(webhooks))
+		for _, u := range webhooks {
+			endpoints = append(endpoints, notifier.Endpoint{URL: u, Secret: *webhookSecret})
+		}
+		var err error
+		notify, err = notifier.New(notifier.Config{
+			Endpoints: endpoints,
+			QueuePath: filepath.Join(*dir, "webhook-queue.json"),
+			LogPath:   filepath.Join(*dir, "webhook-log.jsonl"),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		actions = append(actions, notify.Action())
+	}
+
+	client := crawl.client(nil)
+	cfg := watch.Config{
+		Fetch: func(ctx context.Context) ([]scraper.Document, error) {
+			docs, err := crawl.documents(ctx, client)
+			naming.nameDocuments(docs)
+			return docs, err
+		},
+		Actions:        actions,
+		Interval:       *interval,
+		Jitter:         *jitter,
+		StatePath:      *statePath,
+		NotifyExisting: *notifyExisting,
+	}
+	if *download {
+		d, err := downloader.New(downloader.Options{
+			Storage:     storage.NewLocal(*dir),
+			Client:      client,
+			Progress:    downloader.LogProgress,
+			FileName:    naming.fileName(),
+			Concurrency: *workers,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Download = func(ctx context.Context, docs []scraper.Document) ([]scraper.Document, error) {
+			downloaded, err := d.Download(ctx, docs)
+			// Keep metadata.json in step with what has been downloaded so the other commands can use it.
+			if metaErr := updateMetadata(*dir, downloaded); metaErr != nil {
+				log.Printf("watch: %v", metaErr)
+			}
+			// Failed documents are retried at the next poll, and can be retried sooner with retry-failed.
+			if failErr := recordFailures(*dir, downloaded, err); failErr != nil {
+				log.Printf("watch: %v", failErr)
+			}
+			return downloaded, err
+		}
+	}
+
+	w, err := watch.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if notify != nil {
+		if n := notify.Pending(); n > 0 {
+			log.Printf("watch: resuming %d queued webhook deliveries", n)
+		}
+		go notify.Run(ctx)
+	}
+
+	log.Printf("watch: polling every %s (+ up to %s jitter), %d actions", *interval, *jitter, len(actions))
+	if err := w.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("watch: stopped")
+}
@@ -0,0 +1,129 @@
+// Package archive writes ZIP and tar.gz archives deterministically: entries are sorted by name and every
+// timestamp, owner and mode is fixed, so the same entries always produce the same bytes.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Format is an archive format.
+type Format string
+
+const (
+	Zip   Format = "zip"
+	TarGz Format = "tar.gz"
+)
+
+// ParseFormat returns the Format named by s, accepting "tgz" for tar.gz.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "zip":
+		return Zip, nil
+	case "tar.gz", "tgz":
+		return TarGz, nil
+	}
+	return "", fmt.Errorf("archive: unknown format %q (want zip or tar.gz)", s)
+}
+
+// Ext returns the file name extension for the format, without a leading dot.
+func (f Format) Ext() string {
+	return string(f)
+}
+
+// Entry is a file to add to an archive. Open is called once, when the entry is written, so contents are
+// streamed rather than held in memory.
+type Entry struct {
+	// Name is the slash-separated path inside the archive.
+	Name string
+	Size int64
+	Open func() (io.ReadCloser, error)
+}
+
+// Bytes returns an Entry holding data.
+func Bytes(name string, data []byte) Entry {
+	return Entry{
+		Name: name,
+		Size: int64(len(data)),
+		Open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil },
+	}
+}
+
+// Write writes entries to w in name order with modTime on every entry.
+func Write(w io.Writer, format Format, entries []Entry, modTime time.Time) error {
+	entries = slices.Clone(entries)
+	slices.SortStableFunc(entries, func(a, b Entry) int { return strings.Compare(a.Name, b.Name) })
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Name == entries[i-1].Name {
+			return fmt.Errorf("archive: duplicate entry %q", entries[i].Name)
+		}
+	}
+	// Zip stores timestamps with two-second precision; truncate so both formats agree.
+	modTime = modTime.UTC().Truncate(2 * time.Second)
+
+	switch format {
+	case Zip:
+		return writeZip(w, entries, modTime)
+	case TarGz:
+		return writeTarGz(w, entries, modTime)
+	}
+	return fmt.Errorf("archive: unknown format %q", format)
+}
+
+func writeZip(w io.Writer, entries []Entry, modTime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: e.Name, Method: zip.Deflate, Modified: modTime})
+		if err != nil {
+			return err
+		}
+		if err := copyEntry(fw, e); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, entries []Entry, modTime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.Name,
+			Size:     e.Size,
+			Mode:     0o644,
+			ModTime:  modTime,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copyEntry(tw, e); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func copyEntry(w io.Writer, e Entry) error {
+	rc, err := e.Open()
+	if err != nil {
+		return fmt.Errorf("archive: %s: %w", e.Name, err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(w, rc); err != nil {
+		return fmt.Errorf("archive: %s: %w", e.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+)
+
+func testEntries() []Entry {
+	return []Entry{
+		Bytes("pdfs/b.pdf", []byte("second")),
+		Bytes("metadata.json", []byte(`{"len":2}`)),
+		Bytes("pdfs/a.pdf", []byte("first")),
+	}
+}
+
+func TestWriteDeterministic(t *testing.T) {
+	mod := time.Date(2024, time.March, 4, 10, 30, 1, 0, time.FixedZone("EST", -5*3600))
+	for _, format := range []Format{Zip, TarGz} {
+		var first, second bytes.Buffer
+		if err := Write(&first, format, testEntries(), mod); err != nil {
+			t.Fatalf("%s: Write returned error: %v", format, err)
+		}
+		entries := testEntries()
+		entries[0], entries[2] = entries[2], entries[0]
+		if err := Write(&second, format, entries, mod); err != nil {
+			t.Fatalf("%s: Write returned error: %v", format, err)
+		}
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Fatalf("%s: archives differ", format)
+		}
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	var buf bytes.Buffer
+	mod := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	if err := Write(&buf, Zip, testEntries(), mod); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	want := []string{"metadata.json", "pdfs/a.pdf", "pdfs/b.pdf"}
+	if len(zr.File) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(zr.File))
+	}
+	for i, f := range zr.File {
+		if f.Name != want[i] || !f.Modified.Equal(mod) {
+			t.Fatalf("unexpected entry %d: %s %s", i, f.Name, f.Modified)
+		}
+	}
+	rc, _ := zr.File[1].Open()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "first" {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
+
+func TestWriteTarGz(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, TarGz, testEntries(), time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("open gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	names := make([]string, 0)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.Uid != 0 || hdr.Uname != "" || hdr.Mode != 0o644 {
+			t.Fatalf("unexpected header: %+v", hdr)
+		}
+	}
+	if len(names) != 3 || names[0] != "metadata.json" || names[2] != "pdfs/b.pdf" {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+}
+
+func TestWriteDuplicate(t *testing.T) {
+	entries := append(testEntries(), Bytes("pdfs/a.pdf", nil))
+	if err := Write(io.Discard, Zip, entries, time.Time{}); err == nil {
+		t.Fatalf("expected duplicate entry error")
+	}
+}
@@ -0,0 +1,251 @@
+// Package daterange parses the relative and calendar date ranges accepted by -range, such as last-30d,
+// this-year, 2024-Q2 and 2023-09..2024-03, into inclusive meeting date filters.
+package daterange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// SinceLastRun is the range of meetings on or after the day of the previous run.
+const SinceLastRun = "since-last-run"
+
+// ErrNoLastRun is returned for SinceLastRun when Options.LastRun is zero.
+var ErrNoLastRun = errors.New("daterange: no previous run recorded")
+
+// Options configures Parse.
+type Options struct {
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+	// Location is where "today" is decided and days start; it defaults to scraper.DefaultLocation.
+	Location *time.Location
+	// LastRun is the time of the previous run, for SinceLastRun.
+	LastRun time.Time
+}
+
+// Range is an inclusive span of days. From and To are midnight at the start of the first and last day; a zero
+// bound leaves that side open.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// Filters returns the FilterFuncs that keep documents with meetings in the range.
+func (r Range) Filters() []scraper.FilterFunc {
+	filters := make([]scraper.FilterFunc, 0, 2)
+	if !r.From.IsZero() {
+		filters = append(filters, scraper.OnOrAfter(r.From))
+	}
+	if !r.To.IsZero() {
+		filters = append(filters, scraper.OnOrBefore(r.To))
+	}
+	return filters
+}
+
+// String returns the range as first..last day, with an open side left empty.
+func (r Range) String() string {
+	day := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	}
+	return day(r.From) + ".." + day(r.To)
+}
+
+var (
+	relativeRegex = regexp.MustCompile(`^(last|next)-(\d+)([dwmy])$`)
+	quarterRegex  = regexp.MustCompile(`^(\d{4})-[Qq]([1-4])$`)
+	monthRegex    = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+	dayRegex      = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+	yearRegex     = regexp.MustCompile(`^(\d{4})$`)
+)
+
+// Parse parses a range. It accepts:
+//
+//	today, yesterday
+//	this-week, this-month, this-quarter, this-year   the current period, Monday to Sunday for weeks
+//	last-week, last-month, last-quarter, last-year   the previous period
+//	last-30d, last-8w, last-6m, last-2y              the last N days, weeks, months or years, ending today
+//	next-14d, ...                                    the next N days, weeks, months or years, from today
+//	2024, 2024-Q2, 2024-03, 2024-03-05               a calendar year, quarter, month or day
+//	2023-09..2024-03                                 from the start of one period to the end of another;
+//	                                                 either side may be empty to leave it open
+//	since-last-run                                   from the day of Options.LastRun
+func Parse(s string, opts Options) (Range, error) {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.Location == nil {
+		opts.Location = scraper.DefaultLocation
+	}
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == SinceLastRun {
+		if opts.LastRun.IsZero() {
+			return Range{}, ErrNoLastRun
+		}
+		return Range{From: startOfDay(opts.LastRun.In(opts.Location))}, nil
+	}
+	if from, to, ok := strings.Cut(s, ".."); ok {
+		if from == "" && to == "" {
+			return Range{}, fmt.Errorf("daterange: %q: give at least one side of the range", s)
+		}
+		var r Range
+		if from != "" {
+			first, err := period(from, opts)
+			if err != nil {
+				return Range{}, err
+			}
+			r.From = first.From
+		}
+		if to != "" {
+			last, err := period(to, opts)
+			if err != nil {
+				return Range{}, err
+			}
+			r.To = last.To
+		}
+		if !r.From.IsZero() && !r.To.IsZero() && r.To.Before(r.From) {
+			return Range{}, fmt.Errorf("daterange: %q ends before it starts", s)
+		}
+		return r, nil
+	}
+	return period(s, opts)
+}
+
+// period parses one period of Parse, anything but a from..to pair or since-last-run.
+func period(s string, opts Options) (Range, error) {
+	loc := opts.Location
+	today := startOfDay(opts.Now().In(loc))
+	y, m, _ := today.Date()
+	quarter := time.Month((int(m)-1)/3*3 + 1)
+	week := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+
+	switch s {
+	case "today":
+		return Range{today, today}, nil
+	case "yesterday":
+		day := today.AddDate(0, 0, -1)
+		return Range{day, day}, nil
+	case "this-week":
+		return span(week, 0, 0, 7), nil
+	case "last-week":
+		return span(week.AddDate(0, 0, -7), 0, 0, 7), nil
+	case "this-month":
+		return span(time.Date(y, m, 1, 0, 0, 0, 0, loc), 0, 1, 0), nil
+	case "last-month":
+		return span(time.Date(y, m-1, 1, 0, 0, 0, 0, loc), 0, 1, 0), nil
+	case "this-quarter":
+		return span(time.Date(y, quarter, 1, 0, 0, 0, 0, loc), 0, 3, 0), nil
+	case "last-quarter":
+		return span(time.Date(y, quarter-3, 1, 0, 0, 0, 0, loc), 0, 3, 0), nil
+	case "this-year":
+		return span(time.Date(y, time.January, 1, 0, 0, 0, 0, loc), 1, 0, 0), nil
+	case "last-year":
+		return span(time.Date(y-1, time.January, 1, 0, 0, 0, 0, loc), 1, 0, 0), nil
+	}
+
+	if g := relativeRegex.FindStringSubmatch(s); g != nil {
+		n, err := strconv.Atoi(g[2])
+		if err != nil || n < 1 {
+			return Range{}, fmt.Errorf("daterange: %q: the count must be a positive number", s)
+		}
+		years, months, days := 0, 0, 0
+		switch g[3] {
+		case "d":
+			days = n
+		case "w":
+			days = 7 * n
+		case "m":
+			months = n
+		case "y":
+			years = n
+		}
+		// N days, weeks, months or years counting today.
+		if g[1] == "next" {
+			return span(today, years, months, days), nil
+		}
+		return Range{today.AddDate(-years, -months, 1-days), today}, nil
+	}
+	if g := quarterRegex.FindStringSubmatch(s); g != nil {
+		year, _ := strconv.Atoi(g[1])
+		q, _ := strconv.Atoi(g[2])
+		return span(time.Date(year, time.Month(3*q-2), 1, 0, 0, 0, 0, loc), 0, 3, 0), nil
+	}
+	if g := monthRegex.FindStringSubmatch(s); g != nil {
+		year, _ := strconv.Atoi(g[1])
+		month, _ := strconv.Atoi(g[2])
+		if month < 1 || month > 12 {
+			return Range{}, fmt.Errorf("daterange: %q: no month %d", s, month)
+		}
+		return span(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, loc), 0, 1, 0), nil
+	}
+	if dayRegex.MatchString(s) {
+		day, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			return Range{}, fmt.Errorf("daterange: %q: %w", s, err)
+		}
+		return Range{day, day}, nil
+	}
+	if g := yearRegex.FindStringSubmatch(s); g != nil {
+		year, _ := strconv.Atoi(g[1])
+		return span(time.Date(year, time.January, 1, 0, 0, 0, 0, loc), 1, 0, 0), nil
+	}
+	return Range{}, fmt.Errorf("daterange: unknown range %q", s)
+}
+
+// span returns the range from start up to the day before start plus the given years, months and days.
+func span(start time.Time, years, months, days int) Range {
+	return Range{From: start, To: start.AddDate(years, months, days-1)}
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// LoadLastRun reads the time recorded by SaveLastRun. A missing file returns the zero time.
+func LoadLastRun(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	var v struct {
+		Time time.Time `json:"time"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return time.Time{}, fmt.Errorf("daterange: decode %s: %w", path, err)
+	}
+	return v.Time, nil
+}
+
+// SaveLastRun records t as the time of the last run in path.
+func SaveLastRun(path string, t time.Time) error {
+	data, err := json.Marshal(struct {
+		Time time.Time `json:"time"`
+	}{t})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("daterange: save %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package daterange
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+func TestParse(t *testing.T) {
+	loc := scraper.DefaultLocation
+	// Thursday evening in Windsor, already Friday in UTC.
+	now := time.Date(2024, time.May, 16, 21, 30, 0, 0, loc)
+	opts := Options{
+		Now:     func() time.Time { return now },
+		LastRun: time.Date(2024, time.May, 10, 2, 0, 0, 0, time.UTC),
+	}
+	for _, tc := range []struct{ in, want string }{
+		{"today", "2024-05-16..2024-05-16"},
+		{"yesterday", "2024-05-15..2024-05-15"},
+		{"this-week", "2024-05-13..2024-05-19"},
+		{"last-week", "2024-05-06..2024-05-12"},
+		{"this-month", "2024-05-01..2024-05-31"},
+		{"last-month", "2024-04-01..2024-04-30"},
+		{"this-quarter", "2024-04-01..2024-06-30"},
+		{"last-quarter", "2024-01-01..2024-03-31"},
+		{"this-year", "2024-01-01..2024-12-31"},
+		{"last-year", "2023-01-01..2023-12-31"},
+		{"last-30d", "2024-04-17..2024-05-16"},
+		{"last-2w", "2024-05-03..2024-05-16"},
+		{"last-6m", "2023-11-17..2024-05-16"},
+		{"next-14d", "2024-05-16..2024-05-29"},
+		{"2024", "2024-01-01..2024-12-31"},
+		{"2024-Q2", "2024-04-01..2024-06-30"},
+		{"2024-02", "2024-02-01..2024-02-29"},
+		{"2024-03-05", "2024-03-05..2024-03-05"},
+		{"2023-09..2024-03", "2023-09-01..2024-03-31"},
+		{"2024-Q1..", "2024-01-01.."},
+		{"..last-month", "..2024-04-30"},
+		// 02:00 UTC on May 10 was still May 9 in Windsor.
+		{"since-last-run", "2024-05-09.."},
+	} {
+		r, err := Parse(tc.in, opts)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.in, err)
+		}
+		if got := r.String(); got != tc.want {
+			t.Errorf("Parse(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "..", "last-0d", "2024-13", "2024-02-30", "2024-03..2023-09", "soon"} {
+		if _, err := Parse(bad, opts); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", bad)
+		}
+	}
+	if _, err := Parse(SinceLastRun, Options{}); !errors.Is(err, ErrNoLastRun) {
+		t.Errorf("since-last-run without a last run = %v, want ErrNoLastRun", err)
+	}
+}
+
+func TestRangeFilters(t *testing.T) {
+	loc := scraper.DefaultLocation
+	docs := []scraper.Document{
+		{Name: "march.pdf", Date: time.Date(2024, time.March, 31, 19, 0, 0, 0, loc)},
+		{Name: "april.pdf", Date: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "june.pdf", Date: time.Date(2024, time.June, 30, 22, 0, 0, 0, loc)},
+		{Name: "july.pdf", Date: time.Date(2024, time.July, 1, 0, 0, 0, 0, loc)},
+	}
+	r, err := Parse("2024-Q2", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filter := range r.Filters() {
+		docs = filter(docs)
+	}
+	if len(docs) != 2 || docs[0].Name != "april.pdf" || docs[1].Name != "june.pdf" {
+		t.Fatalf("Q2 filters => %+v, want april.pdf and june.pdf", docs)
+	}
+}
+
+func TestLastRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last-run.json")
+	if got, err := LoadLastRun(path); err != nil || !got.IsZero() {
+		t.Fatalf("LoadLastRun of a missing file = %v, %v", got, err)
+	}
+	want := time.Date(2024, time.May, 10, 2, 0, 0, 0, time.UTC)
+	if err := SaveLastRun(path, want); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LoadLastRun(path); err != nil || !got.Equal(want) {
+		t.Fatalf("LoadLastRun = %v, %v, want %v", got, err, want)
+	}
+}
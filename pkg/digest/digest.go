@@ -0,0 +1,250 @@
+// Package digest renders email digests of new documents grouped by meeting type and date and sends them over
+// SMTP or writes them to .eml files.
+package digest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/feed"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// Section is the meetings of one type in a digest.
+type Section struct {
+	Type     scraper.MeetingType
+	Meetings []scraper.Meeting
+}
+
+// Digest is a set of new documents grouped by meeting type, then by meeting date.
+type Digest struct {
+	Subject  string
+	Since    time.Time
+	Count    int
+	Sections []Section
+}
+
+// New groups docs into a Digest. Sections follow the order of scraper.MeetingTypes, then any other meeting types,
+// such as Unknown, in the order they first appear; meetings are in date order.
+func New(docs []scraper.Document, since time.Time) Digest {
+	d := Digest{Since: since, Count: len(docs)}
+	meetings := scraper.GroupMeetings(docs)
+	for _, mt := range feed.MeetingTypes(docs) {
+		s := Section{Type: mt}
+		for _, m := range meetings {
+			if m.Type.Code == mt.Code {
+				s.Meetings = append(s.Meetings, m)
+			}
+		}
+		if len(s.Meetings) > 0 {
+			d.Sections = append(d.Sections, s)
+		}
+	}
+
+	noun := "documents"
+	if d.Count == 1 {
+		noun = "document"
+	}
+	d.Subject = fmt.Sprintf("Council documents: %d new %s", d.Count, noun)
+	return d
+}
+
+var funcs = map[string]any{
+	"date": func(t time.Time) string { return t.Format("Monday, January 2, 2006") },
+}
+
+var textTemplate = template.Must(template.New("text").Funcs(funcs).Parse(`{{.Subject}}
+{{- if not .Since.IsZero}}
+Documents first published since {{date .Since}}.
+{{- end}}
+{{range .Sections}}
+== {{.Type.Name}} ==
+{{range .Meetings}}
+{{date .Date}}{{if .Title}} - {{.Title}}{{end}}
+{{range .Documents}}  * {{.Name}}
+    {{.Link}}
+{{end}}{{end}}{{end}}`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body>
+<h1>{{.Subject}}</h1>
+{{- if not .Since.IsZero}}
+<p>Documents first published since {{date .Since}}.</p>
+{{- end}}
+{{- range .Sections}}
+<h2>{{.Type.Name}}</h2>
+{{- range .Meetings}}
+<h3>{{date .Date}}{{if .Title}} &ndash; {{.Title}}{{end}}</h3>
+<ul>
+{{- range .Documents}}
+<li><a href="{{.Link}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// Text renders the plain-text body.
+func (d Digest) Text() (string, error) {
+	var buf bytes.Buffer
+	if err := textTemplate.Execute(&buf, d); err != nil {
+		return "", fmt.Errorf("digest: render text: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// HTML renders the HTML body.
+func (d Digest) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, d); err != nil {
+		return "", fmt.Errorf("digest: render html: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Message is an email with plain-text and HTML alternatives.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+	Date    time.Time
+}
+
+// Message renders the digest as an email.
+func (d Digest) Message(from string, to []string, now time.Time) (Message, error) {
+	text, err := d.Text()
+	if err != nil {
+		return Message{}, err
+	}
+	html, err := d.HTML()
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{From: from, To: to, Subject: d.Subject, Text: text, HTML: html, Date: now}, nil
+}
+
+// Bytes encodes the message as a multipart/alternative MIME message with CRLF line endings.
+func (m Message) Bytes() ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(crlf(part.content))); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	domain := "localhost"
+	if i := strings.LastIndex(m.From, "@"); i >= 0 {
+		domain = strings.Trim(m.From[i+1:], "> ")
+	}
+
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", encodeHeader(m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", randomID(), domain))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// WriteEML writes the message to a timestamped .eml file in dir and returns its path.
+func WriteEML(dir string, m Message) (string, error) {
+	data, err := m.Bytes()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	path := filepath.Join(dir, "digest-"+date.UTC().Format("20060102T150405Z")+".eml")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// NewSince returns the documents first seen after since, in date order.
+func NewSince(docs []scraper.Document, firstSeen map[string]time.Time, since time.Time) []scraper.Document {
+	out := make([]scraper.Document, 0)
+	for _, doc := range docs {
+		id := doc.ID
+		if id == "" {
+			id = scraper.DocumentID(doc.Link)
+		}
+		if seen, ok := firstSeen[id]; ok && seen.After(since) {
+			out = append(out, doc)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b scraper.Document) int { return a.Date.Compare(b.Date) })
+	return out
+}
+
+// encodeHeader encodes non-ASCII header values as RFC 2047 words.
+func encodeHeader(s string) string {
+	for _, r := range s {
+		if r > 127 {
+			return mime.QEncoding.Encode("utf-8", s)
+		}
+	}
+	return s
+}
+
+// crlf normalises line endings to CRLF.
+func crlf(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
+
+func randomID() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
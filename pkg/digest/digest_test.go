@@ -0,0 +1,247 @@
+package digest
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+func testDocuments() []scraper.Document {
+	return []scraper.Document{
+		{Name: "minutes.pdf", Link: "https://example.invalid/minutes.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC), RawTitle: "City Council Meeting - Monday, March 4, 2024"},
+		{Name: "agenda.pdf", Link: "https://example.invalid/dhsc.pdf", Meeting: scraper.DHSC, Date: time.Date(2024, time.March, 6, 0, 0, 0, 0, time.UTC)},
+		{Name: "agenda.pdf", Link: "https://example.invalid/agenda.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC)},
+	}
+}
+
+func TestDigest(t *testing.T) {
+	d := New(testDocuments(), time.Time{})
+	if d.Subject != "Council documents: 3 new documents" {
+		t.Fatalf("unexpected subject %q", d.Subject)
+	}
+	if len(d.Sections) != 2 || d.Sections[0].Type.Code != scraper.CC.Code || len(d.Sections[0].Meetings) != 2 {
+		t.Fatalf("unexpected sections: %+v", d.Sections)
+	}
+	if !d.Sections[0].Meetings[0].Date.Before(d.Sections[0].Meetings[1].Date) {
+		t.Fatalf("expected meetings in date order")
+	}
+
+	text, err := d.Text()
+	if err != nil {
+		t.Fatalf("Text returned error: %v", err)
+	}
+	cc := strings.Index(text, "== "+scraper.CC.Name+" ==")
+	dhsc := strings.Index(text, "== "+scraper.DHSC.Name+" ==")
+	if cc < 0 || dhsc < cc || !strings.Contains(text, "https://example.invalid/minutes.pdf") {
+		t.Fatalf("unexpected text:\n%s", text)
+	}
+
+	html, err := d.HTML()
+	if err != nil {
+		t.Fatalf("HTML returned error: %v", err)
+	}
+	if !strings.Contains(html, `<a href="https://example.invalid/dhsc.pdf">agenda.pdf</a>`) || !strings.Contains(html, "Development &amp; Heritage") {
+		t.Fatalf("unexpected html:\n%s", html)
+	}
+}
+
+func TestDigestUnknownMeetingType(t *testing.T) {
+	board := scraper.GetMeetingType("Windsor Police Services Board")
+	if board.Code != "Unknown" {
+		t.Fatalf("test meeting type is %q, want Unknown", board.Code)
+	}
+	docs := append(testDocuments(), scraper.Document{
+		Name:    "board-agenda.pdf",
+		Link:    "https://example.invalid/board.pdf",
+		Meeting: board,
+		Date:    time.Date(2024, time.March, 7, 0, 0, 0, 0, time.UTC),
+	})
+	d := New(docs, time.Time{})
+	if len(d.Sections) != 3 || d.Sections[2].Type.Code != "Unknown" || len(d.Sections[2].Meetings) != 1 {
+		t.Fatalf("unexpected sections: %+v", d.Sections)
+	}
+	count := 0
+	for _, s := range d.Sections {
+		for _, m := range s.Meetings {
+			count += len(m.Documents)
+		}
+	}
+	if count != d.Count {
+		t.Fatalf("sections list %d documents, subject counts %d", count, d.Count)
+	}
+	text, err := d.Text()
+	if err != nil {
+		t.Fatalf("Text returned error: %v", err)
+	}
+	if !strings.Contains(text, "https://example.invalid/board.pdf") {
+		t.Fatalf("text is missing the Unknown meeting:\n%s", text)
+	}
+}
+
+func TestNewSince(t *testing.T) {
+	docs := testDocuments()
+	cutoff := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	seen := map[string]time.Time{
+		scraper.DocumentID(docs[0].Link): cutoff.Add(time.Hour),
+		scraper.DocumentID(docs[1].Link): cutoff.Add(-time.Hour),
+	}
+	got := NewSince(docs, seen, cutoff)
+	if len(got) != 1 || got[0].Name != "minutes.pdf" {
+		t.Fatalf("unexpected documents: %+v", got)
+	}
+}
+
+// fakeSMTP accepts one session on a local listener and returns the authentication and message it received.
+func fakeSMTP(t *testing.T) (string, <-chan [2]string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	got := make(chan [2]string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+		var auth, data string
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimSpace(line)
+			switch verb := strings.ToUpper(strings.Fields(cmd + " ")[0]); verb {
+			case "EHLO":
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				auth = cmd
+				reply("235 2.7.0 Authentication successful")
+			case "MAIL", "RCPT":
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var sb strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					sb.WriteString(strings.TrimPrefix(l, "."))
+				}
+				data = sb.String()
+				reply("250 OK")
+			case "QUIT":
+				reply("221 Bye")
+				got <- [2]string{auth, data}
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), got
+}
+
+func TestSend(t *testing.T) {
+	addr, got := fakeSMTP(t)
+	m, err := New(testDocuments(), time.Time{}).Message("Civic Code <digest@example.org>", []string{"clerk@example.org"}, time.Now())
+	if err != nil {
+		t.Fatalf("Message returned error: %v", err)
+	}
+	cfg := SMTPConfig{Addr: addr, Username: "user", Password: "pass", TLS: StartTLSOpportunistic}
+	if err := Send(context.Background(), cfg, m); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+
+	var session [2]string
+	select {
+	case session = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("fake SMTP server received no message")
+	}
+	creds, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(session[0], "AUTH PLAIN "))
+	if string(creds) != "\x00user\x00pass" {
+		t.Fatalf("unexpected credentials %q", creds)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(session[1]))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	if msg.Header.Get("Subject") != "Council documents: 3 new documents" {
+		t.Fatalf("unexpected subject %q", msg.Header.Get("Subject"))
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q: %v", msg.Header.Get("Content-Type"), err)
+	}
+	types := make([]string, 0)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		body, _ := io.ReadAll(p)
+		if !strings.Contains(string(body), "minutes.pdf") {
+			t.Fatalf("part %s missing document:\n%s", p.Header.Get("Content-Type"), body)
+		}
+		types = append(types, p.Header.Get("Content-Type"))
+	}
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Fatalf("unexpected parts: %v", types)
+	}
+}
+
+func TestSendRequiresStartTLS(t *testing.T) {
+	addr, _ := fakeSMTP(t)
+	err := Send(context.Background(), SMTPConfig{Addr: addr}, Message{From: "a@example.org", To: []string{"b@example.org"}})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected STARTTLS error, got %v", err)
+	}
+}
+
+func TestWriteEML(t *testing.T) {
+	dir := t.TempDir()
+	m := Message{From: "a@example.org", To: []string{"b@example.org"}, Subject: "Résumé", Text: "hi", HTML: "<p>hi</p>", Date: time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC)}
+	path, err := WriteEML(dir, m)
+	if err != nil {
+		t.Fatalf("WriteEML returned error: %v", err)
+	}
+	if !strings.HasSuffix(path, "digest-20240304T090000Z.eml") {
+		t.Fatalf("unexpected path %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read eml: %v", err)
+	}
+	if !strings.Contains(string(data), "Subject: =?utf-8?q?R=C3=A9sum=C3=A9?=\r\n") {
+		t.Fatalf("unexpected eml:\n%s", data)
+	}
+}
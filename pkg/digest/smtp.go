@@ -0,0 +1,135 @@
+package digest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// TLSMode controls STARTTLS negotiation.
+type TLSMode string
+
+const (
+	// StartTLSRequired fails when the server doesn't offer STARTTLS.
+	StartTLSRequired TLSMode = "required"
+	// StartTLSOpportunistic upgrades the connection when the server offers STARTTLS.
+	StartTLSOpportunistic TLSMode = "opportunistic"
+	// StartTLSDisabled never upgrades the connection.
+	StartTLSDisabled TLSMode = "disabled"
+)
+
+// SMTPConfig configures the mail server a digest is sent through.
+type SMTPConfig struct {
+	// Addr is the host:port of the server.
+	Addr string
+	// Username and Password enable PLAIN authentication when Username is set. net/smtp only sends credentials
+	// over TLS or to localhost.
+	Username string
+	Password string
+	// TLS defaults to StartTLSRequired.
+	TLS TLSMode
+	// TLSConfig overrides the configuration used for STARTTLS.
+	TLSConfig *tls.Config
+	// Timeout for the whole exchange; defaults to one minute.
+	Timeout time.Duration
+}
+
+// Send delivers m through the server configured by cfg.
+func Send(ctx context.Context, cfg SMTPConfig, m Message) error {
+	if len(m.To) == 0 {
+		return errors.New("digest: no recipients")
+	}
+	data, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	if cfg.TLS == "" {
+		cfg.TLS = StartTLSRequired
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("digest: smtp address %q: %w", cfg.Addr, err)
+	}
+
+	dialer := net.Dialer{Timeout: cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("digest: dial %s: %w", cfg.Addr, err)
+	}
+	deadline := time.Now().Add(cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("digest: smtp: %w", err)
+	}
+	defer c.Close()
+
+	if err := startTLS(c, cfg, host); err != nil {
+		return err
+	}
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, host)); err != nil {
+			return fmt.Errorf("digest: smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(addressOf(m.From)); err != nil {
+		return fmt.Errorf("digest: smtp MAIL FROM: %w", err)
+	}
+	for _, to := range m.To {
+		if err := c.Rcpt(addressOf(to)); err != nil {
+			return fmt.Errorf("digest: smtp RCPT TO %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("digest: smtp DATA: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("digest: smtp DATA: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("digest: smtp DATA: %w", err)
+	}
+	return c.Quit()
+}
+
+func startTLS(c *smtp.Client, cfg SMTPConfig, host string) error {
+	if cfg.TLS == StartTLSDisabled {
+		return nil
+	}
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		if cfg.TLS == StartTLSRequired {
+			return fmt.Errorf("digest: %s does not support STARTTLS", cfg.Addr)
+		}
+		return nil
+	}
+	tlsConfig := cfg.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: host}
+	}
+	if err := c.StartTLS(tlsConfig); err != nil {
+		return fmt.Errorf("digest: starttls: %w", err)
+	}
+	return nil
+}
+
+// addressOf returns the bare address of "Name <addr>" forms.
+func addressOf(s string) string {
+	if a, err := mail.ParseAddress(s); err == nil {
+		return a.Address
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package downloader
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// Collision is a file name that documents at different links would have shared, such as "Agenda.pdf" and
+// "agenda (1).pdf" posted for the same meeting, and the names they were given instead.
+type Collision struct {
+	FileName  string              `json:"fileName"`
+	Documents []CollidingDocument `json:"documents"`
+}
+
+// CollidingDocument is one of the documents in a Collision.
+type CollidingDocument struct {
+	ID   string `json:"id,omitempty"`
+	Link string `json:"link"`
+	// FileName is the disambiguated name.
+	FileName string `json:"fileName"`
+}
+
+// ResolveFileNames names each document with name. Documents at different links that would share a name all
+// get a suffix from the hash of their link before the extension, so which document gets which name doesn't
+// depend on the order they are listed in. Documents at the same link keep the shared name. It returns the
+// names, in the order of docs, and the collisions it resolved, sorted by file name.
+func ResolveFileNames(docs []scraper.Document, name func(scraper.Document) string) ([]string, []Collision) {
+	names := make([]string, len(docs))
+	links := make(map[string][]string)
+	for i, doc := range docs {
+		names[i] = name(doc)
+		if names[i] != "" && !slices.Contains(links[names[i]], doc.Link) {
+			links[names[i]] = append(links[names[i]], doc.Link)
+		}
+	}
+
+	collisions := make([]Collision, 0)
+	index := make(map[string]int)
+	for i, doc := range docs {
+		shared := names[i]
+		if len(links[shared]) < 2 {
+			continue
+		}
+		names[i] = disambiguate(shared, doc.Link)
+		c, ok := index[shared]
+		if !ok {
+			c = len(collisions)
+			index[shared] = c
+			collisions = append(collisions, Collision{FileName: shared})
+		}
+		if !slices.ContainsFunc(collisions[c].Documents, func(d CollidingDocument) bool { return d.Link == doc.Link }) {
+			collisions[c].Documents = append(collisions[c].Documents, CollidingDocument{ID: doc.ID, Link: doc.Link, FileName: names[i]})
+		}
+	}
+	slices.SortFunc(collisions, func(a, b Collision) int { return strings.Compare(a.FileName, b.FileName) })
+	return names, collisions
+}
+
+// disambiguate inserts a suffix from the hash of link before the extension of name.
+func disambiguate(name, link string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + scraper.DocumentID(link)[:8] + ext
+}
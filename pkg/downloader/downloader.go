@@ -1,26 +1,156 @@
 package downloader
 
 import (
+	"bufio"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/dntiontk/civic-code/pkg/storage"
 )
 
-var httpClient = http.DefaultClient
+// DefaultUserAgent identifies the downloader to the City's web server.
+const DefaultUserAgent = "civic-code (+https://github.com/dntiontk/civic-code)"
+
+// RetryPolicy controls how failed requests are retried. Network errors and 408, 429 and 5xx responses are
+// retried; other failures are not.
+type RetryPolicy struct {
+	// MaxAttempts includes the first request; 1 disables retries.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry. It doubles for each later retry, up to MaxBackoff. A
+	// Retry-After header, when present, is used instead, still capped at MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Options configures a Downloader. Zero values select the defaults noted on each field.
+type Options struct {
+	// Storage receives the downloaded files. It is required.
+	Storage storage.Storage
+	// Client sends the requests; it defaults to http.DefaultClient.
+	Client *http.Client
+	// UserAgent is sent with every request; it defaults to DefaultUserAgent.
+	UserAgent string
+	// Header holds extra headers sent with every request.
+	Header http.Header
+	// Retry defaults to 3 attempts with a backoff of 1s up to 30s.
+	Retry RetryPolicy
+	// Progress, when set, receives an event for each step of each download.
+	Progress ProgressFunc
+	// FileName returns the storage key for a document; it defaults to DefaultFileName, and TemplateFileName
+	// names documents by a template. An empty name fails the document.
+	FileName func(scraper.Document) string
+	// Concurrency is the number of documents downloaded at once; it defaults to 4.
+	Concurrency int
+	// MaxSize, when positive, fails documents larger than this many bytes.
+	MaxSize int64
+	// Quarantine, when set, is a key prefix such as "quarantine/" under which responses that fail validation
+	// are kept for inspection. Otherwise they are discarded. Either way the document fails.
+	Quarantine string
+	// ReplaceChanged downloads a document whose content no longer matches the checksum it carries and records
+	// the new checksum, instead of failing it with ErrChecksumMismatch. The checksum then only lets an unchanged
+	// file in storage be skipped, so a PDF the City replaces at the same link is picked up.
+	ReplaceChanged bool
+}
+
+// Downloader downloads documents into a storage backend. A Downloader holds no global state, so several with
+// different options can run at once, and it is safe for concurrent use.
+type Downloader struct {
+	opts Options
+}
+
+// New returns a Downloader for opts.
+func New(opts Options) (*Downloader, error) {
+	if opts.Storage == nil {
+		return nil, fmt.Errorf("downloader: no storage configured")
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent
+	}
+	if opts.Retry.MaxAttempts <= 0 {
+		opts.Retry.MaxAttempts = 3
+	}
+	if opts.Retry.MinBackoff <= 0 {
+		opts.Retry.MinBackoff = time.Second
+	}
+	if opts.Retry.MaxBackoff <= 0 {
+		opts.Retry.MaxBackoff = 30 * time.Second
+	}
+	if opts.FileName == nil {
+		opts.FileName = DefaultFileName
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 4
+	}
+	return &Downloader{opts: opts}, nil
+}
+
+// DefaultFileName names a document by scraper's file name schema, falling back to the base name of the
+// document name or link for documents without a date.
+func DefaultFileName(doc scraper.Document) string {
+	doc.ApplyFileNameSchema()
+	return fileNameOrBase(doc)
+}
+
+// TemplateFileName returns an Options.FileName that names documents by t, with the same fallback as
+// DefaultFileName.
+func TemplateFileName(t *scraper.FileNameTemplate) func(scraper.Document) string {
+	return func(doc scraper.Document) string {
+		doc.ApplyFileNameTemplate(t)
+		return fileNameOrBase(doc)
+	}
+}
+
+func fileNameOrBase(doc scraper.Document) string {
+	if doc.FileName != "" {
+		return doc.FileName
+	}
+	for _, name := range []string{doc.Name, doc.Link} {
+		if base := filepath.Base(name); base != "" && base != "." && base != "/" {
+			return base
+		}
+	}
+	return ""
+}
+
+// DownloadDocuments downloads each document concurrently to destDir, computes a checksum and returns the
+// updated slice. It logs each download; use a Downloader for anything else.
+func DownloadDocuments(ctx context.Context, docs []scraper.Document, destDir string, concurrency int) ([]scraper.Document, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return nil, fmt.Errorf("downloader: create destination dir: %w", err)
+	}
+	return DownloadDocumentsTo(ctx, docs, storage.NewLocal(destDir), concurrency)
+}
+
+// DownloadDocumentsTo downloads each document concurrently into store under its file name, computes a checksum
+// and returns the updated slice.
+func DownloadDocumentsTo(ctx context.Context, docs []scraper.Document, store storage.Storage, concurrency int) ([]scraper.Document, error) {
+	d, err := New(Options{Storage: store, Concurrency: concurrency, Progress: LogProgress})
+	if err != nil {
+		return nil, err
+	}
+	return d.Download(ctx, docs)
+}
 
 type task struct {
-	index int
-	doc   scraper.Document
+	index    int
+	doc      scraper.Document
+	fileName string
 }
 
 type result struct {
@@ -29,30 +159,50 @@ type result struct {
 	err   error
 }
 
-// DownloadDocuments downloads each document concurrently, computes a checksum and returns the updated slice.
-func DownloadDocuments(ctx context.Context, docs []scraper.Document, destDir string, concurrency int) ([]scraper.Document, error) {
+// Download downloads each document concurrently, skipping those whose stored copy already has the expected
+// checksum, and returns the slice updated with file names and checksums. Documents that fail are returned
+// unchanged and their errors joined. Documents at different links that FileName gives the same name are
+// renamed as ResolveFileNames describes rather than overwriting each other, with an EventRenamed for each.
+func (d *Downloader) Download(ctx context.Context, docs []scraper.Document) ([]scraper.Document, error) {
 	if len(docs) == 0 {
 		return nil, nil
 	}
-
-	if concurrency < 1 {
-		concurrency = 1
+	em := &emitter{fn: d.opts.Progress}
+	names, collisions := ResolveFileNames(docs, d.opts.FileName)
+	shared := make(map[string]string)
+	for _, c := range collisions {
+		for _, cd := range c.Documents {
+			shared[cd.Link] = c.FileName
+		}
 	}
-
-	if err := os.MkdirAll(destDir, 0o755); err != nil {
-		return nil, fmt.Errorf("downloader: create destination dir: %w", err)
+	for idx, doc := range docs {
+		em.emit(Event{Type: EventQueued, Index: idx, Name: doc.Name, FileName: names[idx], Link: doc.Link})
+		if name, ok := shared[doc.Link]; ok {
+			em.emit(Event{Type: EventRenamed, Index: idx, Name: doc.Name, FileName: names[idx], Link: doc.Link, Collision: name})
+		}
 	}
 
 	tasks := make(chan task)
 	results := make(chan result, len(docs))
 
 	var wg sync.WaitGroup
-	for i := 0; i < concurrency; i++ {
+	for i := 0; i < d.opts.Concurrency; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for t := range tasks {
-				updated, err := downloadOne(ctx, t.doc, destDir)
+				info := &attempt{}
+				updated, err := d.downloadOne(ctx, t.index, t.doc, t.fileName, em, info)
+				if err != nil {
+					err = &DocumentError{
+						Index:       t.index,
+						Document:    updated,
+						Status:      info.status,
+						Attempts:    info.attempts,
+						Quarantined: info.quarantined,
+						Err:         err,
+					}
+				}
 				results <- result{
 					index: t.index,
 					doc:   updated,
@@ -74,9 +224,9 @@ func DownloadDocuments(ctx context.Context, docs []scraper.Document, destDir str
 				results <- result{
 					index: idx,
 					doc:   doc,
-					err:   ctx.Err(),
+					err:   &DocumentError{Index: idx, Document: doc, Err: ctx.Err()},
 				}
-			case tasks <- task{index: idx, doc: doc}:
+			case tasks <- task{index: idx, doc: doc, fileName: names[idx]}:
 			}
 		}
 		close(tasks)
@@ -86,8 +236,10 @@ func DownloadDocuments(ctx context.Context, docs []scraper.Document, destDir str
 	errs := make([]error, 0)
 
 	for res := range results {
-		if res.err != nil {
-			errs = append(errs, fmt.Errorf("downloader: %s: %w", res.doc.Name, res.err))
+		var derr *DocumentError
+		if errors.As(res.err, &derr) {
+			em.emit(Event{Type: EventFailed, Index: res.index, Name: res.doc.Name, FileName: res.doc.FileName, Link: res.doc.Link, Err: derr.Err})
+			errs = append(errs, derr)
 		}
 		updated[res.index] = res.doc
 	}
@@ -99,107 +251,143 @@ func DownloadDocuments(ctx context.Context, docs []scraper.Document, destDir str
 	return updated, nil
 }
 
-func downloadOne(ctx context.Context, doc scraper.Document, destDir string) (scraper.Document, error) {
-	doc.ApplyFileNameSchema()
-	fileName := doc.FileName
-
-	if fileName == "" {
-		base := filepath.Base(doc.Name)
-		if base == "" || base == "." {
-			base = filepath.Base(doc.Link)
-		}
-		if base == "" || base == "." {
-			return doc, fmt.Errorf("missing file name")
-		}
-		fileName = base
-		doc.FileName = fileName
-	}
+// attempt records what happened while downloading one document, for DocumentError.
+type attempt struct {
+	status      int
+	attempts    int
+	quarantined string
+}
 
+func (d *Downloader) downloadOne(ctx context.Context, index int, doc scraper.Document, fileName string, em *emitter, info *attempt) (scraper.Document, error) {
 	if fileName == "" || fileName == "." {
-		return doc, fmt.Errorf("missing file name")
+		return doc, ErrMissingFileName
 	}
+	doc.FileName = fileName
+	store := d.opts.Storage
 
-	destPath := filepath.Join(destDir, fileName)
+	event := Event{Index: index, Name: doc.Name, FileName: fileName, Link: doc.Link}
 
 	if doc.Checksum != "" {
-		if sum, err := checksumForFile(destPath); err == nil {
-			if sum == doc.Checksum {
-				doc.Checksum = sum
-				log.Printf("downloader: %s already exists with matching checksum; skipping download", fileName)
+		if obj, err := store.Stat(ctx, fileName); err == nil {
+			if obj.Checksum == doc.Checksum {
+				event.Type, event.Bytes, event.Total = EventSkipped, obj.Size, obj.Size
+				em.emit(event)
 				return doc, nil
 			}
-		} else if !errors.Is(err, os.ErrNotExist) {
+		} else if !errors.Is(err, fs.ErrNotExist) {
 			return doc, fmt.Errorf("read existing file checksum: %w", err)
 		}
 	}
 
-	log.Printf("downloader: starting download of %s from %s", fileName, doc.Link)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, doc.Link, nil)
-	if err != nil {
-		return doc, fmt.Errorf("create request: %w", err)
-	}
-
-	resp, err := httpClient.Do(req)
+	resp, err := d.get(ctx, doc.Link, event, em, info)
 	if err != nil {
-		return doc, fmt.Errorf("download: %w", err)
+		return doc, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return doc, fmt.Errorf("download: unexpected status %s", resp.Status)
+	if d.opts.MaxSize > 0 && resp.ContentLength > d.opts.MaxSize {
+		return doc, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, resp.ContentLength, d.opts.MaxSize)
 	}
 
-	tempFile, err := os.CreateTemp(destDir, "download-*")
-	if err != nil {
-		return doc, fmt.Errorf("create temp file: %w", err)
-	}
-	defer func() {
-		tempFile.Close()
-		os.Remove(tempFile.Name())
-	}()
-
-	hasher := sha256.New()
-	writer := io.MultiWriter(tempFile, hasher)
-
-	if _, err := io.Copy(writer, resp.Body); err != nil {
-		return doc, fmt.Errorf("copy: %w", err)
+	event.Type, event.Total = EventProgress, resp.ContentLength
+	var body io.Reader = &progressReader{r: resp.Body, em: em, event: event}
+	if d.opts.MaxSize > 0 {
+		body = &sizeLimitReader{r: body, limit: d.opts.MaxSize}
 	}
-
-	if err := tempFile.Sync(); err != nil {
-		return doc, fmt.Errorf("flush temp file: %w", err)
+	br := bufio.NewReaderSize(body, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return doc, fmt.Errorf("download: %w", err)
 	}
-
-	sum := hex.EncodeToString(hasher.Sum(nil))
-
-	if doc.Checksum != "" && doc.Checksum != sum {
-		return doc, fmt.Errorf("checksum mismatch (expected %s, got %s)", doc.Checksum, sum)
+	if err := validateContent(fileName, resp.Header.Get("Content-Type"), head); err != nil {
+		return doc, d.quarantine(ctx, fileName, br, err, info)
 	}
 
-	if err := tempFile.Close(); err != nil {
-		return doc, fmt.Errorf("close temp file: %w", err)
+	expected := doc.Checksum
+	if d.opts.ReplaceChanged {
+		expected = ""
 	}
-
-	if err := os.Rename(tempFile.Name(), destPath); err != nil {
-		return doc, fmt.Errorf("move temp file: %w", err)
+	obj, err := store.Put(ctx, fileName, br, expected)
+	if err != nil {
+		return doc, err
 	}
 
-	doc.Checksum = sum
-	log.Printf("downloader: finished download of %s (checksum %s)", fileName, sum)
+	doc.Checksum = obj.Checksum
+	event.Type, event.Bytes = EventFinished, obj.Size
+	em.emit(event)
 	return doc, nil
 }
 
-func checksumForFile(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
+// quarantine stores the rest of a response that failed validation under the quarantine prefix, when one is
+// configured, and returns the validation error with where the response was kept.
+func (d *Downloader) quarantine(ctx context.Context, fileName string, body io.Reader, invalid error, info *attempt) error {
+	if d.opts.Quarantine == "" {
+		return invalid
+	}
+	key := d.opts.Quarantine + fileName
+	if _, err := d.opts.Storage.Put(ctx, key, body, ""); err != nil {
+		return fmt.Errorf("%w (quarantine failed: %v)", invalid, err)
 	}
-	defer f.Close()
+	info.quarantined = key
+	return fmt.Errorf("%w (quarantined as %s)", invalid, key)
+}
 
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, f); err != nil {
-		return "", err
+// get requests link, retrying as the retry policy allows, and returns a 200 response.
+func (d *Downloader) get(ctx context.Context, link string, event Event, em *emitter, info *attempt) (*http.Response, error) {
+	policy := d.opts.Retry
+	backoff := policy.MinBackoff
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		for k, v := range d.opts.Header {
+			req.Header[k] = v
+		}
+		req.Header.Set("User-Agent", d.opts.UserAgent)
+
+		event.Type = EventStarted
+		em.emit(event)
+		info.attempts = attempt
+		resp, err := d.opts.Client.Do(req)
+		if err == nil {
+			info.status = resp.StatusCode
+		}
+		var wait time.Duration
+		switch {
+		case err != nil:
+			err = fmt.Errorf("download: %w", err)
+		case resp.StatusCode == http.StatusOK:
+			return resp, nil
+		default:
+			resp.Body.Close()
+			err = fmt.Errorf("download: %w", &HTTPStatusError{URL: link, StatusCode: resp.StatusCode, Status: resp.Status})
+			if !retryableStatus(resp.StatusCode) {
+				return nil, err
+			}
+			if s, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && s >= 0 {
+				wait = time.Duration(s) * time.Second
+			}
+		}
+
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = backoff
+			backoff = min(backoff*2, policy.MaxBackoff)
+		}
+		wait = min(wait, policy.MaxBackoff)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
 	}
+}
 
-	return hex.EncodeToString(hasher.Sum(nil)), nil
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
 }
@@ -1,24 +1,31 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/dntiontk/civic-code/pkg/storage"
 )
 
 func TestDownloadDocuments_Success(t *testing.T) {
 	const remoteFileName = "agenda.pdf"
-	const fileBody = "sample-pdf-content"
+	const fileBody = "%PDF-1.4 sample-pdf-content"
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/"+remoteFileName {
@@ -29,10 +36,6 @@ func TestDownloadDocuments_Success(t *testing.T) {
 	}))
 	t.Cleanup(srv.Close)
 
-	origClient := httpClient
-	httpClient = srv.Client()
-	t.Cleanup(func() { httpClient = origClient })
-
 	destDir := t.TempDir()
 	ctx := context.Background()
 
@@ -46,9 +49,9 @@ func TestDownloadDocuments_Success(t *testing.T) {
 
 	docs := []scraper.Document{doc}
 
-	updated, err := DownloadDocuments(ctx, docs, destDir, 2)
+	updated, err := newDownloader(t, destDir, Options{Client: srv.Client()}).Download(ctx, docs)
 	if err != nil {
-		t.Fatalf("DownloadDocuments returned error: %v", err)
+		t.Fatalf("Download returned error: %v", err)
 	}
 
 	if len(updated) != 1 {
@@ -80,13 +83,11 @@ func TestDownloadDocuments_ExistingChecksumSkipsDownload(t *testing.T) {
 	const remoteFileName = "existing.pdf"
 	fileContents := []byte("cached-content")
 
-	origClient := httpClient
-	httpClient = &http.Client{
+	client := &http.Client{
 		Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
 			return nil, errors.New("unexpected network call")
 		}),
 	}
-	t.Cleanup(func() { httpClient = origClient })
 
 	ctx := context.Background()
 	doc := scraper.Document{
@@ -110,9 +111,9 @@ func TestDownloadDocuments_ExistingChecksumSkipsDownload(t *testing.T) {
 		doc,
 	}
 
-	updated, err := DownloadDocuments(ctx, docs, destDir, 1)
+	updated, err := newDownloader(t, destDir, Options{Client: client}).Download(ctx, docs)
 	if err != nil {
-		t.Fatalf("DownloadDocuments returned error: %v", err)
+		t.Fatalf("Download returned error: %v", err)
 	}
 
 	if updated[0].Checksum != expectedChecksum {
@@ -122,17 +123,13 @@ func TestDownloadDocuments_ExistingChecksumSkipsDownload(t *testing.T) {
 
 func TestDownloadDocuments_ChecksumMismatch(t *testing.T) {
 	const remoteFileName = "mismatch.pdf"
-	const fileBody = "remote-content"
+	const fileBody = "%PDF-1.4 remote-content"
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte(fileBody))
 	}))
 	t.Cleanup(srv.Close)
 
-	origClient := httpClient
-	httpClient = srv.Client()
-	t.Cleanup(func() { httpClient = origClient })
-
 	ctx := context.Background()
 	destDir := t.TempDir()
 
@@ -149,11 +146,11 @@ func TestDownloadDocuments_ChecksumMismatch(t *testing.T) {
 		doc,
 	}
 
-	updated, err := DownloadDocuments(ctx, docs, destDir, 2)
+	updated, err := newDownloader(t, destDir, Options{Client: srv.Client()}).Download(ctx, docs)
 	if err == nil {
 		t.Fatalf("expected checksum mismatch error, got nil")
 	}
-	if !strings.Contains(err.Error(), "checksum mismatch") {
+	if !errors.Is(err, ErrChecksumMismatch) || Code(err) != CodeChecksumMismatch {
 		t.Fatalf("expected checksum mismatch error, got %v", err)
 	}
 
@@ -167,6 +164,359 @@ func TestDownloadDocuments_ChecksumMismatch(t *testing.T) {
 	}
 }
 
+func TestDownloadDocuments_ReplaceChanged(t *testing.T) {
+	body := "%PDF-1.4 first version"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	doc := scraper.Document{
+		Link:    srv.URL + "/replaced.pdf",
+		Name:    "replaced.pdf",
+		Meeting: scraper.MeetingType{Code: "CC"},
+		Date:    time.Date(2024, time.April, 8, 0, 0, 0, 0, time.UTC),
+	}
+	doc.ApplyFileNameSchema()
+	checksum := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	first, err := newDownloader(t, t.TempDir(), Options{Client: srv.Client()}).Download(ctx, []scraper.Document{doc})
+	if err != nil || first[0].Checksum != checksum(body) {
+		t.Fatalf("first run = %+v, %v", first, err)
+	}
+
+	// The City replaces the PDF at the same link. A run into storage without the old file, such as an export,
+	// still carries the checksum recorded by the first run.
+	body = "%PDF-1.4 second version"
+	second, err := newDownloader(t, t.TempDir(), Options{Client: srv.Client(), ReplaceChanged: true}).Download(ctx, first)
+	if err != nil {
+		t.Fatalf("second run returned error: %v", err)
+	}
+	if second[0].Checksum != checksum(body) {
+		t.Fatalf("second run checksum = %q, want the new content's %q", second[0].Checksum, checksum(body))
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	big := "%PDF-1.4 " + strings.Repeat("x", 3*progressInterval)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big.pdf":
+			w.Header().Set("Content-Length", strconv.Itoa(len(big)))
+			_, _ = io.WriteString(w, big)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	docs := make([]scraper.Document, 0)
+	for _, name := range []string{"big.pdf", "missing.pdf"} {
+		doc := scraper.Document{
+			Link:    srv.URL + "/" + name,
+			Name:    name,
+			Meeting: scraper.MeetingType{Code: "CC"},
+			Date:    time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC),
+		}
+		doc.ApplyFileNameSchema()
+		docs = append(docs, doc)
+	}
+
+	events := make(map[int][]EventType)
+	var finished Event
+	_, err := newDownloader(t, t.TempDir(), Options{Client: srv.Client(), Progress: func(e Event) {
+		events[e.Index] = append(events[e.Index], e.Type)
+		if e.Type == EventFinished {
+			finished = e
+		}
+	}}).Download(context.Background(), docs)
+	if err == nil {
+		t.Fatalf("expected an error for the missing document")
+	}
+
+	// The number of progress events depends on how the body arrives, but there is at least one.
+	got := fmt.Sprint(events[0])
+	if !strings.HasPrefix(got, "[queued started progress") || !strings.HasSuffix(got, "progress finished]") {
+		t.Fatalf("unexpected events for big.pdf: %s", got)
+	}
+	if finished.Bytes != int64(len(big)) || finished.Total != int64(len(big)) || finished.FileName != docs[0].FileName {
+		t.Fatalf("unexpected finished event: %+v", finished)
+	}
+	if got := fmt.Sprint(events[1]); got != "[queued started failed]" {
+		t.Fatalf("unexpected events for missing.pdf: %s", got)
+	}
+
+	var buf bytes.Buffer
+	JSONProgress(&buf)(Event{Type: EventFailed, Name: "a.pdf", Err: errors.New("boom")})
+	if !strings.Contains(buf.String(), `"type":"failed"`) || !strings.Contains(buf.String(), `"error":"boom"`) {
+		t.Fatalf("unexpected JSON event: %s", buf.String())
+	}
+}
+
+func TestDownloadRetriesAndHeaders(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "test-agent" || r.Header.Get("X-Test") != "yes" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		switch r.URL.Path {
+		case "/flaky.pdf":
+			if attempts.Add(1) < 3 {
+				w.Header().Set("Retry-After", "0")
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = io.WriteString(w, "%PDF-1.4 flaky")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	docs := []scraper.Document{
+		{Link: srv.URL + "/flaky.pdf", Name: "flaky.pdf"},
+		{Link: srv.URL + "/gone.pdf", Name: "gone.pdf"},
+	}
+	d := newDownloader(t, t.TempDir(), Options{
+		Client:    srv.Client(),
+		UserAgent: "test-agent",
+		Header:    http.Header{"X-Test": {"yes"}},
+		Retry:     RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond},
+		FileName:  func(doc scraper.Document) string { return "custom-" + doc.Name },
+	})
+	updated, err := d.Download(context.Background(), docs)
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || strings.Contains(err.Error(), "flaky") {
+		t.Fatalf("expected only gone.pdf to fail, got %v", err)
+	}
+	if attempts.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts.Load())
+	}
+	if updated[0].FileName != "custom-flaky.pdf" || updated[0].Checksum == "" {
+		t.Fatalf("unexpected document: %+v", updated[0])
+	}
+}
+
+func TestDownloadValidation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error.pdf":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = io.WriteString(w, "<!DOCTYPE html><p>Sorry, something went wrong</p>")
+		case "/mislabelled.pdf":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = io.WriteString(w, "PK\x03\x04 not a pdf")
+		case "/huge.pdf":
+			_, _ = io.WriteString(w, "%PDF-1.7 "+strings.Repeat("x", 100))
+		case "/minutes.docx":
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+			_, _ = io.WriteString(w, "PK\x03\x04 word")
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	docs := make([]scraper.Document, 0)
+	for _, name := range []string{"error.pdf", "mislabelled.pdf", "huge.pdf", "minutes.docx"} {
+		docs = append(docs, scraper.Document{Link: srv.URL + "/" + name, Name: name})
+	}
+	dir := t.TempDir()
+	updated, err := newDownloader(t, dir, Options{Client: srv.Client(), MaxSize: 64, Quarantine: "quarantine/"}).Download(context.Background(), docs)
+	if !errors.Is(err, ErrNotPDF) || !errors.Is(err, ErrUnexpectedContent) || !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected content and size errors, got %v", err)
+	}
+	for _, want := range []string{"error.pdf: unexpected content: not a PDF: Content-Type \"text/html", "mislabelled.pdf does not start with a pdf signature", "quarantined as quarantine/error.pdf"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error: %v", want, err)
+		}
+	}
+	if updated[3].Checksum == "" {
+		t.Fatalf("expected the docx to be stored: %+v", updated[3])
+	}
+	if updated[0].Checksum != "" {
+		t.Fatalf("expected no checksum for the rejected document: %+v", updated[0])
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "error.pdf")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("rejected response stored under its own name: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "quarantine", "error.pdf"))
+	if err != nil || !strings.HasPrefix(string(data), "<!DOCTYPE html>") {
+		t.Fatalf("expected quarantined body, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "quarantine", "huge.pdf")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("oversized responses should not be quarantined: %v", err)
+	}
+}
+
+func TestFailureManifest(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky.pdf" && fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/page.pdf" && fail.Load() {
+			_, _ = io.WriteString(w, "<html>error</html>")
+			return
+		}
+		_, _ = io.WriteString(w, "%PDF-1.4 ok")
+	}))
+	t.Cleanup(srv.Close)
+
+	docs := make([]scraper.Document, 0)
+	for _, name := range []string{"ok.pdf", "flaky.pdf", "page.pdf"} {
+		docs = append(docs, scraper.Document{Link: srv.URL + "/" + name, Name: name})
+	}
+	d := newDownloader(t, t.TempDir(), Options{
+		Client:     srv.Client(),
+		Retry:      RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond},
+		Quarantine: "quarantine/",
+	})
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+
+	updated, dlErr := d.Download(context.Background(), docs)
+	failures := Failures(dlErr)
+	if len(failures) != 2 || failures[0].Index != 1 || failures[1].Index != 2 {
+		t.Fatalf("unexpected failures: %v", failures)
+	}
+	if failures[0].Code() != CodeHTTPStatus || failures[0].Status != 503 || failures[0].Attempts != 2 {
+		t.Fatalf("unexpected flaky failure: %+v code %s", failures[0], failures[0].Code())
+	}
+	if failures[1].Code() != CodeNotPDF || failures[1].Quarantined != "quarantine/page.pdf" {
+		t.Fatalf("unexpected page failure: %+v code %s", failures[1], failures[1].Code())
+	}
+
+	path := filepath.Join(t.TempDir(), "failures.json")
+	m := FailureManifest{}
+	m.Update(updated, dlErr, now)
+	if err := m.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	m, err := LoadFailures(path)
+	if err != nil {
+		t.Fatalf("LoadFailures returned error: %v", err)
+	}
+	flaky := m[scraper.DocumentID(srv.URL+"/flaky.pdf")]
+	if len(m) != 2 || flaky.Code != CodeHTTPStatus || flaky.Status != 503 || flaky.Attempts != 2 || !flaky.Time.Equal(now) || flaky.Document.Name != "flaky.pdf" {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+
+	// A second failing run adds to the attempt count; a successful one clears the entries.
+	m.Update(updated, dlErr, now)
+	if got := m[flaky.ID].Attempts; got != 4 {
+		t.Fatalf("expected 4 attempts, got %d", got)
+	}
+	fail.Store(false)
+	retry := m.Documents()
+	retried, err := d.Download(context.Background(), retry)
+	if err != nil {
+		t.Fatalf("retry returned error: %v", err)
+	}
+	m.Update(retried, err, now)
+	if len(m) != 0 {
+		t.Fatalf("expected an empty manifest, got %+v", m)
+	}
+}
+
+func TestCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{fmt.Errorf("download: %w", &HTTPStatusError{StatusCode: 404, Status: "404 Not Found"}), CodeHTTPStatus},
+		{&scraper.ParseError{Title: "Agenda", Err: scraper.ErrNoMeetingDate}, CodeParse},
+		{fmt.Errorf("%w: got HTML", ErrNotPDF), CodeNotPDF},
+		{fmt.Errorf("%w: got HTML", ErrUnexpectedContent), CodeUnexpectedContent},
+		{fmt.Errorf("%w (expected a, got b)", ErrChecksumMismatch), CodeChecksumMismatch},
+		{fmt.Errorf("download: %w", context.DeadlineExceeded), CodeCanceled},
+		{&DocumentError{Err: ErrTooLarge}, CodeTooLarge},
+		{errors.New("boom"), CodeOther},
+	}
+	for _, c := range cases {
+		if got := Code(c.err); got != c.want {
+			t.Errorf("Code(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+}
+
+func TestDownloadFileNameCollisions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("%PDF-1.4 " + r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+
+	date := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	docs := []scraper.Document{
+		{Link: srv.URL + "/Agenda.pdf", Name: "Agenda.pdf", Meeting: scraper.CC, Date: date},
+		{Link: srv.URL + "/agenda%20(1).pdf", Name: "agenda (1).pdf", Meeting: scraper.CC, Date: date},
+		{Link: srv.URL + "/minutes.pdf", Name: "minutes.pdf", Meeting: scraper.CC, Date: date},
+	}
+	// With a template that drops the name, the agenda and its copy collide.
+	name := TemplateFileName(scraper.MustParseFileNameTemplate("{date}-{meeting.code}-{role}{ext}"))
+
+	names, collisions := ResolveFileNames(docs, name)
+	reversed, _ := ResolveFileNames([]scraper.Document{docs[2], docs[1], docs[0]}, name)
+	if names[0] != reversed[2] || names[1] != reversed[1] || names[2] != reversed[0] {
+		t.Fatalf("names depend on order: %q and %q", names, reversed)
+	}
+	want0 := "2024_03_05-CC-agenda-" + scraper.DocumentID(docs[0].Link)[:8] + ".pdf"
+	if names[0] != want0 || names[1] == names[0] || names[2] != "2024_03_05-CC-minutes.pdf" {
+		t.Fatalf("ResolveFileNames => %q", names)
+	}
+	if len(collisions) != 1 || collisions[0].FileName != "2024_03_05-CC-agenda.pdf" || len(collisions[0].Documents) != 2 {
+		t.Fatalf("collisions => %+v", collisions)
+	}
+
+	dir := t.TempDir()
+	renamed := make(map[int]string)
+	progress := func(e Event) {
+		if e.Type == EventRenamed {
+			renamed[e.Index] = e.Collision
+		}
+	}
+	updated, err := newDownloader(t, dir, Options{Client: srv.Client(), FileName: name, Progress: progress}).Download(context.Background(), docs)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	for i, doc := range updated {
+		if doc.FileName != names[i] {
+			t.Fatalf("document %d named %q, want %q", i, doc.FileName, names[i])
+		}
+		data, err := os.ReadFile(filepath.Join(dir, doc.FileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "%PDF-1.4 /" + doc.Name; string(data) != want {
+			t.Fatalf("%s holds %q, want %q", doc.FileName, data, want)
+		}
+	}
+	if want := map[int]string{0: "2024_03_05-CC-agenda.pdf", 1: "2024_03_05-CC-agenda.pdf"}; !maps.Equal(renamed, want) {
+		t.Fatalf("renamed events = %v, want %v", renamed, want)
+	}
+}
+
+func TestNewRequiresStorage(t *testing.T) {
+	if _, err := New(Options{}); err == nil {
+		t.Fatalf("expected an error without storage")
+	}
+}
+
+func newDownloader(t *testing.T, dir string, opts Options) *Downloader {
+	t.Helper()
+	opts.Storage = storage.NewLocal(dir)
+	d, err := New(opts)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	return d
+}
+
 type roundTripperFunc func(*http.Request) (*http.Response, error)
 
 func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -0,0 +1,127 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/dntiontk/civic-code/pkg/storage"
+)
+
+var (
+	// ErrChecksumMismatch is wrapped when a downloaded file doesn't match the checksum recorded for it.
+	ErrChecksumMismatch = storage.ErrChecksumMismatch
+	// ErrUnexpectedContent is wrapped for responses whose Content-Type or leading bytes don't match the kind
+	// of file the document name promises, such as an HTML error page served with status 200 for a PDF.
+	ErrUnexpectedContent = errors.New("unexpected content")
+	// ErrNotPDF is the ErrUnexpectedContent wrapped for documents named .pdf.
+	ErrNotPDF = fmt.Errorf("%w: not a PDF", ErrUnexpectedContent)
+	// ErrTooLarge is wrapped for responses larger than Options.MaxSize.
+	ErrTooLarge = errors.New("response too large")
+	// ErrMissingFileName is wrapped for documents FileName can't name.
+	ErrMissingFileName = errors.New("missing file name")
+)
+
+// HTTPStatusError is wrapped when the server answers a download with a status other than 200 OK.
+type HTTPStatusError = scraper.HTTPStatusError
+
+// Error codes returned by Code, stable for use in JSON output and scripts.
+const (
+	CodeCanceled          = "canceled"
+	CodeHTTPStatus        = "http_status"
+	CodeNetwork           = "network"
+	CodeParse             = "parse"
+	CodeNotPDF            = "not_pdf"
+	CodeUnexpectedContent = "unexpected_content"
+	CodeTooLarge          = "too_large"
+	CodeChecksumMismatch  = "checksum_mismatch"
+	CodeMissingFileName   = "missing_file_name"
+	CodeOther             = "other"
+)
+
+// Code returns the error code for err, one of the Code constants. It covers the scraper's errors as well as
+// the downloader's.
+func Code(err error) string {
+	var (
+		statusErr *HTTPStatusError
+		parseErr  *scraper.ParseError
+		netErr    net.Error
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return CodeCanceled
+	case errors.Is(err, ErrNotPDF):
+		return CodeNotPDF
+	case errors.Is(err, ErrUnexpectedContent):
+		return CodeUnexpectedContent
+	case errors.Is(err, ErrTooLarge):
+		return CodeTooLarge
+	case errors.Is(err, ErrChecksumMismatch):
+		return CodeChecksumMismatch
+	case errors.Is(err, ErrMissingFileName):
+		return CodeMissingFileName
+	case errors.As(err, &statusErr):
+		return CodeHTTPStatus
+	case errors.As(err, &parseErr):
+		return CodeParse
+	case errors.As(err, &netErr):
+		return CodeNetwork
+	}
+	return CodeOther
+}
+
+// DocumentError is the error for one document that could not be downloaded. Download joins one per failed
+// document; Failures recovers them.
+type DocumentError struct {
+	// Index is the position of the document in the slice passed to Download.
+	Index    int
+	Document scraper.Document
+	// Status is the HTTP status of the last response, or zero when none was received.
+	Status int
+	// Attempts is the number of requests made.
+	Attempts int
+	// Quarantined is the storage key the response was kept under, if it was quarantined.
+	Quarantined string
+	Err         error
+}
+
+func (e *DocumentError) Error() string {
+	return fmt.Sprintf("downloader: %s: %v", e.Document.Name, e.Err)
+}
+
+func (e *DocumentError) Unwrap() error {
+	return e.Err
+}
+
+// Code returns the error code of the failure.
+func (e *DocumentError) Code() string {
+	return Code(e.Err)
+}
+
+// Failures returns the DocumentErrors in an error returned by Download, in document order.
+func Failures(err error) []*DocumentError {
+	out := make([]*DocumentError, 0)
+	var walk func(error)
+	walk = func(err error) {
+		var derr *DocumentError
+		switch e := err.(type) {
+		case nil:
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				walk(inner)
+			}
+		default:
+			if errors.As(err, &derr) {
+				out = append(out, derr)
+			}
+		}
+	}
+	walk(err)
+	slices.SortFunc(out, func(a, b *DocumentError) int { return a.Index - b.Index })
+	return out
+}
@@ -0,0 +1,121 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// Failure is one document that could not be downloaded, as kept in a failures manifest.
+type Failure struct {
+	ID     string `json:"id"`
+	Link   string `json:"link"`
+	Status int    `json:"status,omitempty"`
+	Code   string `json:"code"`
+	Error  string `json:"error"`
+	// Attempts counts requests across every run that failed on the document.
+	Attempts    int       `json:"attempts"`
+	Time        time.Time `json:"time"`
+	Quarantined string    `json:"quarantined,omitempty"`
+	// Document is the listing entry, kept so the download can be retried without scraping.
+	Document scraper.Document `json:"document"`
+}
+
+// FailureManifest records the documents whose last download failed, keyed by document ID.
+type FailureManifest map[string]Failure
+
+// LoadFailures reads a FailureManifest from path. A missing file returns an empty manifest.
+func LoadFailures(path string) (FailureManifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return FailureManifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Failure
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("downloader: decode %s: %w", path, err)
+	}
+	m := make(FailureManifest, len(list))
+	for _, f := range list {
+		m[f.ID] = f
+	}
+	return m, nil
+}
+
+// Save writes the manifest to path as a JSON array ordered by ID, replacing the file atomically.
+func (m FailureManifest) Save(path string) error {
+	data, err := json.MarshalIndent(m.List(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// List returns the failures ordered by ID.
+func (m FailureManifest) List() []Failure {
+	list := make([]Failure, 0, len(m))
+	for _, f := range m {
+		list = append(list, f)
+	}
+	slices.SortFunc(list, func(a, b Failure) int { return strings.Compare(a.ID, b.ID) })
+	return list
+}
+
+// Documents returns the listing entries of the failed documents, ordered by ID. Each carries its manifest ID,
+// so Update matches them to their entries.
+func (m FailureManifest) Documents() []scraper.Document {
+	docs := make([]scraper.Document, 0, len(m))
+	for _, f := range m.List() {
+		doc := f.Document
+		doc.ID = f.ID
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// Update records the outcome of a Download of docs that returned err: failed documents are added or updated,
+// and documents that were downloaded are removed.
+func (m FailureManifest) Update(docs []scraper.Document, err error, now time.Time) {
+	failed := make(map[int]*DocumentError)
+	for _, derr := range Failures(err) {
+		failed[derr.Index] = derr
+	}
+	for i, doc := range docs {
+		id := failureID(doc)
+		derr, ok := failed[i]
+		if !ok {
+			delete(m, id)
+			continue
+		}
+		m[id] = Failure{
+			ID:          id,
+			Link:        doc.Link,
+			Status:      derr.Status,
+			Code:        derr.Code(),
+			Error:       derr.Err.Error(),
+			Attempts:    m[id].Attempts + derr.Attempts,
+			Time:        now.UTC(),
+			Quarantined: derr.Quarantined,
+			Document:    derr.Document,
+		}
+	}
+}
+
+func failureID(doc scraper.Document) string {
+	if doc.ID != "" {
+		return doc.ID
+	}
+	return scraper.DocumentID(doc.Link)
+}
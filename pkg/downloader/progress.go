@@ -0,0 +1,126 @@
+package downloader
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// EventType identifies a step in the life of a download.
+type EventType string
+
+const (
+	// EventQueued is sent for every document before any download starts.
+	EventQueued EventType = "queued"
+	// EventRenamed is sent after EventQueued for a document whose file name got a suffix because documents at
+	// other links would have shared it; Collision is the shared name.
+	EventRenamed EventType = "renamed"
+	// EventStarted is sent when the request for a document is made.
+	EventStarted EventType = "started"
+	// EventProgress is sent as the body of a document is received.
+	EventProgress EventType = "progress"
+	// EventSkipped is sent when the stored copy already has the expected checksum.
+	EventSkipped EventType = "skipped"
+	// EventFinished is sent when a document has been stored.
+	EventFinished EventType = "finished"
+	// EventFailed is sent when a document could not be downloaded or stored.
+	EventFailed EventType = "failed"
+)
+
+// progressInterval is how many bytes are received between EventProgress events for one document.
+const progressInterval = 256 << 10
+
+// Event describes the progress of one document. Index is the position of the document in the slice being
+// downloaded. Bytes is the number of bytes received so far and Total the expected size, or -1 when the
+// server did not say.
+type Event struct {
+	Type     EventType `json:"type"`
+	Time     time.Time `json:"time"`
+	Index    int       `json:"index"`
+	Name     string    `json:"name"`
+	FileName string    `json:"fileName,omitempty"`
+	Link     string    `json:"link"`
+	Bytes    int64     `json:"bytes,omitempty"`
+	Total    int64     `json:"total,omitempty"`
+	// Collision is the file name an EventRenamed document would have shared.
+	Collision string `json:"collision,omitempty"`
+	Err       error  `json:"-"`
+}
+
+// MarshalJSON adds the error message, if any, as "error".
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	out := struct {
+		event
+		Error string `json:"error,omitempty"`
+	}{event: event(e)}
+	if e.Err != nil {
+		out.Error = e.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// ProgressFunc receives download events. Calls are serialised, so it need not be safe for concurrent use, but
+// it should return quickly since downloads wait on it.
+type ProgressFunc func(Event)
+
+// LogProgress logs the start, skip, finish and failure of each download, as DownloadDocuments always has, and
+// the renaming of colliding file names.
+func LogProgress(e Event) {
+	switch e.Type {
+	case EventRenamed:
+		log.Printf("downloader: documents at other links would be named %s; naming %s %s", e.Collision, e.Link, e.FileName)
+	case EventStarted:
+		log.Printf("downloader: starting download of %s from %s", e.FileName, e.Link)
+	case EventSkipped:
+		log.Printf("downloader: %s already exists with matching checksum; skipping download", e.FileName)
+	case EventFinished:
+		log.Printf("downloader: finished download of %s (%d bytes)", e.FileName, e.Bytes)
+	case EventFailed:
+		log.Printf("downloader: %s failed: %v", e.Name, e.Err)
+	}
+}
+
+// JSONProgress returns a ProgressFunc that writes each event to w as a line of JSON.
+func JSONProgress(w io.Writer) ProgressFunc {
+	enc := json.NewEncoder(w)
+	return func(e Event) {
+		_ = enc.Encode(e)
+	}
+}
+
+// emitter serialises calls to a ProgressFunc and stamps each event.
+type emitter struct {
+	mu sync.Mutex
+	fn ProgressFunc
+}
+
+func (em *emitter) emit(e Event) {
+	if em == nil || em.fn == nil {
+		return
+	}
+	e.Time = time.Now()
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	em.fn(e)
+}
+
+// progressReader counts the bytes read through it and reports them every progressInterval bytes.
+type progressReader struct {
+	r        io.Reader
+	em       *emitter
+	event    Event
+	reported int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.event.Bytes += int64(n)
+	if p.event.Bytes-p.reported >= progressInterval {
+		p.reported = p.event.Bytes
+		p.em.emit(p.event)
+	}
+	return n, err
+}
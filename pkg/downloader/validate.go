@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+)
+
+// sniffLen is how many leading bytes are inspected. PDF readers accept the header anywhere in the first
+// kilobyte, so the checks do too.
+const sniffLen = 1024
+
+// fileKind describes what a file with a given extension should look like.
+type fileKind struct {
+	contentTypes []string
+	signatures   [][]byte
+}
+
+var (
+	oleSignature = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+	zipSignature = []byte("PK\x03\x04")
+)
+
+// kinds maps lower-case file extensions to the expected Content-Types and signatures. Generic binary types
+// are accepted for every kind since many servers send them for attachments.
+var kinds = map[string]fileKind{
+	".pdf":  {[]string{"application/pdf", "application/x-pdf"}, [][]byte{[]byte("%PDF-")}},
+	".doc":  {[]string{"application/msword"}, [][]byte{oleSignature}},
+	".xls":  {[]string{"application/vnd.ms-excel"}, [][]byte{oleSignature}},
+	".ppt":  {[]string{"application/vnd.ms-powerpoint"}, [][]byte{oleSignature}},
+	".docx": {[]string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}, [][]byte{zipSignature}},
+	".xlsx": {[]string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}, [][]byte{zipSignature}},
+	".pptx": {[]string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"}, [][]byte{zipSignature}},
+	".zip":  {[]string{"application/zip", "application/x-zip-compressed"}, [][]byte{zipSignature}},
+	".rtf":  {[]string{"application/rtf", "text/rtf"}, [][]byte{[]byte("{\\rtf")}},
+}
+
+var genericTypes = []string{"", "application/octet-stream", "binary/octet-stream", "application/download", "application/force-download"}
+
+// validateContent checks the Content-Type header and the leading bytes of a response against the kind of file
+// name. Files of unknown kinds are only rejected when they look like HTML.
+func validateContent(name, contentType string, head []byte) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	ext := strings.ToLower(path.Ext(name))
+	kind, known := kinds[ext]
+	sentinel := ErrUnexpectedContent
+	if ext == ".pdf" {
+		sentinel = ErrNotPDF
+	}
+	if !known {
+		if mediaType == "text/html" || looksLikeHTML(head) {
+			return fmt.Errorf("%w: got an HTML page (Content-Type %q)", ErrUnexpectedContent, contentType)
+		}
+		return nil
+	}
+
+	if !slices.Contains(kind.contentTypes, mediaType) && !slices.Contains(genericTypes, mediaType) {
+		return fmt.Errorf("%w: Content-Type %q for %s (starts with %q)", sentinel, contentType, name, preview(head))
+	}
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	for _, sig := range kind.signatures {
+		if bytes.Contains(head, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s does not start with a %s signature (starts with %q)", sentinel, name, strings.TrimPrefix(ext, "."), preview(head))
+}
+
+func looksLikeHTML(head []byte) bool {
+	h := bytes.ToLower(bytes.TrimSpace(head))
+	return bytes.HasPrefix(h, []byte("<!doctype html")) || bytes.HasPrefix(h, []byte("<html"))
+}
+
+// preview returns the first bytes of head for error messages.
+func preview(head []byte) string {
+	const n = 32
+	if len(head) > n {
+		head = head[:n]
+	}
+	return string(head)
+}
+
+// sizeLimitReader returns ErrTooLarge once more than limit bytes have been read.
+type sizeLimitReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.limit {
+		return n, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, l.limit)
+	}
+	return n, err
+}
@@ -0,0 +1,350 @@
+// Package feed renders Atom and RSS feeds of scraped documents.
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// DefaultLimit is the number of entries in a feed when Options.Limit is zero.
+const DefaultLimit = 50
+
+// Options configures a rendered feed.
+type Options struct {
+	// Title of the feed; defaults to a title derived from the meeting type.
+	Title string
+	// BaseURL is the absolute URL the feeds are published under, e.g. "https://example.org/feeds".
+	BaseURL string
+	// MeetingType restricts the feed to one meeting type when its Code is set.
+	MeetingType scraper.MeetingType
+	// FirstSeen orders entries by when they were first observed rather than by meeting date.
+	FirstSeen FirstSeen
+	// Limit caps the number of entries.
+	Limit int
+}
+
+// FirstSeen records when each document ID was first observed.
+type FirstSeen map[string]time.Time
+
+// LoadFirstSeen reads a FirstSeen from path. A missing file returns an empty FirstSeen.
+func LoadFirstSeen(path string) (FirstSeen, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return FirstSeen{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fs := FirstSeen{}
+	if err := json.Unmarshal(data, &fs); err != nil {
+		return nil, fmt.Errorf("feed: decode %s: %w", path, err)
+	}
+	return fs, nil
+}
+
+// Save writes the FirstSeen to path as JSON.
+func (fs FirstSeen) Save(path string) error {
+	data, err := json.MarshalIndent(fs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Observe records now as the first-seen time of documents not seen before. When nothing has been observed
+// yet, documents are recorded at their meeting date so an initial import doesn't appear as brand new.
+func (fs FirstSeen) Observe(docs []scraper.Document, now time.Time) {
+	initial := len(fs) == 0
+	for _, doc := range docs {
+		id := documentID(doc)
+		if _, ok := fs[id]; ok {
+			continue
+		}
+		if initial {
+			fs[id] = doc.Date
+		} else {
+			fs[id] = now
+		}
+	}
+}
+
+func documentID(doc scraper.Document) string {
+	if doc.ID != "" {
+		return doc.ID
+	}
+	return scraper.DocumentID(doc.Link)
+}
+
+// entry is a document with its feed timestamp.
+type entry struct {
+	doc     scraper.Document
+	id      string
+	updated time.Time
+}
+
+// entries filters, orders and limits docs for a feed.
+func entries(docs []scraper.Document, opts Options) []entry {
+	if opts.MeetingType.Code != "" {
+		docs = scraper.ByMeetingType(opts.MeetingType)(docs)
+	}
+	out := make([]entry, 0, len(docs))
+	for _, doc := range docs {
+		e := entry{doc: doc, id: documentID(doc), updated: doc.Date}
+		if seen, ok := opts.FirstSeen[e.id]; ok {
+			e.updated = seen
+		}
+		out = append(out, e)
+	}
+	slices.SortStableFunc(out, func(a, b entry) int {
+		if c := b.updated.Compare(a.updated); c != 0 {
+			return c
+		}
+		// Keep the order of equally timestamped entries stable between runs.
+		return strings.Compare(a.id, b.id)
+	})
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func title(opts Options) string {
+	if opts.Title != "" {
+		return opts.Title
+	}
+	if opts.MeetingType.Code != "" {
+		return "City of Windsor council documents: " + opts.MeetingType.Name
+	}
+	return "City of Windsor council documents"
+}
+
+func entryTitle(doc scraper.Document) string {
+	return fmt.Sprintf("%s, %s: %s", doc.Meeting.Name, doc.Date.Format("January 2, 2006"), doc.Name)
+}
+
+func entrySummary(doc scraper.Document) string {
+	if doc.RawTitle != "" {
+		return doc.RawTitle
+	}
+	return entryTitle(doc)
+}
+
+// EntryID returns the stable feed entry ID of a document, shared by the Atom and RSS feeds.
+func EntryID(doc scraper.Document) string {
+	return "urn:civic-code:document:" + documentID(doc)
+}
+
+// Path returns the feed path, relative to BaseURL, for a meeting type ("" for all documents) and format
+// ("atom" or "rss").
+func Path(code, format string) string {
+	if code == "" {
+		return format + ".xml"
+	}
+	return strings.ToLower(code) + "/" + format + ".xml"
+}
+
+func feedID(opts Options) string {
+	if opts.MeetingType.Code == "" {
+		return "urn:civic-code:feed:all"
+	}
+	return "urn:civic-code:feed:" + strings.ToLower(opts.MeetingType.Code)
+}
+
+func feedURL(opts Options, format string) string {
+	base := strings.TrimSuffix(opts.BaseURL, "/")
+	return base + "/" + Path(opts.MeetingType.Code, format)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string       `xml:"title"`
+	ID        string       `xml:"id"`
+	Updated   string       `xml:"updated"`
+	Published string       `xml:"published"`
+	Link      atomLink     `xml:"link"`
+	Category  atomCategory `xml:"category"`
+	Summary   string       `xml:"summary"`
+}
+
+// Atom renders an Atom 1.0 feed of docs.
+func Atom(docs []scraper.Document, opts Options) ([]byte, error) {
+	items := entries(docs, opts)
+	f := atomFeed{
+		Title:  title(opts),
+		ID:     feedID(opts),
+		Author: atomAuthor{Name: "City of Windsor"},
+		Links: []atomLink{
+			{Href: feedURL(opts, "atom"), Rel: "self", Type: "application/atom+xml"},
+			{Href: scraper.ListingURL, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	var updated time.Time
+	for _, e := range items {
+		if e.updated.After(updated) {
+			updated = e.updated
+		}
+		f.Entries = append(f.Entries, atomEntry{
+			Title:     entryTitle(e.doc),
+			ID:        EntryID(e.doc),
+			Updated:   e.updated.UTC().Format(time.RFC3339),
+			Published: e.doc.Date.UTC().Format(time.RFC3339),
+			Link:      atomLink{Href: e.doc.Link, Type: "application/pdf"},
+			Category:  atomCategory{Term: e.doc.Meeting.Code, Label: e.doc.Meeting.Name},
+			Summary:   entrySummary(e.doc),
+		})
+	}
+	f.Updated = updated.UTC().Format(time.RFC3339)
+	return marshal(f)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Category    string  `xml:"category"`
+	Description string  `xml:"description"`
+}
+
+// RSS renders an RSS 2.0 feed of docs.
+func RSS(docs []scraper.Document, opts Options) ([]byte, error) {
+	items := entries(docs, opts)
+	f := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       title(opts),
+			Link:        scraper.ListingURL,
+			Description: title(opts),
+			Self:        atomLink{Href: feedURL(opts, "rss"), Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	var updated time.Time
+	for _, e := range items {
+		if e.updated.After(updated) {
+			updated = e.updated
+		}
+		f.Channel.Items = append(f.Channel.Items, rssItem{
+			Title:       entryTitle(e.doc),
+			Link:        e.doc.Link,
+			GUID:        rssGUID{Value: EntryID(e.doc)},
+			PubDate:     e.updated.UTC().Format(time.RFC1123Z),
+			Category:    e.doc.Meeting.Name,
+			Description: entrySummary(e.doc),
+		})
+	}
+	if !updated.IsZero() {
+		f.Channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+	return marshal(f)
+}
+
+func marshal(v any) ([]byte, error) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("feed: %w", err)
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// MeetingTypes returns the meeting types that have at least one document, in scraper.MeetingTypes order
+// followed by any others.
+func MeetingTypes(docs []scraper.Document) []scraper.MeetingType {
+	seen := make(map[string]bool)
+	out := make([]scraper.MeetingType, 0)
+	for _, mt := range scraper.MeetingTypes {
+		if len(scraper.ByMeetingType(mt)(docs)) > 0 {
+			seen[mt.Code] = true
+			out = append(out, mt)
+		}
+	}
+	for _, doc := range docs {
+		if !seen[doc.Meeting.Code] {
+			seen[doc.Meeting.Code] = true
+			out = append(out, doc.Meeting)
+		}
+	}
+	return out
+}
+
+// WriteFiles writes the all-documents Atom and RSS feeds and one pair per meeting type under dir, using the
+// layout described by Path.
+func WriteFiles(dir string, docs []scraper.Document, opts Options) error {
+	types := append([]scraper.MeetingType{{}}, MeetingTypes(docs)...)
+	for _, mt := range types {
+		o := opts
+		o.MeetingType = mt
+		for format, render := range map[string]func([]scraper.Document, Options) ([]byte, error){"atom": Atom, "rss": RSS} {
+			data, err := render(docs, o)
+			if err != nil {
+				return err
+			}
+			path := filepath.Join(dir, filepath.FromSlash(Path(mt.Code, format)))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package feed
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+var testDocs = []scraper.Document{
+	{Link: "https://example.invalid/a.pdf", Name: "a.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)},
+	{Link: "https://example.invalid/b.pdf", Name: "b.pdf", Meeting: scraper.DHSC, Date: time.Date(2024, time.February, 7, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestAtom(t *testing.T) {
+	seen := FirstSeen{}
+	seen.Observe(testDocs, time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC))
+	if got := seen[scraper.DocumentID(testDocs[0].Link)]; !got.Equal(testDocs[0].Date) {
+		t.Fatalf("initial observation should use the meeting date, got %v", got)
+	}
+
+	// A document posted later for an earlier meeting sorts first by first-seen time.
+	late := scraper.Document{Link: "https://example.invalid/c.pdf", Name: "c.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.January, 8, 0, 0, 0, 0, time.UTC)}
+	docs := append(testDocs, late)
+	seen.Observe(docs, time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC))
+
+	data, err := Atom(docs, Options{BaseURL: "https://example.org/feeds", FirstSeen: seen})
+	if err != nil {
+		t.Fatalf("Atom returned error: %v", err)
+	}
+	var f atomFeed
+	if err := xml.Unmarshal(data, &f); err != nil {
+		t.Fatalf("decode atom: %v", err)
+	}
+	if len(f.Entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(f.Entries))
+	}
+	if f.Entries[0].ID != EntryID(late) {
+		t.Fatalf("expected newest first-seen entry first, got %q", f.Entries[0].Title)
+	}
+	if f.Links[0].Href != "https://example.org/feeds/atom.xml" {
+		t.Fatalf("unexpected self link %q", f.Links[0].Href)
+	}
+
+	again, err := Atom(docs, Options{BaseURL: "https://example.org/feeds", FirstSeen: seen})
+	if err != nil || string(again) != string(data) {
+		t.Fatalf("expected identical output on re-render")
+	}
+}
+
+func TestRSSByMeetingType(t *testing.T) {
+	data, err := RSS(testDocs, Options{MeetingType: scraper.DHSC, BaseURL: "https://example.org/feeds"})
+	if err != nil {
+		t.Fatalf("RSS returned error: %v", err)
+	}
+	var f rssFeed
+	if err := xml.Unmarshal(data, &f); err != nil {
+		t.Fatalf("decode rss: %v", err)
+	}
+	if len(f.Channel.Items) != 1 || f.Channel.Items[0].GUID.Value != EntryID(testDocs[1]) {
+		t.Fatalf("unexpected items: %+v", f.Channel.Items)
+	}
+	if !strings.Contains(f.Channel.Title, scraper.DHSC.Name) {
+		t.Fatalf("unexpected title %q", f.Channel.Title)
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteFiles(dir, testDocs, Options{}); err != nil {
+		t.Fatalf("WriteFiles returned error: %v", err)
+	}
+	for _, p := range []string{"atom.xml", "rss.xml", "cc/atom.xml", "dhsc/rss.xml"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); err != nil {
+			t.Fatalf("expected %s: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package ical renders council meetings as an iCalendar (RFC 5545) feed.
+package ical
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// TimeZone is the IANA zone calendars are written in unless Options.Location is set.
+const TimeZone = scraper.DefaultTimeZone
+
+// DefaultDuration is the length of a timed meeting event when Options.Duration is zero.
+const DefaultDuration = 2 * time.Hour
+
+// Options configures a rendered calendar.
+type Options struct {
+	// Name of the calendar shown by clients.
+	Name string
+	// Duration of timed events.
+	Duration time.Duration
+	// Location is the time zone timed events are written in; it defaults to scraper.DefaultLocation. Its name
+	// is the TZID, and its rules are written out as a VTIMEZONE.
+	Location *time.Location
+	// Now is used for DTSTAMP; it defaults to the current time.
+	Now time.Time
+}
+
+// UID returns the stable event UID of a meeting, from its date, its start time as written when it has one, and
+// its type, e.g. "20240304-cc@civic-code" or "20240304T1630-cc@civic-code". Meetings of one type on the same day
+// at different times, which scraper.GroupMeetings keeps apart, get different UIDs.
+func UID(m scraper.Meeting) string {
+	code := strings.ToLower(m.Type.Code)
+	if code == "" {
+		code = "unknown"
+	}
+	when := m.Date.Format("20060102")
+	if scraper.HasStartTime(m.Date) {
+		when = m.Date.Format("20060102T1504")
+	}
+	return fmt.Sprintf("%s-%s@civic-code", when, code)
+}
+
+// Calendar renders one VEVENT per meeting. Meetings with a start time become timed events in opts.Location;
+// meetings known only by date become all-day events.
+func Calendar(meetings []scraper.Meeting, opts Options) ([]byte, error) {
+	if opts.Name == "" {
+		opts.Name = "City of Windsor council meetings"
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = DefaultDuration
+	}
+	if opts.Location == nil {
+		opts.Location = scraper.DefaultLocation
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	tzid := opts.Location.String()
+	stamp := opts.Now.UTC().Format("20060102T150405Z")
+
+	w := &writer{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//dntiontk//civic-code//EN")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	w.property("X-WR-CALNAME", opts.Name)
+	w.line("X-WR-TIMEZONE:" + tzid)
+	w.vtimezone(opts.Location, meetings)
+
+	for _, m := range meetings {
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + UID(m))
+		w.line("DTSTAMP:" + stamp)
+		if scraper.HasStartTime(m.Date) {
+			start := m.Date.In(opts.Location)
+			w.line("DTSTART;TZID=" + tzid + ":" + start.Format("20060102T150405"))
+			w.line("DTEND;TZID=" + tzid + ":" + start.Add(opts.Duration).Format("20060102T150405"))
+		} else {
+			// Dates without a time are calendar dates; don't shift them across midnight.
+			day := time.Date(m.Date.Year(), m.Date.Month(), m.Date.Day(), 0, 0, 0, 0, time.UTC)
+			w.line("DTSTART;VALUE=DATE:" + day.Format("20060102"))
+			w.line("DTEND;VALUE=DATE:" + day.AddDate(0, 0, 1).Format("20060102"))
+		}
+		w.property("SUMMARY", m.Type.Name)
+		w.property("DESCRIPTION", description(m))
+		w.property("CATEGORIES", m.Type.Code)
+		if len(m.Documents) > 0 {
+			w.property("URL", m.Documents[0].Link)
+		}
+		w.line("TRANSP:TRANSPARENT")
+		w.line("END:VEVENT")
+	}
+	w.line("END:VCALENDAR")
+	return []byte(w.b.String()), nil
+}
+
+// vtimezone writes a VTIMEZONE for loc covering the years of the timed meetings: the observance in effect at the
+// start of the first year, then one for each change of offset until the end of the last. Nothing is written when
+// no meeting has a start time, since no event refers to the zone.
+func (w *writer) vtimezone(loc *time.Location, meetings []scraper.Meeting) {
+	first, last := 0, 0
+	for _, m := range meetings {
+		if !scraper.HasStartTime(m.Date) {
+			continue
+		}
+		y := m.Date.In(loc).Year()
+		if first == 0 || y < first {
+			first = y
+		}
+		last = max(last, y)
+	}
+	if first == 0 {
+		return
+	}
+
+	observance := func(t time.Time, from int) {
+		name, offset := t.Zone()
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		w.line("BEGIN:" + kind)
+		w.line("TZOFFSETFROM:" + utcOffset(from))
+		w.line("TZOFFSETTO:" + utcOffset(offset))
+		w.property("TZNAME", name)
+		// DTSTART is the local time of the change in the offset that was in effect before it.
+		w.line("DTSTART:" + t.In(time.FixedZone("", from)).Format("20060102T150405"))
+		w.line("END:" + kind)
+	}
+
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+	t := time.Date(first, time.January, 1, 0, 0, 0, 0, loc)
+	end := time.Date(last+1, time.January, 1, 0, 0, 0, 0, loc)
+	_, offset := t.Zone()
+	observance(t, offset)
+	for {
+		_, next := t.ZoneBounds()
+		if next.IsZero() || !next.Before(end) {
+			break
+		}
+		_, offset = t.Zone()
+		observance(next, offset)
+		t = next
+	}
+	w.line("END:VTIMEZONE")
+}
+
+// utcOffset formats an offset in seconds east of UTC as an iCalendar UTC-OFFSET, e.g. "-0500".
+func utcOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+	return s
+}
+
+func description(m scraper.Meeting) string {
+	var b strings.Builder
+	if m.Title != "" {
+		b.WriteString(m.Title)
+		b.WriteString("\n\n")
+	}
+	for _, doc := range m.Documents {
+		fmt.Fprintf(&b, "%s: %s\n", doc.Name, doc.Link)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// writer emits CRLF-terminated content lines folded at 75 octets.
+type writer struct {
+	b strings.Builder
+}
+
+func (w *writer) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		// Don't split a UTF-8 sequence.
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(s[:cut])
+		w.b.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, so they hold one octet less.
+		limit = 74
+	}
+	w.b.WriteString(s)
+	w.b.WriteString("\r\n")
+}
+
+func (w *writer) property(name, value string) {
+	w.line(name + ":" + escape(value))
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,118 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+func TestCalendar(t *testing.T) {
+	toronto, _ := time.LoadLocation(TimeZone)
+	meetings := []scraper.Meeting{
+		{
+			Type:  scraper.CC,
+			Date:  time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC),
+			Title: "City Council Meeting - Monday, March 4, 2024",
+			Documents: []scraper.Document{
+				{Name: "agenda.pdf", Link: "https://example.invalid/agenda.pdf"},
+				{Name: "minutes.pdf", Link: "https://example.invalid/minutes.pdf"},
+			},
+		},
+		{
+			Type: scraper.DHSC,
+			Date: time.Date(2024, time.July, 10, 16, 30, 0, 0, toronto),
+		},
+	}
+
+	data, err := Calendar(meetings, Options{Now: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Calendar returned error: %v", err)
+	}
+	out := string(data)
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"TZID:America/Toronto\r\n",
+		"TZOFFSETTO:-0400\r\nTZNAME:EDT\r\nDTSTART:20240310T020000\r\n",
+		"TZOFFSETTO:-0500\r\nTZNAME:EST\r\nDTSTART:20241103T020000\r\n",
+		"UID:20240304-cc@civic-code\r\n",
+		"DTSTART;VALUE=DATE:20240304\r\n",
+		"DTEND;VALUE=DATE:20240305\r\n",
+		"DTSTAMP:20240301T120000Z\r\n",
+		"UID:20240710T1630-dhsc@civic-code\r\n",
+		"DTSTART;TZID=America/Toronto:20240710T163000\r\n",
+		"DTEND;TZID=America/Toronto:20240710T183000\r\n",
+		"SUMMARY:Development & Heritage Standing Committee\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("calendar missing %q:\n%s", want, out)
+		}
+	}
+
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line not folded: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	if !strings.Contains(unfolded, `DESCRIPTION:City Council Meeting - Monday\, March 4\, 2024\n\nagenda.pdf: https://example.invalid/agenda.pdf\nminutes.pdf`) {
+		t.Fatalf("unexpected description:\n%s", unfolded)
+	}
+}
+
+func TestCalendarLocation(t *testing.T) {
+	for name, tc := range map[string]struct {
+		zone string
+		want []string
+	}{
+		"vancouver": {zone: "America/Vancouver", want: []string{
+			"X-WR-TIMEZONE:America/Vancouver\r\n",
+			"TZID:America/Vancouver\r\n",
+			"TZOFFSETFROM:-0800\r\nTZOFFSETTO:-0700\r\nTZNAME:PDT\r\nDTSTART:20240310T020000\r\n",
+			"DTSTART;TZID=America/Vancouver:20240710T163000\r\n",
+		}},
+		"no daylight saving time": {zone: "America/Regina", want: []string{
+			"BEGIN:STANDARD\r\nTZOFFSETFROM:-0600\r\nTZOFFSETTO:-0600\r\nTZNAME:CST\r\nDTSTART:20240101T000000\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n",
+			"DTSTART;TZID=America/Regina:20240710T163000\r\n",
+		}},
+	} {
+		loc, err := time.LoadLocation(tc.zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meetings := []scraper.Meeting{{Type: scraper.CC, Date: time.Date(2024, time.July, 10, 16, 30, 0, 0, loc)}}
+		data, err := Calendar(meetings, Options{Location: loc})
+		if err != nil {
+			t.Fatalf("%s: Calendar returned error: %v", name, err)
+		}
+		out := string(data)
+		if strings.Contains(out, "America/Toronto") {
+			t.Fatalf("%s: calendar mentions America/Toronto:\n%s", name, out)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Fatalf("%s: calendar missing %q:\n%s", name, want, out)
+			}
+		}
+	}
+}
+
+func TestUIDSameDayMeetings(t *testing.T) {
+	toronto, _ := time.LoadLocation(TimeZone)
+	docs := []scraper.Document{
+		{Link: "https://example.invalid/morning.pdf", Meeting: scraper.Special, Date: time.Date(2024, time.March, 4, 10, 0, 0, 0, toronto)},
+		{Link: "https://example.invalid/evening.pdf", Meeting: scraper.Special, Date: time.Date(2024, time.March, 4, 18, 0, 0, 0, toronto)},
+	}
+	meetings := scraper.GroupMeetings(docs)
+	if len(meetings) != 2 {
+		t.Fatalf("GroupMeetings returned %d meetings, want 2", len(meetings))
+	}
+	if a, b := UID(meetings[0]), UID(meetings[1]); a == b {
+		t.Fatalf("same-day meetings share UID %q", a)
+	}
+	if got, want := UID(meetings[1]), "20240304T1800-special@civic-code"; got != want {
+		t.Fatalf("UID = %q, want %q", got, want)
+	}
+}
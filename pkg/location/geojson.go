@@ -0,0 +1,175 @@
+package location
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// Point is the geocoded position of a civic address.
+type Point struct {
+	Lat  float64
+	Lon  float64
+	Ward int
+}
+
+// AddressPoints maps normalized addresses to their position.
+type AddressPoints map[string]Point
+
+// Lookup returns the position of addr, if known.
+func (ap AddressPoints) Lookup(addr string) (Point, bool) {
+	if ap == nil {
+		return Point{}, false
+	}
+	p, ok := ap[addressKey(NormalizeAddress(addr))]
+	return p, ok
+}
+
+var (
+	addressColumns = []string{"address", "full_address", "fulladdress", "civic_address", "civicaddress"}
+	numberColumns  = []string{"civic_num", "civic_number", "civicnum", "house_number", "number", "civic"}
+	streetColumns  = []string{"street", "street_name", "streetname", "full_street", "fullstreet"}
+	latColumns     = []string{"lat", "latitude", "y"}
+	lonColumns     = []string{"lon", "lng", "long", "longitude", "x"}
+	wardColumns    = []string{"ward", "ward_num", "ward_number"}
+)
+
+// LoadAddressPoints reads an address-point CSV with a header row. The address is taken from an address column,
+// or from civic number and street columns; coordinates from lat/latitude/y and lon/longitude/x columns (WGS84);
+// and, optionally, the ward from a ward column.
+func LoadAddressPoints(r io.Reader) (AddressPoints, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("location: read address points header: %w", err)
+	}
+
+	column := func(names []string) int {
+		for i, h := range header {
+			h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+			if slices.Contains(names, h) {
+				return i
+			}
+		}
+		return -1
+	}
+	addrCol, numCol, streetCol := column(addressColumns), column(numberColumns), column(streetColumns)
+	latCol, lonCol, wardCol := column(latColumns), column(lonColumns), column(wardColumns)
+	if latCol < 0 || lonCol < 0 {
+		return nil, errors.New("location: address points need latitude and longitude columns")
+	}
+	if addrCol < 0 && (numCol < 0 || streetCol < 0) {
+		return nil, errors.New("location: address points need an address column or civic number and street columns")
+	}
+
+	field := func(rec []string, i int) string {
+		if i < 0 || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	points := make(AddressPoints)
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("location: read address points: %w", err)
+		}
+
+		addr := field(rec, addrCol)
+		if addr == "" {
+			addr = field(rec, numCol) + " " + field(rec, streetCol)
+		}
+		lat, err1 := strconv.ParseFloat(field(rec, latCol), 64)
+		lon, err2 := strconv.ParseFloat(field(rec, lonCol), 64)
+		if err1 != nil || err2 != nil || strings.TrimSpace(addr) == "" {
+			continue
+		}
+		ward, _ := strconv.Atoi(field(rec, wardCol))
+		points[addressKey(NormalizeAddress(addr))] = Point{Lat: lat, Lon: lon, Ward: ward}
+	}
+	return points, nil
+}
+
+// FeatureCollection is a GeoJSON FeatureCollection.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON Feature with a Point geometry.
+type Feature struct {
+	Type       string     `json:"type"`
+	Geometry   Geometry   `json:"geometry"`
+	Properties Properties `json:"properties"`
+}
+
+// Geometry is a GeoJSON Point; coordinates are [longitude, latitude].
+type Geometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// Properties describes an address and the documents that mention it.
+type Properties struct {
+	Address   string            `json:"address"`
+	Ward      int               `json:"ward,omitempty"`
+	Documents []FeatureDocument `json:"documents"`
+}
+
+// FeatureDocument is the subset of a Document included in a Feature.
+type FeatureDocument struct {
+	Name    string    `json:"name"`
+	Link    string    `json:"link"`
+	Meeting string    `json:"meeting"`
+	Date    time.Time `json:"date"`
+}
+
+// GeoJSON returns one Point Feature per geocoded address mentioned by docs, listing the documents that mention it.
+// Addresses missing from points are returned separately.
+func GeoJSON(docs []scraper.Document, points AddressPoints) (FeatureCollection, []string) {
+	fc := FeatureCollection{Type: "FeatureCollection", Features: make([]Feature, 0)}
+	byKey := make(map[string]int)
+	missing := make([]string, 0)
+
+	for _, doc := range docs {
+		for _, addr := range doc.Addresses {
+			p, ok := points.Lookup(addr)
+			if !ok {
+				if !slices.Contains(missing, addr) {
+					missing = append(missing, addr)
+				}
+				continue
+			}
+			key := addressKey(addr)
+			i, ok := byKey[key]
+			if !ok {
+				i = len(fc.Features)
+				byKey[key] = i
+				fc.Features = append(fc.Features, Feature{
+					Type:       "Feature",
+					Geometry:   Geometry{Type: "Point", Coordinates: [2]float64{p.Lon, p.Lat}},
+					Properties: Properties{Address: addr, Ward: p.Ward},
+				})
+			}
+			fc.Features[i].Properties.Documents = append(fc.Features[i].Properties.Documents, FeatureDocument{
+				Name:    doc.Name,
+				Link:    doc.Link,
+				Meeting: doc.Meeting.Code,
+				Date:    doc.Date,
+			})
+		}
+	}
+	return fc, missing
+}
@@ -0,0 +1,192 @@
+// Package location extracts civic addresses and ward numbers from document text, tags Documents with them and
+// exports them as GeoJSON.
+package location
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// streetSuffixes maps the spellings of street types found in City documents to their canonical form.
+var streetSuffixes = map[string]string{
+	"street": "Street", "st": "Street",
+	"avenue": "Avenue", "ave": "Avenue", "av": "Avenue",
+	"road": "Road", "rd": "Road",
+	"drive": "Drive", "dr": "Drive",
+	"boulevard": "Boulevard", "blvd": "Boulevard",
+	"crescent": "Crescent", "cres": "Crescent", "cr": "Crescent",
+	"court": "Court", "crt": "Court", "ct": "Court",
+	"lane": "Lane", "ln": "Lane",
+	"place": "Place", "pl": "Place",
+	"way":     "Way",
+	"parkway": "Parkway", "pkwy": "Parkway",
+	"highway": "Highway", "hwy": "Highway",
+	"line":    "Line",
+	"terrace": "Terrace", "terr": "Terrace",
+	"circle": "Circle", "cir": "Circle",
+	"trail": "Trail", "trl": "Trail",
+	"square": "Square", "sq": "Square",
+}
+
+var directions = map[string]string{
+	"east": "East", "e": "East",
+	"west": "West", "w": "West",
+	"north": "North", "n": "North",
+	"south": "South", "s": "South",
+}
+
+var (
+	addressRe = regexp.MustCompile(buildAddressPattern())
+	wardRe    = regexp.MustCompile(`(?i)\bwards?\s*(?:\(s\))?\s*(?:no\.?|#)?\s*:?\s*(\d{1,2}(?:\s*(?:,|and|&)\s*\d{1,2})*)\b`)
+	numberRe  = regexp.MustCompile(`\d{1,2}`)
+)
+
+func buildAddressPattern() string {
+	suffixes := make([]string, 0, len(streetSuffixes))
+	for s := range streetSuffixes {
+		suffixes = append(suffixes, s)
+	}
+	// Longest first so "Street" wins over "St".
+	slices.SortFunc(suffixes, func(a, b string) int { return len(b) - len(a) })
+	return `\b(\d{1,5}[A-Za-z]?)\s+` + // civic number
+		`((?:(?:[A-Z][A-Za-z'’]*\.?|\d{1,3}(?:st|nd|rd|th))\s+){1,4}?)` + // street name words
+		`(?i:(` + strings.Join(suffixes, "|") + `))\.?` + // street type
+		`(?:\s+(?i:(east|west|north|south|[EWNS]))\b)?` + // direction
+		`\b`
+}
+
+// ExtractAddresses returns the distinct normalized civic addresses in text, in order of first appearance.
+func ExtractAddresses(text string) []string {
+	out := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, m := range addressRe.FindAllStringSubmatch(text, -1) {
+		addr := formatAddress(m[1], m[2], m[3], m[4])
+		if key := strings.ToUpper(addr); !seen[key] {
+			seen[key] = true
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// ExtractWards returns the distinct ward numbers mentioned in text in ascending order.
+func ExtractWards(text string) []int {
+	out := make([]int, 0)
+	for _, m := range wardRe.FindAllStringSubmatch(text, -1) {
+		for _, n := range numberRe.FindAllString(m[1], -1) {
+			ward, err := strconv.Atoi(n)
+			if err != nil || ward == 0 {
+				continue
+			}
+			if !slices.Contains(out, ward) {
+				out = append(out, ward)
+			}
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// NormalizeAddress formats an address as "1234 Ouellette Avenue East", or returns the trimmed input
+// when it does not look like a civic address.
+func NormalizeAddress(addr string) string {
+	if m := addressRe.FindStringSubmatch(addr); m != nil {
+		return formatAddress(m[1], m[2], m[3], m[4])
+	}
+	return strings.Join(strings.Fields(addr), " ")
+}
+
+func formatAddress(number, street, suffix, direction string) string {
+	parts := []string{strings.ToUpper(number)}
+	for _, word := range strings.Fields(street) {
+		parts = append(parts, titleCase(word))
+	}
+	if s, ok := streetSuffixes[strings.ToLower(suffix)]; ok {
+		parts = append(parts, s)
+	}
+	if d, ok := directions[strings.ToLower(direction)]; ok {
+		parts = append(parts, d)
+	}
+	return strings.Join(parts, " ")
+}
+
+func titleCase(word string) string {
+	if word == "" {
+		return word
+	}
+	lower := strings.ToLower(word)
+	return strings.ToUpper(lower[:1]) + lower[1:]
+}
+
+// Tag extracts addresses and wards from the text of each page of doc and records them on the Document.
+// When points is non-nil, wards of geocoded addresses are added as well.
+func Tag(doc *scraper.Document, pages []string, points AddressPoints) {
+	addresses := make([]string, 0)
+	wards := make([]int, 0)
+	for _, text := range pages {
+		for _, addr := range ExtractAddresses(text) {
+			if !slices.Contains(addresses, addr) {
+				addresses = append(addresses, addr)
+			}
+		}
+		for _, ward := range ExtractWards(text) {
+			if !slices.Contains(wards, ward) {
+				wards = append(wards, ward)
+			}
+		}
+	}
+	for _, addr := range addresses {
+		if p, ok := points.Lookup(addr); ok && p.Ward != 0 && !slices.Contains(wards, p.Ward) {
+			wards = append(wards, p.Ward)
+		}
+	}
+	slices.Sort(wards)
+	doc.Addresses = addresses
+	doc.Wards = wards
+}
+
+// ByWard returns a FilterFunc for documents tagged with a given ward
+func ByWard(ward int) scraper.FilterFunc {
+	return func(docs []scraper.Document) []scraper.Document {
+		out := make([]scraper.Document, 0)
+		for _, doc := range docs {
+			if slices.Contains(doc.Wards, ward) {
+				out = append(out, doc)
+			}
+		}
+		return out
+	}
+}
+
+// ByAddress returns a FilterFunc for documents with an address containing the given string, ignoring case
+// and street type abbreviations, so "ouellette ave" matches "1234 Ouellette Avenue".
+func ByAddress(str string) scraper.FilterFunc {
+	query := addressKey(str)
+	return func(docs []scraper.Document) []scraper.Document {
+		out := make([]scraper.Document, 0)
+		for _, doc := range docs {
+			for _, addr := range doc.Addresses {
+				if strings.Contains(addressKey(addr), query) {
+					out = append(out, doc)
+					break
+				}
+			}
+		}
+		return out
+	}
+}
+
+// addressKey lower-cases an address and expands street types for comparison.
+func addressKey(addr string) string {
+	words := strings.Fields(strings.ToLower(strings.ReplaceAll(addr, ".", "")))
+	for i, w := range words {
+		if s, ok := streetSuffixes[w]; ok && i > 0 {
+			words[i] = strings.ToLower(s)
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,62 @@
+package location
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+func TestExtractAddresses(t *testing.T) {
+	text := "Rezoning of 1234 OUELLETTE AVE. and 350 City Hall Square W; see also 1234 Ouellette Avenue " +
+		"and 2455 Huron Church Rd for the 2024 Council Meeting."
+
+	got := ExtractAddresses(text)
+	want := []string{"1234 Ouellette Avenue", "350 City Hall Square West", "2455 Huron Church Road"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ExtractAddresses => %q, want %q", got, want)
+	}
+}
+
+func TestExtractWards(t *testing.T) {
+	got := ExtractWards("Ward(s): 3, 4 and 10. Also affects Ward 2 and Ward 3.")
+	want := []int{2, 3, 4, 10}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ExtractWards => %v, want %v", got, want)
+	}
+}
+
+func TestTagAndFilters(t *testing.T) {
+	points, err := LoadAddressPoints(strings.NewReader("CIVIC_NUM,STREET_NAME,LATITUDE,LONGITUDE,WARD\n" +
+		"1234,OUELLETTE AVE,42.3017,-83.0305,4\n"))
+	if err != nil {
+		t.Fatalf("LoadAddressPoints returned error: %v", err)
+	}
+
+	docs := []scraper.Document{{Name: "a.pdf"}, {Name: "b.pdf"}}
+	Tag(&docs[0], []string{"Site plan for 1234 Ouellette Ave.", "Ward 3"}, points)
+	Tag(&docs[1], []string{"Ward 7 update"}, points)
+
+	if !reflect.DeepEqual(docs[0].Wards, []int{3, 4}) {
+		t.Fatalf("unexpected wards: %v", docs[0].Wards)
+	}
+
+	if got := ByWard(4)(docs); len(got) != 1 || got[0].Name != "a.pdf" {
+		t.Fatalf("ByWard(4) => %+v", got)
+	}
+	if got := ByAddress("ouellette ave")(docs); len(got) != 1 || got[0].Name != "a.pdf" {
+		t.Fatalf("ByAddress => %+v", got)
+	}
+
+	fc, missing := GeoJSON(docs, points)
+	if len(missing) != 0 {
+		t.Fatalf("unexpected missing addresses: %v", missing)
+	}
+	if len(fc.Features) != 1 {
+		t.Fatalf("expected 1 feature, got %d", len(fc.Features))
+	}
+	if got := fc.Features[0].Geometry.Coordinates; got != [2]float64{-83.0305, 42.3017} {
+		t.Fatalf("unexpected coordinates: %v", got)
+	}
+}
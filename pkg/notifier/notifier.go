@@ -0,0 +1,433 @@
+// Package notifier delivers document events to webhooks with HMAC-SHA256 signatures, retrying failed deliveries
+// with exponential backoff from a persistent queue.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/dntiontk/civic-code/pkg/watch"
+)
+
+// Headers set on every delivery.
+const (
+	SignatureHeader = "X-Civic-Signature"
+	TimestampHeader = "X-Civic-Timestamp"
+	EventHeader     = "X-Civic-Event"
+	DeliveryHeader  = "X-Civic-Delivery"
+)
+
+// Event is the JSON payload POSTed to endpoints.
+type Event struct {
+	ID       string            `json:"id"`
+	Type     string            `json:"type"`
+	Time     time.Time         `json:"time"`
+	Document scraper.Document  `json:"document"`
+	Previous *scraper.Document `json:"previous,omitempty"`
+}
+
+// Endpoint is a webhook receiver. Deliveries are signed with Secret when it is set.
+type Endpoint struct {
+	URL    string `json:"url"`
+	Secret string `json:"-"`
+}
+
+// Config configures a Notifier.
+type Config struct {
+	Endpoints []Endpoint
+	// QueuePath persists pending deliveries so they survive restarts.
+	QueuePath string
+	// LogPath, when set, receives a JSON line for every delivery attempt.
+	LogPath string
+	// MaxAttempts before a delivery is dropped; defaults to 8.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the delay between attempts; they default to 10s and 1h.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Client sends the requests; it defaults to a client with a 30 second timeout.
+	Client *http.Client
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// delivery is a queued event for one endpoint.
+type delivery struct {
+	ID          string          `json:"id"`
+	URL         string          `json:"url"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// LogEntry is a line of the delivery log.
+type LogEntry struct {
+	Time     time.Time `json:"time"`
+	Delivery string    `json:"delivery"`
+	Event    string    `json:"event"`
+	URL      string    `json:"url"`
+	Attempt  int       `json:"attempt"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Outcome  string    `json:"outcome"`
+	Duration string    `json:"duration"`
+}
+
+// Notifier queues and delivers events.
+type Notifier struct {
+	cfg     Config
+	secrets map[string]string
+
+	mu    sync.Mutex
+	queue []delivery
+	wake  chan struct{}
+}
+
+// New returns a Notifier with pending deliveries loaded from cfg.QueuePath.
+func New(cfg Config) (*Notifier, error) {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 10 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	n := &Notifier{cfg: cfg, secrets: make(map[string]string), wake: make(chan struct{}, 1)}
+	for _, ep := range cfg.Endpoints {
+		n.secrets[ep.URL] = ep.Secret
+	}
+	if cfg.QueuePath == "" {
+		return n, nil
+	}
+	data, err := os.ReadFile(cfg.QueuePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return n, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &n.queue); err != nil {
+		return nil, fmt.Errorf("notifier: decode %s: %w", cfg.QueuePath, err)
+	}
+	n.dropUnconfigured()
+	return n, nil
+}
+
+// dropUnconfigured removes queued deliveries to URLs that are no longer endpoints. Secrets aren't written to
+// the queue, so they could only be sent unsigned.
+func (n *Notifier) dropUnconfigured() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	kept := n.queue[:0]
+	dropped := 0
+	for _, d := range n.queue {
+		if _, ok := n.secrets[d.URL]; ok {
+			kept = append(kept, d)
+			continue
+		}
+		dropped++
+		entry := LogEntry{
+			Time:     n.cfg.Now(),
+			Delivery: d.ID,
+			Event:    d.Event,
+			URL:      d.URL,
+			Attempt:  d.Attempts,
+			Error:    "endpoint no longer configured",
+			Outcome:  "dropped",
+			Duration: "0s",
+		}
+		if err := n.logLocked(entry); err != nil {
+			log.Printf("notifier: write delivery log: %v", err)
+		}
+	}
+	n.queue = kept
+	if dropped == 0 {
+		return
+	}
+	log.Printf("notifier: dropped %d queued deliveries to webhooks that are no longer configured", dropped)
+	if err := n.saveLocked(); err != nil {
+		log.Printf("notifier: save queue: %v", err)
+	}
+}
+
+// Pending returns the number of queued deliveries.
+func (n *Notifier) Pending() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.queue)
+}
+
+// Enqueue queues ev for every endpoint and persists the queue.
+func (n *Notifier) Enqueue(ev Event) error {
+	if ev.ID == "" {
+		ev.ID = newID()
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	now := n.cfg.Now()
+	for _, ep := range n.cfg.Endpoints {
+		n.queue = append(n.queue, delivery{
+			ID:          newID(),
+			URL:         ep.URL,
+			Event:       ev.Type,
+			Payload:     payload,
+			NextAttempt: now,
+		})
+	}
+	err = n.saveLocked()
+	n.mu.Unlock()
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// Action returns a watch.Action that enqueues each watch event as "document.<type>".
+func (n *Notifier) Action() watch.Action {
+	return func(_ context.Context, ev watch.Event) error {
+		return n.Enqueue(Event{
+			Type:     "document." + string(ev.Type),
+			Time:     ev.Time,
+			Document: ev.Document,
+			Previous: ev.Previous,
+		})
+	}
+}
+
+// Run delivers queued events as they become due until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		n.Flush(ctx)
+
+		wait := n.cfg.MaxBackoff
+		n.mu.Lock()
+		now := n.cfg.Now()
+		for _, d := range n.queue {
+			wait = min(wait, max(d.NextAttempt.Sub(now), 0))
+		}
+		n.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-n.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Flush attempts every delivery that is due once.
+func (n *Notifier) Flush(ctx context.Context) {
+	n.mu.Lock()
+	now := n.cfg.Now()
+	due := make([]delivery, 0)
+	for _, d := range n.queue {
+		if !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		n.attempt(ctx, d)
+	}
+}
+
+// attempt sends one delivery and updates the queue with the outcome.
+func (n *Notifier) attempt(ctx context.Context, d delivery) {
+	d.Attempts++
+	start := n.cfg.Now()
+	status, err := n.send(ctx, d)
+	entry := LogEntry{
+		Time:     start,
+		Delivery: d.ID,
+		Event:    d.Event,
+		URL:      d.URL,
+		Attempt:  d.Attempts,
+		Status:   status,
+		Duration: n.cfg.Now().Sub(start).String(),
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	i := n.indexLocked(d.ID)
+	switch {
+	case err == nil:
+		entry.Outcome = "delivered"
+		if i >= 0 {
+			n.queue = append(n.queue[:i], n.queue[i+1:]...)
+		}
+	case !retryable(status) || d.Attempts >= n.cfg.MaxAttempts:
+		entry.Outcome, entry.Error = "failed", err.Error()
+		log.Printf("notifier: giving up on %s to %s after %d attempts: %v", d.Event, d.URL, d.Attempts, err)
+		if i >= 0 {
+			n.queue = append(n.queue[:i], n.queue[i+1:]...)
+		}
+	default:
+		entry.Outcome, entry.Error = "retrying", err.Error()
+		d.LastError = err.Error()
+		d.NextAttempt = n.cfg.Now().Add(n.backoff(d.Attempts))
+		if i >= 0 {
+			n.queue[i] = d
+		}
+	}
+	if err := n.saveLocked(); err != nil {
+		log.Printf("notifier: save queue: %v", err)
+	}
+	if err := n.logLocked(entry); err != nil {
+		log.Printf("notifier: write delivery log: %v", err)
+	}
+}
+
+// send POSTs a delivery and returns the response status.
+func (n *Notifier) send(ctx context.Context, d delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(n.cfg.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "civic-code-notifier")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, d.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	if secret := n.secrets[d.URL]; secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, timestamp, d.Payload))
+	}
+
+	resp, err := n.cfg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether a failed delivery should be retried. Client errors other than timeouts and rate
+// limiting mean the receiver rejected the payload and won't accept it later either.
+func retryable(status int) bool {
+	if status >= 400 && status < 500 {
+		return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// backoff returns the delay before the next attempt.
+func (n *Notifier) backoff(attempts int) time.Duration {
+	d := n.cfg.MinBackoff
+	for i := 1; i < attempts && d < n.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, n.cfg.MaxBackoff)
+}
+
+func (n *Notifier) indexLocked(id string) int {
+	for i, d := range n.queue {
+		if d.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *Notifier) saveLocked() error {
+	if n.cfg.QueuePath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(n.queue, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(n.cfg.QueuePath), 0o755); err != nil {
+		return err
+	}
+	tmp := n.cfg.QueuePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, n.cfg.QueuePath)
+}
+
+func (n *Notifier) logLocked(entry LogEntry) error {
+	if n.cfg.LogPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(n.cfg.LogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Sign returns the signature header value for a payload: "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with secret.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is valid for the payload. Receivers should also reject stale timestamps.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+func newID() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
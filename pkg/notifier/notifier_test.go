@@ -0,0 +1,210 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/dntiontk/civic-code/pkg/watch"
+)
+
+// receiver is an httptest endpoint that verifies signatures and fails the first few requests.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	events   []Event
+	bad      int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if !Verify("s3cret", r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader)) {
+		rc.bad++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(rc.status)
+		return
+	}
+	var ev Event
+	_ = json.Unmarshal(body, &ev)
+	rc.events = append(rc.events, ev)
+}
+
+func TestDelivery(t *testing.T) {
+	dir := t.TempDir()
+	rc := &receiver{failures: 2, status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	now := time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC)
+	cfg := Config{
+		Endpoints:  []Endpoint{{URL: srv.URL, Secret: "s3cret"}},
+		QueuePath:  filepath.Join(dir, "queue.json"),
+		LogPath:    filepath.Join(dir, "deliveries.jsonl"),
+		MinBackoff: time.Minute,
+		Client:     srv.Client(),
+		Now:        func() time.Time { return now },
+	}
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	action := n.Action()
+	ev := watch.Event{Type: watch.Added, Time: now, Document: scraper.Document{ID: "abc", Name: "agenda.pdf"}}
+	if err := action(context.Background(), ev); err != nil {
+		t.Fatalf("action returned error: %v", err)
+	}
+
+	ctx := context.Background()
+	n.Flush(ctx)
+	if n.Pending() != 1 {
+		t.Fatalf("expected failed delivery to stay queued, got %d pending", n.Pending())
+	}
+
+	// The queue survives a restart, and the retry isn't due until the backoff has passed.
+	n, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	n.Flush(ctx)
+	if rc.failures != 1 {
+		t.Fatalf("expected no attempt before the backoff, %d failures left", rc.failures)
+	}
+	now = now.Add(time.Minute)
+	n.Flush(ctx)
+	if n.Pending() != 1 {
+		t.Fatalf("expected delivery to be retried later, got %d pending", n.Pending())
+	}
+	// The second backoff doubles.
+	now = now.Add(time.Minute)
+	n.Flush(ctx)
+	if rc.failures != 0 || len(rc.events) != 0 {
+		t.Fatalf("expected retry to wait for the doubled backoff")
+	}
+	now = now.Add(time.Minute)
+	n.Flush(ctx)
+
+	if n.Pending() != 0 {
+		t.Fatalf("expected queue to be empty, got %d pending", n.Pending())
+	}
+	if rc.bad != 0 {
+		t.Fatalf("receiver rejected %d signatures", rc.bad)
+	}
+	if len(rc.events) != 1 || rc.events[0].Type != "document.added" || rc.events[0].Document.ID != "abc" || rc.events[0].ID == "" {
+		t.Fatalf("unexpected events: %+v", rc.events)
+	}
+
+	f, err := os.Open(cfg.LogPath)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	defer f.Close()
+	outcomes := make([]string, 0)
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var entry LogEntry
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			t.Fatalf("decode log line: %v", err)
+		}
+		outcomes = append(outcomes, entry.Outcome)
+	}
+	if len(outcomes) != 3 || outcomes[0] != "retrying" || outcomes[2] != "delivered" {
+		t.Fatalf("unexpected log outcomes: %v", outcomes)
+	}
+}
+
+func TestDeliveryRejected(t *testing.T) {
+	rc := &receiver{failures: 1, status: http.StatusBadRequest}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	n, err := New(Config{Endpoints: []Endpoint{{URL: srv.URL, Secret: "s3cret"}}, Client: srv.Client()})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := n.Enqueue(Event{Type: "document.removed"}); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	n.Flush(context.Background())
+	if n.Pending() != 0 {
+		t.Fatalf("expected a rejected delivery to be dropped, got %d pending", n.Pending())
+	}
+}
+
+func TestQueueDropsUnconfiguredEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("delivery sent to an endpoint that is no longer configured, signed %q", r.Header.Get(SignatureHeader))
+	}))
+	t.Cleanup(old.Close)
+
+	cfg := Config{
+		Endpoints: []Endpoint{{URL: srv.URL, Secret: "s3cret"}, {URL: old.URL, Secret: "s3cret"}},
+		QueuePath: filepath.Join(dir, "queue.json"),
+		LogPath:   filepath.Join(dir, "deliveries.jsonl"),
+		Client:    srv.Client(),
+	}
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := n.Enqueue(Event{Type: "document.added"}); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+
+	// The old endpoint is removed from the configuration before the queue is delivered.
+	cfg.Endpoints = cfg.Endpoints[:1]
+	n, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if n.Pending() != 1 {
+		t.Fatalf("expected only the configured endpoint's delivery to stay queued, got %d pending", n.Pending())
+	}
+	n.Flush(context.Background())
+	if len(rc.events) != 1 || rc.bad != 0 {
+		t.Fatalf("configured endpoint received %d events, rejected %d signatures", len(rc.events), rc.bad)
+	}
+
+	// The drop is saved and logged.
+	if n, err = New(cfg); err != nil || n.Pending() != 0 {
+		t.Fatalf("reloaded queue has %d pending, err %v", n.Pending(), err)
+	}
+	data, err := os.ReadFile(cfg.LogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"outcome":"dropped"`) {
+		t.Fatalf("delivery log has no dropped entry:\n%s", data)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"document.added"}`)
+	sig := Sign("key", "1700000000", body)
+	if !Verify("key", "1700000000", body, sig) {
+		t.Fatalf("expected signature to verify")
+	}
+	if Verify("key", "1700000001", body, sig) || Verify("other", "1700000000", body, sig) {
+		t.Fatalf("expected signature to fail for a different timestamp or key")
+	}
+}
@@ -0,0 +1,210 @@
+package pdftext
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// cmap maps character codes shown by a font to Unicode text.
+type cmap struct {
+	// widths lists the code lengths, in bytes, declared by codespacerange.
+	widths  []int
+	twoByte bool
+	chars   map[string]string
+}
+
+// parseCMap reads the bfchar and bfrange sections of a ToUnicode CMap.
+func parseCMap(data []byte) *cmap {
+	cm := &cmap{chars: make(map[string]string)}
+	l := &lexer{data: data}
+	var operands []any
+	mode := ""
+	for {
+		tok, ok := l.next()
+		if !ok {
+			break
+		}
+		kw, isKw := tok.(keyword)
+		if !isKw || kw == "[" || kw == "<<" {
+			v, _ := l.complete(tok)
+			if mode == "" {
+				operands = append(operands[:0], v)
+				continue
+			}
+			operands = append(operands, v)
+			switch mode {
+			case "codespace":
+				if len(operands) == 2 {
+					if lo, ok := operands[0].([]byte); ok && len(lo) > 0 {
+						cm.addWidth(len(lo))
+					}
+					operands = operands[:0]
+				}
+			case "bfchar":
+				if len(operands) == 2 {
+					src, _ := operands[0].([]byte)
+					dst, _ := operands[1].([]byte)
+					if len(src) > 0 {
+						cm.chars[string(src)] = utf16BE(dst)
+						cm.addWidth(len(src))
+					}
+					operands = operands[:0]
+				}
+			case "bfrange":
+				if len(operands) == 3 {
+					cm.addRange(operands[0], operands[1], operands[2])
+					operands = operands[:0]
+				}
+			}
+			continue
+		}
+
+		switch kw {
+		case "begincodespacerange":
+			mode = "codespace"
+		case "beginbfchar":
+			mode = "bfchar"
+		case "beginbfrange":
+			mode = "bfrange"
+		case "endcodespacerange", "endbfchar", "endbfrange":
+			mode = ""
+		}
+		operands = operands[:0]
+	}
+	if len(cm.chars) == 0 {
+		return nil
+	}
+	return cm
+}
+
+func (cm *cmap) addWidth(n int) {
+	for _, w := range cm.widths {
+		if w == n {
+			return
+		}
+	}
+	cm.widths = append(cm.widths, n)
+}
+
+func (cm *cmap) addRange(loV, hiV, dstV any) {
+	lo, _ := loV.([]byte)
+	hi, _ := hiV.([]byte)
+	if len(lo) == 0 || len(lo) != len(hi) || len(lo) > 4 {
+		return
+	}
+	cm.addWidth(len(lo))
+	start, end := codeValue(lo), codeValue(hi)
+	if end < start || end-start > 0xFFFF {
+		return
+	}
+	for code := start; code <= end; code++ {
+		key := string(codeBytes(code, len(lo)))
+		switch dst := dstV.(type) {
+		case []byte:
+			if len(dst) == 0 {
+				return
+			}
+			// The last byte of the destination is incremented across the range.
+			out := append([]byte(nil), dst...)
+			last := int(out[len(out)-1]) + int(code-start)
+			out[len(out)-1] = byte(last)
+			if last > 0xFF && len(out) >= 2 {
+				out[len(out)-2] += byte(last >> 8)
+			}
+			cm.chars[key] = utf16BE(out)
+		case array:
+			i := int(code - start)
+			if i < len(dst) {
+				if b, ok := dst[i].([]byte); ok {
+					cm.chars[key] = utf16BE(b)
+				}
+			}
+		}
+	}
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) []byte {
+	out := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		out[i] = byte(v)
+		v >>= 8
+	}
+	return out
+}
+
+func utf16BE(b []byte) string {
+	if len(b)%2 == 1 {
+		return string(b)
+	}
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// decode converts the bytes of a shown string to text. A nil cmap uses the standard Latin encoding.
+func (cm *cmap) decode(s []byte) string {
+	if cm == nil {
+		return decodeLatin(s)
+	}
+	if len(cm.chars) == 0 {
+		if cm.twoByte {
+			// Identity-encoded fonts without a ToUnicode map carry glyph ids, not text.
+			return ""
+		}
+		return decodeLatin(s)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for _, w := range cm.widths {
+			if i+w > len(s) {
+				continue
+			}
+			if out, ok := cm.chars[string(s[i:i+w])]; ok {
+				b.WriteString(out)
+				i += w
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			if cm.twoByte {
+				i += 2
+			} else {
+				i++
+			}
+		}
+	}
+	return b.String()
+}
+
+// winAnsi covers the printable characters WinAnsiEncoding places in 0x80-0x9F.
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ',
+	0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“',
+	0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›',
+	0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+func decodeLatin(s []byte) string {
+	var b strings.Builder
+	for _, c := range s {
+		if r, ok := winAnsi[c]; ok {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
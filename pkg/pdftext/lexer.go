@@ -0,0 +1,328 @@
+package pdftext
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// name is a PDF name object such as /Type.
+type name string
+
+// keyword is a bare token: an operator in a content stream or a reserved word such as obj or stream.
+type keyword string
+
+// ref is an indirect object reference.
+type ref struct {
+	num int
+	gen int
+}
+
+// dict is a PDF dictionary.
+type dict map[name]any
+
+// array is a PDF array.
+type array []any
+
+// stream is a PDF stream object with its (still encoded) data.
+type stream struct {
+	dict dict
+	raw  []byte
+}
+
+// lexer tokenizes PDF syntax from a byte slice.
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace advances past whitespace and comments.
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isWhitespace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token. Compound values (arrays and dictionaries) are returned as their
+// opening and closing delimiters so the caller can build them; eof is reported with ok=false.
+func (l *lexer) next() (tok any, ok bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.readName(), true
+	case c == '(':
+		return l.readLiteral(), true
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return keyword("<<"), true
+		}
+		return l.readHex(), true
+	case c == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return keyword(">>"), true
+		}
+		l.pos++
+		return keyword(">"), true
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		return keyword(string(c)), true
+	case c == ')':
+		l.pos++
+		return keyword(")"), true
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.readNumber(), true
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if start == l.pos {
+		l.pos++
+	}
+	switch kw := string(l.data[start:l.pos]); kw {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "null":
+		return nil, true
+	default:
+		return keyword(kw), true
+	}
+}
+
+func (l *lexer) readName() name {
+	l.pos++ // '/'
+	var b []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhitespace(c) || isDelimiter(c) {
+			break
+		}
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return name(b)
+}
+
+func (l *lexer) readNumber() any {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if (c >= '0' && c <= '9') || c == '.' {
+			l.pos++
+			continue
+		}
+		break
+	}
+	s := string(l.data[start:l.pos])
+	if i, err := strconv.Atoi(s); err == nil {
+		return i
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+func (l *lexer) readLiteral() []byte {
+	l.pos++ // '('
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+			b = append(b, c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return b
+			}
+			b = append(b, c)
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'b':
+				b = append(b, '\b')
+			case 'f':
+				b = append(b, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b = append(b, byte(v))
+				} else {
+					b = append(b, e)
+				}
+			}
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+func (l *lexer) readHex() []byte {
+	l.pos++ // '<'
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+	raw := l.data[l.pos : l.pos+end]
+	l.pos += end + 1
+	return decodeHex(raw)
+}
+
+func decodeHex(raw []byte) []byte {
+	digits := make([]byte, 0, len(raw))
+	for _, c := range raw {
+		if isWhitespace(c) {
+			continue
+		}
+		digits = append(digits, c)
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i+1 < len(digits); i += 2 {
+		v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			continue
+		}
+		out = append(out, byte(v))
+	}
+	return out
+}
+
+// readValue reads one complete value, building arrays and dictionaries and folding "num gen R" into a ref.
+func (l *lexer) readValue() (any, bool) {
+	tok, ok := l.next()
+	if !ok {
+		return nil, false
+	}
+	return l.complete(tok)
+}
+
+func (l *lexer) complete(tok any) (any, bool) {
+	switch t := tok.(type) {
+	case keyword:
+		switch t {
+		case "[":
+			arr := array{}
+			for {
+				save := l.pos
+				inner, ok := l.next()
+				if !ok {
+					return arr, true
+				}
+				if kw, isKw := inner.(keyword); isKw && kw == "]" {
+					return arr, true
+				}
+				l.pos = save
+				v, ok := l.readValue()
+				if !ok {
+					return arr, true
+				}
+				arr = append(arr, v)
+			}
+		case "<<":
+			d := dict{}
+			for {
+				key, ok := l.next()
+				if !ok {
+					return d, true
+				}
+				if kw, isKw := key.(keyword); isKw && kw == ">>" {
+					return d, true
+				}
+				k, isName := key.(name)
+				if !isName {
+					continue
+				}
+				v, ok := l.readValue()
+				if !ok {
+					return d, true
+				}
+				d[k] = v
+			}
+		}
+		return t, true
+	case int:
+		save := l.pos
+		if gen, ok := l.next(); ok {
+			if g, isInt := gen.(int); isInt {
+				if r, ok := l.next(); ok {
+					if kw, isKw := r.(keyword); isKw && kw == "R" {
+						return ref{num: t, gen: g}, true
+					}
+				}
+			}
+		}
+		l.pos = save
+		return t, true
+	}
+	return tok, true
+}
@@ -0,0 +1,537 @@
+// Package pdftext extracts plain text from PDF documents, page by page.
+//
+// It is intentionally small: it understands classic and compressed object layouts, Flate, ASCIIHex and
+// ASCII85 streams, ToUnicode character maps and form XObjects, which covers the agendas, reports and
+// minutes the City publishes. Layout is approximated with spaces and newlines.
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// maxFormDepth bounds recursion through nested form XObjects.
+const maxFormDepth = 8
+
+// ReadFile returns the text of each page of the PDF file at path.
+func ReadFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Pages(data)
+}
+
+// Pages returns the text of each page of the PDF in data, in page order.
+func Pages(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\f\r "), []byte("%PDF-")) {
+		return nil, fmt.Errorf("pdftext: missing %%PDF header")
+	}
+	d := &document{
+		data:    data,
+		offsets: make(map[int]int),
+		objects: make(map[int]any),
+		cmaps:   make(map[ref]*cmap),
+	}
+	if err := d.index(); err != nil {
+		return nil, err
+	}
+
+	pages := d.pages()
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("pdftext: no pages found")
+	}
+
+	out := make([]string, 0, len(pages))
+	for _, p := range pages {
+		var b strings.Builder
+		res, _ := d.resolve(p.resources).(dict)
+		for _, content := range d.contents(p.dict) {
+			d.extract(&b, content, res, 0)
+		}
+		out = append(out, normalizeText(b.String()))
+	}
+	return out, nil
+}
+
+// document holds the parsed object table of a PDF.
+type document struct {
+	data    []byte
+	offsets map[int]int // object number -> byte offset of "num gen obj"
+	objects map[int]any // object number -> parsed value
+	trailer []dict
+	cmaps   map[ref]*cmap
+}
+
+var objRe = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+var trailerRe = regexp.MustCompile(`trailer\s*<<`)
+
+// index records the offset of every top-level object and expands object streams. It fails on an object stream
+// whose header can't be read, since the objects stored in it are lost.
+func (d *document) index() error {
+	for _, m := range objRe.FindAllSubmatchIndex(d.data, -1) {
+		if m[0] > 0 && !isWhitespace(d.data[m[0]-1]) && !isDelimiter(d.data[m[0]-1]) {
+			continue
+		}
+		num := atoi(d.data[m[2]:m[3]])
+		// Later definitions win, matching incremental updates.
+		d.offsets[num] = m[1]
+	}
+
+	for _, m := range trailerRe.FindAllIndex(d.data, -1) {
+		l := &lexer{data: d.data, pos: m[1] - 2}
+		if v, ok := l.readValue(); ok {
+			if t, ok := v.(dict); ok {
+				d.trailer = append(d.trailer, t)
+			}
+		}
+	}
+
+	for num := range d.offsets {
+		s, ok := d.object(num).(*stream)
+		if !ok {
+			continue
+		}
+		switch s.dict["Type"] {
+		case name("XRef"):
+			d.trailer = append(d.trailer, s.dict)
+		case name("ObjStm"):
+			if err := d.expandObjectStream(s); err != nil {
+				return fmt.Errorf("pdftext: object stream %d: %w", num, err)
+			}
+		}
+	}
+	return nil
+}
+
+// object parses and caches the object with the given number.
+func (d *document) object(num int) any {
+	if v, ok := d.objects[num]; ok {
+		return v
+	}
+	off, ok := d.offsets[num]
+	if !ok {
+		return nil
+	}
+	// Guard against cycles through indirect /Length values.
+	d.objects[num] = nil
+
+	l := &lexer{data: d.data, pos: off}
+	v, ok := l.readValue()
+	if !ok {
+		return nil
+	}
+	if sd, isDict := v.(dict); isDict {
+		save := l.pos
+		if kw, ok := l.next(); ok && kw == keyword("stream") {
+			v = &stream{dict: sd, raw: d.streamData(sd, l.pos)}
+		} else {
+			l.pos = save
+		}
+	}
+	d.objects[num] = v
+	return v
+}
+
+// streamData returns the raw bytes of a stream whose "stream" keyword ends at pos.
+func (d *document) streamData(sd dict, pos int) []byte {
+	if pos < len(d.data) && d.data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(d.data) && d.data[pos] == '\n' {
+		pos++
+	}
+	if n, ok := d.resolve(sd["Length"]).(int); ok && n >= 0 && pos+n <= len(d.data) {
+		end := pos + n
+		rest := bytes.TrimLeft(d.data[end:min(end+32, len(d.data))], "\x00\t\n\f\r ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			return d.data[pos:end]
+		}
+	}
+	end := bytes.Index(d.data[pos:], []byte("endstream"))
+	if end < 0 {
+		return d.data[pos:]
+	}
+	return bytes.TrimRight(d.data[pos:pos+end], "\r\n")
+}
+
+// expandObjectStream registers the objects stored inside a compressed object stream.
+func (d *document) expandObjectStream(s *stream) error {
+	data, err := d.decode(s)
+	if err != nil {
+		return err
+	}
+	n, _ := d.resolve(s.dict["N"]).(int)
+	first, _ := d.resolve(s.dict["First"]).(int)
+	if first < 0 || first > len(data) {
+		return fmt.Errorf("/First %d outside the %d-byte stream", first, len(data))
+	}
+	header := &lexer{data: data[:first]}
+	for i := 0; i < n; i++ {
+		numTok, ok1 := header.next()
+		offTok, ok2 := header.next()
+		if !ok1 || !ok2 {
+			return nil
+		}
+		num, _ := numTok.(int)
+		off, _ := offTok.(int)
+		if off < 0 {
+			return fmt.Errorf("object %d at negative offset %d", num, off)
+		}
+		if _, direct := d.offsets[num]; direct {
+			continue
+		}
+		if _, seen := d.objects[num]; seen {
+			continue
+		}
+		if first+off >= len(data) {
+			continue
+		}
+		l := &lexer{data: data, pos: first + off}
+		if v, ok := l.readValue(); ok {
+			d.objects[num] = v
+		}
+	}
+	return nil
+}
+
+// resolve follows indirect references.
+func (d *document) resolve(v any) any {
+	for i := 0; i < 32; i++ {
+		r, ok := v.(ref)
+		if !ok {
+			return v
+		}
+		v = d.object(r.num)
+	}
+	return nil
+}
+
+// decode applies the stream's filters and returns the decoded data.
+func (d *document) decode(s *stream) ([]byte, error) {
+	var filters []name
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = []name{f}
+	case array:
+		for _, v := range f {
+			if n, ok := d.resolve(v).(name); ok {
+				filters = append(filters, n)
+			}
+		}
+	}
+
+	data := s.raw
+	for _, f := range filters {
+		switch f {
+		case "FlateDecode", "Fl":
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("pdftext: flate: %w", err)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil && len(out) == 0 {
+				return nil, fmt.Errorf("pdftext: flate: %w", err)
+			}
+			data = out
+		case "ASCIIHexDecode", "AHx":
+			if i := bytes.IndexByte(data, '>'); i >= 0 {
+				data = data[:i]
+			}
+			data = decodeHex(data)
+		case "ASCII85Decode", "A85":
+			data = bytes.TrimSpace(data)
+			data = bytes.TrimPrefix(data, []byte("<~"))
+			if i := bytes.Index(data, []byte("~>")); i >= 0 {
+				data = data[:i]
+			}
+			// Each 'z' decodes to four zero bytes, so the output can be four times the input.
+			out := make([]byte, 4*len(data))
+			n, _, err := ascii85.Decode(out, data, true)
+			if err != nil {
+				return nil, fmt.Errorf("pdftext: ascii85: %w", err)
+			}
+			data = out[:n]
+		default:
+			return nil, fmt.Errorf("pdftext: unsupported filter %s", f)
+		}
+	}
+	return data, nil
+}
+
+// page is a leaf of the page tree with its inherited resources.
+type page struct {
+	dict      dict
+	resources any
+}
+
+// pages walks the page tree from the document catalog.
+func (d *document) pages() []page {
+	var root dict
+	for i := len(d.trailer) - 1; i >= 0 && root == nil; i-- {
+		root, _ = d.resolve(d.trailer[i]["Root"]).(dict)
+	}
+	if root == nil {
+		for num := range d.offsets {
+			if c, ok := d.object(num).(dict); ok && c["Type"] == name("Catalog") {
+				root = c
+				break
+			}
+		}
+	}
+	if root == nil {
+		return nil
+	}
+
+	var out []page
+	seen := make(map[ref]bool)
+	var walk func(node any, resources any, depth int)
+	walk = func(node any, resources any, depth int) {
+		if r, ok := node.(ref); ok {
+			if seen[r] {
+				return
+			}
+			seen[r] = true
+		}
+		n, ok := d.resolve(node).(dict)
+		if !ok || depth > 64 {
+			return
+		}
+		if res, ok := n["Resources"]; ok {
+			resources = res
+		}
+		kids, hasKids := d.resolve(n["Kids"]).(array)
+		if n["Type"] == name("Page") || !hasKids {
+			out = append(out, page{dict: n, resources: resources})
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+	walk(root["Pages"], nil, 0)
+	return out
+}
+
+// contents returns the decoded content streams of a page.
+func (d *document) contents(p dict) [][]byte {
+	var refs []any
+	switch c := d.resolve(p["Contents"]).(type) {
+	case array:
+		refs = c
+	case *stream:
+		refs = []any{c}
+	}
+
+	var out [][]byte
+	for _, r := range refs {
+		s, ok := d.resolve(r).(*stream)
+		if !ok {
+			continue
+		}
+		data, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		out = append(out, data)
+	}
+	// Content arrays may split operators across streams, so join them.
+	if len(out) > 1 {
+		return [][]byte{bytes.Join(out, []byte("\n"))}
+	}
+	return out
+}
+
+// font returns the character map for the named font in resources.
+func (d *document) font(resources dict, fontName name) *cmap {
+	fonts, _ := d.resolve(resources["Font"]).(dict)
+	if fonts == nil {
+		return nil
+	}
+	fontRef, isRef := fonts[fontName].(ref)
+	if isRef {
+		if cm, ok := d.cmaps[fontRef]; ok {
+			return cm
+		}
+	}
+	f, _ := d.resolve(fonts[fontName]).(dict)
+	var cm *cmap
+	if f != nil {
+		if s, ok := d.resolve(f["ToUnicode"]).(*stream); ok {
+			if data, err := d.decode(s); err == nil {
+				cm = parseCMap(data)
+			}
+		}
+		if cm == nil && f["Subtype"] == name("Type0") {
+			cm = &cmap{twoByte: true}
+		}
+	}
+	if isRef {
+		d.cmaps[fontRef] = cm
+	}
+	return cm
+}
+
+// extract runs a content stream and appends the text it shows to b.
+func (d *document) extract(b *strings.Builder, content []byte, resources dict, depth int) {
+	l := &lexer{data: content}
+	var operands []any
+	var current *cmap
+
+	newline := func() {
+		s := b.String()
+		if len(s) > 0 && s[len(s)-1] != '\n' {
+			b.WriteByte('\n')
+		}
+	}
+	space := func() {
+		s := b.String()
+		if len(s) > 0 && s[len(s)-1] != ' ' && s[len(s)-1] != '\n' {
+			b.WriteByte(' ')
+		}
+	}
+	show := func(v any) {
+		if s, ok := v.([]byte); ok {
+			b.WriteString(current.decode(s))
+		}
+	}
+
+	for {
+		tok, ok := l.next()
+		if !ok {
+			return
+		}
+		kw, isKw := tok.(keyword)
+		if !isKw || kw == "[" || kw == "<<" {
+			v, _ := l.complete(tok)
+			operands = append(operands, v)
+			continue
+		}
+
+		switch kw {
+		case "BT", "ET":
+			newline()
+		case "Tf":
+			if len(operands) >= 2 {
+				if fn, ok := operands[len(operands)-2].(name); ok {
+					current = d.font(resources, fn)
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty := number(operands[len(operands)-1]); ty != 0 {
+					newline()
+				} else if tx := number(operands[len(operands)-2]); tx != 0 {
+					space()
+				}
+			}
+		case "Tm", "T*":
+			newline()
+		case "Tj":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "'", "\"":
+			newline()
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			arr, _ := operands[len(operands)-1].(array)
+			for _, v := range arr {
+				if n, isNum := v.(int); isNum && n < -200 {
+					space()
+					continue
+				}
+				if f, isNum := v.(float64); isNum && f < -200 {
+					space()
+					continue
+				}
+				show(v)
+			}
+		case "Do":
+			if depth >= maxFormDepth || len(operands) == 0 {
+				break
+			}
+			xn, _ := operands[len(operands)-1].(name)
+			xobjects, _ := d.resolve(resources["XObject"]).(dict)
+			form, ok := d.resolve(xobjects[xn]).(*stream)
+			if !ok || form.dict["Subtype"] != name("Form") {
+				break
+			}
+			data, err := d.decode(form)
+			if err != nil {
+				break
+			}
+			formRes, _ := d.resolve(form.dict["Resources"]).(dict)
+			if formRes == nil {
+				formRes = resources
+			}
+			d.extract(b, data, formRes, depth+1)
+		case "BI":
+			// Skip inline image data, which is binary and may contain anything.
+			end := bytes.Index(l.data[l.pos:], []byte("EI"))
+			for end >= 0 {
+				at := l.pos + end
+				if at > 0 && isWhitespace(l.data[at-1]) && (at+2 >= len(l.data) || isWhitespace(l.data[at+2])) {
+					l.pos = at + 2
+					break
+				}
+				next := bytes.Index(l.data[at+2:], []byte("EI"))
+				if next < 0 {
+					end = -1
+					break
+				}
+				end = at + 2 + next - l.pos
+			}
+			if end < 0 {
+				return
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func number(v any) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+func atoi(b []byte) int {
+	n := 0
+	for _, c := range b {
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
+
+var (
+	spaceRe   = regexp.MustCompile(`[ \t\f\r]+`)
+	newlineRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// normalizeText collapses runs of whitespace while keeping line breaks.
+func normalizeText(s string) string {
+	s = spaceRe.ReplaceAllString(s, " ")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	s = strings.Join(lines, "\n")
+	s = newlineRe.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,224 @@
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF assembles a minimal PDF from object bodies; object numbers start at 1.
+func buildPDF(objects []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func rawStream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func flateStream(dict, data string) string {
+	compressed := deflate(data)
+	return fmt.Sprintf("<< %s /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", dict, len(compressed), compressed)
+}
+
+func deflate(data string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write([]byte(data))
+	_ = w.Close()
+	return buf.String()
+}
+
+func encodeASCII85(data string) string {
+	out := make([]byte, ascii85.MaxEncodedLen(len(data)))
+	return string(out[:ascii85.Encode(out, []byte(data))]) + "~>"
+}
+
+// onePage returns a one-page PDF whose page shows content, a stream object body, in Helvetica.
+func onePage(content string) []byte {
+	return buildPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		content,
+	})
+}
+
+func TestPages(t *testing.T) {
+	toUnicode := "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"2 beginbfchar <0001> <0043> <0002> <0052> endbfchar\n" +
+		"1 beginbfrange <0010> <0019> <0030> endbfrange\n" +
+		"endcmap CMapName currentdict /CMap defineresource pop end end"
+
+	pdf := buildPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [8 0 R 9 0 R] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Calibri /Encoding /Identity-H /ToUnicode 10 0 R >>",
+		rawStream("", "BT /F1 12 Tf 72 720 Td (Approve By-law 123-2024) Tj 0 -14 Td [(as per )-300(report)] TJ ET"),
+		flateStream("", "BT /F2 12 Tf 72 720 Td <00010002> Tj"),
+		rawStream("", "<0014001500160017> Tj (\\(end\\)) ' ET"),
+		flateStream("", toUnicode),
+	})
+
+	pages, err := Pages(pdf)
+	if err != nil {
+		t.Fatalf("Pages returned error: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %d: %q", len(pages), pages)
+	}
+
+	if want := "Approve By-law 123-2024\nas per report"; pages[0] != want {
+		t.Fatalf("page 1 => %q, want %q", pages[0], want)
+	}
+	if !strings.Contains(pages[1], "CR4567") {
+		t.Fatalf("page 2 => %q, want it to contain %q", pages[1], "CR4567")
+	}
+}
+
+func TestPagesRejectsNonPDF(t *testing.T) {
+	if _, err := Pages([]byte("<html>error</html>")); err == nil {
+		t.Fatalf("expected error for non-PDF input")
+	}
+}
+
+func TestFilters(t *testing.T) {
+	const text = "BT /F1 12 Tf 72 720 Td (Report S 89/2024) Tj ET"
+	// PDF treats NUL as white space; four of them in a row encode as ASCII85's z shorthand.
+	padded := strings.Repeat("\x00", 64) + text
+
+	encoded := encodeASCII85(padded)
+	if !strings.Contains(encoded, "zzzz") {
+		t.Fatalf("test data doesn't use the z shorthand: %q", encoded)
+	}
+	for name, content := range map[string]string{
+		"flate":           flateStream("", text),
+		"ascii hex":       rawStream("/Filter /ASCIIHexDecode", strings.ToUpper(hex.EncodeToString([]byte(text[:20])))+"\n"+hex.EncodeToString([]byte(text[20:]))+">"),
+		"ascii hex odd":   rawStream("/Filter /AHx", hex.EncodeToString([]byte(text))+"2>"),
+		"ascii85":         rawStream("/Filter /ASCII85Decode", "<~"+encodeASCII85(text)),
+		"ascii85 z":       rawStream("/Filter /A85", encoded),
+		"chained filters": rawStream("/Filter [/ASCII85Decode /FlateDecode]", encodeASCII85(deflate(padded))),
+		"wrong length":    strings.Replace(rawStream("", text), fmt.Sprintf("/Length %d", len(text)), "/Length 9999", 1),
+	} {
+		pages, err := Pages(onePage(content))
+		if err != nil {
+			t.Fatalf("%s: Pages returned error: %v", name, err)
+		}
+		if len(pages) != 1 || pages[0] != "Report S 89/2024" {
+			t.Errorf("%s: pages => %q", name, pages)
+		}
+	}
+}
+
+func TestXRefAndObjectStreams(t *testing.T) {
+	// Objects 1 to 4 live in a compressed object stream, and the trailer is a cross-reference stream, as
+	// PDF 1.5 writers produce.
+	inner := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var header, body strings.Builder
+	for i, obj := range inner {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	objStm := flateStream(fmt.Sprintf("/Type /ObjStm /N %d /First %d", len(inner), header.Len()), header.String()+body.String())
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	for i, obj := range []string{
+		flateStream("", "BT /F1 12 Tf (By-law 123-2024) Tj ET"),
+		objStm,
+		rawStream("/Type /XRef /Size 8 /Root 1 0 R /W [1 2 1]", "\x00\x00\x00\x00"),
+	} {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+5, obj)
+	}
+	b.WriteString("startxref\n0\n%%EOF\n")
+
+	pages, err := Pages(b.Bytes())
+	if err != nil {
+		t.Fatalf("Pages returned error: %v", err)
+	}
+	if len(pages) != 1 || pages[0] != "By-law 123-2024" {
+		t.Fatalf("pages => %q", pages)
+	}
+}
+
+func TestMalformedInput(t *testing.T) {
+	for name, content := range map[string]string{
+		"bad flate":          "<< /Filter /FlateDecode /Length 8 >>\nstream\nnot zlib\nendstream",
+		"bad ascii85":        rawStream("/Filter /ASCII85Decode", "vwxyz{|}~>"),
+		"unsupported filter": rawStream("/Filter /JBIG2Decode", "BT (x) Tj ET"),
+		"no endstream":       "<< /Length 5 >>\nstream\nBT (unterminated) Tj",
+		"unbalanced":         rawStream("", "BT /F1 12 Tf [(open) Tj ET"),
+	} {
+		// A broken content stream must not fail the document or stop other pages from being read.
+		pages, err := Pages(onePage(content))
+		if err != nil {
+			t.Errorf("%s: Pages returned error: %v", name, err)
+			continue
+		}
+		if len(pages) != 1 {
+			t.Errorf("%s: pages => %q", name, pages)
+		}
+	}
+
+	// Object streams whose header points outside the stream are refused rather than read out of bounds.
+	for name, objStm := range map[string]string{
+		"negative /First":  rawStream("/Type /ObjStm /N 1 /First -5", "20 0 << /Type /Font >>"),
+		"/First too large": rawStream("/Type /ObjStm /N 1 /First 500", "20 0 << /Type /Font >>"),
+		"negative offset":  rawStream("/Type /ObjStm /N 1 /First 7", "20 -30 << /Type /Font >>"),
+	} {
+		pdf := append(onePage(rawStream("", "BT (x) Tj ET")), "9 0 obj\n"+objStm+"\nendobj\n"...)
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("%s: Pages panicked: %v", name, r)
+				}
+			}()
+			if _, err := Pages(pdf); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}()
+	}
+
+	if _, err := Pages([]byte("%PDF-1.4\n1 0 obj\n<< /Type /Font >>\nendobj\n")); err == nil {
+		t.Errorf("expected an error for a PDF without pages")
+	}
+
+	// Truncated downloads: any prefix of a valid PDF must be handled without panicking.
+	pdf := onePage(flateStream("", "BT /F1 12 Tf (Minutes) Tj ET"))
+	for n := range len(pdf) {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("Pages panicked on the first %d bytes: %v", n, r)
+				}
+			}()
+			_, _ = Pages(pdf[:n])
+		}()
+	}
+}
@@ -0,0 +1,322 @@
+// Package polite paces requests to the City's web server. Its Transport applies a shared request and
+// bandwidth limit, caps concurrent requests per host, identifies itself with a User-Agent and honours
+// robots.txt, including Crawl-delay. Share one Transport between the scraper and the downloader so the limits
+// cover everything a run fetches.
+package polite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrDisallowed is returned for requests that robots.txt does not allow.
+var ErrDisallowed = errors.New("polite: disallowed by robots.txt")
+
+// Config configures a Transport. Zero values disable the corresponding limit unless noted.
+type Config struct {
+	// Next sends the requests; it defaults to http.DefaultTransport.
+	Next http.RoundTripper
+	// RequestsPerSecond limits how often requests start, across all hosts.
+	RequestsPerSecond float64
+	// BytesPerSecond limits how fast response bodies are read, across all requests.
+	BytesPerSecond int64
+	// PerHost caps the requests in flight to one host, counting until the response body is closed.
+	PerHost int
+	// UserAgent replaces the User-Agent of every request and is the name robots.txt rules are matched against.
+	UserAgent string
+	// Robots enables robots.txt checks. Each host's robots.txt is fetched once and kept for RobotsTTL, which
+	// defaults to 24 hours.
+	Robots    bool
+	RobotsTTL time.Duration
+}
+
+// Transport is an http.RoundTripper that applies a Config. It is safe for concurrent use.
+type Transport struct {
+	cfg      Config
+	requests *limiter
+	bytes    *limiter
+
+	mu     sync.Mutex
+	hosts  map[string]*host
+	robots map[string]*robotsEntry
+}
+
+// host holds the per-host state: a semaphore for PerHost and the Crawl-delay pacing.
+type host struct {
+	slots chan struct{}
+	delay *limiter
+}
+
+type robotsEntry struct {
+	ready   chan struct{}
+	rules   *Robots
+	err     error
+	fetched time.Time
+}
+
+// New returns a Transport for cfg.
+func New(cfg Config) *Transport {
+	if cfg.Next == nil {
+		cfg.Next = http.DefaultTransport
+	}
+	if cfg.RobotsTTL <= 0 {
+		cfg.RobotsTTL = 24 * time.Hour
+	}
+	t := &Transport{cfg: cfg, hosts: make(map[string]*host), robots: make(map[string]*robotsEntry)}
+	if cfg.RequestsPerSecond > 0 {
+		t.requests = newLimiter(time.Duration(float64(time.Second) / cfg.RequestsPerSecond))
+	}
+	if cfg.BytesPerSecond > 0 {
+		t.bytes = newLimiter(time.Second / time.Duration(cfg.BytesPerSecond))
+	}
+	return t
+}
+
+// Client returns an http.Client that sends its requests through t.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip waits for the limits to allow req, checks it against robots.txt and sends it.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.send(req, t.cfg.Robots && req.URL.Path != "/robots.txt")
+}
+
+// send waits for the limits to allow req, checks it against robots.txt when robots is set and sends it.
+func (t *Transport) send(req *http.Request, robots bool) (*http.Response, error) {
+	ctx := req.Context()
+	if t.cfg.UserAgent != "" {
+		req = req.Clone(ctx)
+		req.Header.Set("User-Agent", t.cfg.UserAgent)
+	}
+
+	h := t.host(req.URL.Host)
+	if robots {
+		rules, err := t.robotsFor(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if !rules.Allowed(req.URL.RequestURI()) {
+			return nil, fmt.Errorf("%w: %s", ErrDisallowed, req.URL)
+		}
+		if rules.CrawlDelay > 0 {
+			h.setDelay(rules.CrawlDelay)
+		}
+	}
+
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := sync.OnceFunc(func() {
+		if h.slots != nil {
+			<-h.slots
+		}
+	})
+	if err := h.delay.wait(ctx, 1); err != nil {
+		release()
+		return nil, err
+	}
+	if err := t.requests.wait(ctx, 1); err != nil {
+		release()
+		return nil, err
+	}
+
+	resp, err := t.cfg.Next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &body{ReadCloser: resp.Body, ctx: ctx, bytes: t.bytes, release: release}
+	return resp, nil
+}
+
+func (t *Transport) host(name string) *host {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.hosts[name]
+	if !ok {
+		h = &host{delay: newLimiter(0)}
+		if t.cfg.PerHost > 0 {
+			h.slots = make(chan struct{}, t.cfg.PerHost)
+		}
+		t.hosts[name] = h
+	}
+	return h
+}
+
+func (h *host) setDelay(d time.Duration) {
+	h.delay.mu.Lock()
+	h.delay.interval = d
+	h.delay.mu.Unlock()
+}
+
+// robotsFor returns the robots.txt rules for the host of req, fetching them when they are missing or stale.
+// Concurrent requests to a host wait for a single fetch.
+func (t *Transport) robotsFor(ctx context.Context, req *http.Request) (*Robots, error) {
+	key := req.URL.Scheme + "://" + req.URL.Host
+	t.mu.Lock()
+	e, ok := t.robots[key]
+	if ok {
+		select {
+		case <-e.ready:
+			if e.err != nil || time.Since(e.fetched) > t.cfg.RobotsTTL {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		e = &robotsEntry{ready: make(chan struct{})}
+		t.robots[key] = e
+		go func() {
+			// The fetch is shared, so it must not be cut short by the request that started it.
+			e.rules, e.err = t.fetchRobots(context.WithoutCancel(ctx), key, req.Header.Get("User-Agent"))
+			e.fetched = time.Now()
+			close(e.ready)
+		}()
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-e.ready:
+		return e.rules, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// maxRobotsRedirects is the number of redirects followed when fetching robots.txt, the minimum RFC 9309 asks for.
+const maxRobotsRedirects = 5
+
+// fetchRobots fetches and parses origin/robots.txt, following up to maxRobotsRedirects redirects. As RFC 9309
+// allows, a missing robots.txt (any 4xx) and one behind redirects that don't end in a response allow everything.
+// Other failures are returned, so the next request fetches it again.
+func (t *Transport) fetchRobots(ctx context.Context, origin, userAgent string) (*Robots, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	u, err := url.Parse(origin + "/robots.txt")
+	if err != nil {
+		return nil, err
+	}
+	for redirects := 0; ; redirects++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		// Redirect targets aren't checked against robots.txt: that could wait on this very fetch.
+		resp, err := t.send(req, false)
+		if err != nil {
+			return nil, fmt.Errorf("polite: fetch robots.txt: %w", err)
+		}
+		switch {
+		case resp.StatusCode >= 500:
+			resp.Body.Close()
+			return nil, fmt.Errorf("polite: fetch robots.txt: unexpected status %s", resp.Status)
+		case resp.StatusCode >= 400:
+			resp.Body.Close()
+			return &Robots{}, nil
+		case resp.StatusCode >= 300:
+			resp.Body.Close()
+			next, err := u.Parse(resp.Header.Get("Location"))
+			if resp.Header.Get("Location") == "" || err != nil || next.Scheme != "http" && next.Scheme != "https" ||
+				redirects == maxRobotsRedirects {
+				return &Robots{}, nil
+			}
+			u = next
+			continue
+		case resp.StatusCode != http.StatusOK:
+			resp.Body.Close()
+			return nil, fmt.Errorf("polite: fetch robots.txt: unexpected status %s", resp.Status)
+		}
+		// RFC 9309 asks crawlers to read at least 500 KiB; anything past that is ignored.
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 500<<10))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("polite: read robots.txt: %w", err)
+		}
+		return ParseRobots(data, t.cfg.UserAgent), nil
+	}
+}
+
+// body paces reads against the bandwidth limit and frees the host slot when closed.
+type body struct {
+	io.ReadCloser
+	ctx     context.Context
+	bytes   *limiter
+	release func()
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := b.bytes.wait(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
+
+// limiter spaces events at least interval apart, with n events taking n intervals. A nil limiter or a zero
+// interval never waits.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(interval time.Duration) *limiter {
+	return &limiter{interval: interval}
+}
+
+// wait reserves n events and sleeps until the first of them is due.
+func (l *limiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.interval <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(time.Duration(n) * l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,207 @@
+package polite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const robotsTxt = `# test robots
+User-agent: *
+Disallow: /private/
+Crawl-delay: 5
+
+User-agent: civic-code
+User-agent: other
+Disallow: /private/
+Allow: /private/open
+Disallow: /*.zip$
+Crawl-delay: 0.05
+`
+
+func TestParseRobots(t *testing.T) {
+	r := ParseRobots([]byte(robotsTxt), "Civic-Code/1.0 (+https://example.org)")
+	if r.CrawlDelay != 50*time.Millisecond {
+		t.Fatalf("unexpected crawl delay %s", r.CrawlDelay)
+	}
+	cases := map[string]bool{
+		"/":                    true,
+		"/private/secret":      false,
+		"/private/open/a.pdf":  true,
+		"/files/archive.zip":   false,
+		"/files/archive.zip?x": true,
+		"/files/a.pdf":         true,
+	}
+	for path, want := range cases {
+		if got := r.Allowed(path); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	star := ParseRobots([]byte(robotsTxt), "somebot")
+	if star.CrawlDelay != 5*time.Second || star.Allowed("/private/open") {
+		t.Fatalf("expected the * group for an unnamed agent: %+v", star)
+	}
+	if !ParseRobots(nil, "somebot").Allowed("/anything") {
+		t.Fatalf("an empty robots.txt should allow everything")
+	}
+}
+
+func TestTransportRobots(t *testing.T) {
+	var robotsFetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "civic-code/test" {
+			t.Errorf("unexpected User-Agent %q", r.Header.Get("User-Agent"))
+		}
+		if r.URL.Path == "/robots.txt" {
+			robotsFetches.Add(1)
+			_, _ = io.WriteString(w, robotsTxt)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+
+	client := New(Config{Next: srv.Client().Transport, UserAgent: "civic-code/test", Robots: true}).Client()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL + "/public.pdf")
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("crawl-delay not applied: 3 requests took %s", elapsed)
+	}
+	if _, err := client.Get(srv.URL + "/private/secret.pdf"); !errors.Is(err, ErrDisallowed) {
+		t.Fatalf("expected ErrDisallowed, got %v", err)
+	}
+	if robotsFetches.Load() != 1 {
+		t.Fatalf("expected robots.txt to be fetched once, got %d", robotsFetches.Load())
+	}
+}
+
+func TestTransportRobotsRedirects(t *testing.T) {
+	for name, tc := range map[string]struct {
+		hops    int
+		allowed bool
+	}{
+		"followed":     {hops: 2, allowed: false},
+		"too many":     {hops: 6, allowed: true},
+		"to a missing": {hops: -1, allowed: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var robotsFetches atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/robots.txt":
+					robotsFetches.Add(1)
+					if tc.hops < 0 {
+						http.Redirect(w, r, "/gone.txt", http.StatusMovedPermanently)
+						return
+					}
+					http.Redirect(w, r, "/robots/1", http.StatusFound)
+				case r.URL.Path == "/gone.txt":
+					http.NotFound(w, r)
+				case strings.HasPrefix(r.URL.Path, "/robots/"):
+					n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/robots/"))
+					if n < tc.hops {
+						http.Redirect(w, r, "/robots/"+strconv.Itoa(n+1), http.StatusFound)
+						return
+					}
+					_, _ = io.WriteString(w, "User-agent: *\nDisallow: /private/\n")
+				default:
+					_, _ = io.WriteString(w, "ok")
+				}
+			}))
+			t.Cleanup(srv.Close)
+
+			client := New(Config{Next: srv.Client().Transport, Robots: true}).Client()
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get(srv.URL + "/private/secret.pdf")
+				if tc.allowed != (err == nil) {
+					t.Fatalf("Get returned error %v, want allowed %v", err, tc.allowed)
+				}
+				if err == nil {
+					resp.Body.Close()
+				} else if !errors.Is(err, ErrDisallowed) {
+					t.Fatalf("expected ErrDisallowed, got %v", err)
+				}
+			}
+			if robotsFetches.Load() != 1 {
+				t.Fatalf("expected robots.txt to be fetched once, got %d", robotsFetches.Load())
+			}
+		})
+	}
+}
+
+func TestTransportLimits(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write(make([]byte, 1000))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := New(Config{Next: srv.Client().Transport, PerHost: 2, RequestsPerSecond: 100, BytesPerSecond: 50000}).Client()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				t.Errorf("Get returned error: %v", err)
+				return
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight.Load() > 2 {
+		t.Fatalf("per-host cap exceeded: %d requests in flight", maxInFlight.Load())
+	}
+	// 6000 bytes at 50000 bytes/s take at least 100ms after the first read.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("bandwidth limit not applied: took %s", elapsed)
+	}
+}
+
+func TestTransportContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	client := New(Config{Next: srv.Client().Transport, RequestsPerSecond: 0.1}).Client()
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to end with the context, got %v", err)
+	}
+}
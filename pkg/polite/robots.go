@@ -0,0 +1,132 @@
+package polite
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots holds the robots.txt rules that apply to one user agent.
+type Robots struct {
+	rules []rule
+	// CrawlDelay is the delay the site asks for between requests, or zero.
+	CrawlDelay time.Duration
+}
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// group is one robots.txt group: the user agents it names and the lines that follow them.
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// ParseRobots parses a robots.txt file and returns the rules for userAgent, following RFC 9309. The groups
+// naming the product token of userAgent (the part before any "/" or space) are used, or failing that the "*"
+// groups. Crawl-delay, which the RFC leaves out, is read as a number of seconds.
+func ParseRobots(data []byte, userAgent string) *Robots {
+	groups := make([]*group, 0)
+	var cur *group
+	inAgents := false
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				cur = &group{}
+				groups = append(groups, cur)
+				inAgents = true
+			}
+			cur.agents = append(cur.agents, strings.ToLower(value))
+			continue
+		case "allow", "disallow":
+			// An empty Disallow allows everything, which is also what no rule at all does.
+			if cur != nil && value != "" {
+				cur.rules = append(cur.rules, rule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if cur != nil {
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+					cur.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+		inAgents = false
+	}
+
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	r := &Robots{}
+	for _, want := range []string{token, "*"} {
+		for _, g := range groups {
+			for _, agent := range g.agents {
+				if agent == want && want != "" {
+					r.rules = append(r.rules, g.rules...)
+					r.CrawlDelay = max(r.CrawlDelay, g.crawlDelay)
+					break
+				}
+			}
+		}
+		if len(r.rules) > 0 || r.CrawlDelay > 0 {
+			break
+		}
+	}
+	return r
+}
+
+// Allowed reports whether path (with any query) may be fetched. The longest matching rule wins, and Allow wins
+// a tie; a path no rule matches is allowed.
+func (r *Robots) Allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	best, allowed := -1, true
+	for _, rl := range r.rules {
+		if !match(rl.pattern, path) {
+			continue
+		}
+		if n := len(rl.pattern); n > best || n == best && rl.allow {
+			best, allowed = n, rl.allow
+		}
+	}
+	return allowed
+}
+
+// match reports whether path matches a robots.txt pattern, where "*" matches any run of characters and a
+// trailing "$" anchors the pattern at the end of the path. Patterns otherwise match prefixes.
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return len(path)-pos >= len(part) && strings.HasSuffix(path, part)
+		}
+		j := strings.Index(path[pos:], part)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(part)
+	}
+	return !anchored || pos == len(path)
+}
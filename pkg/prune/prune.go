@@ -0,0 +1,295 @@
+// Package prune decides which files in a download directory a retention policy removes. Only files recorded
+// in metadata.json, and unchanged since they were downloaded, have a known provenance; anything else is left
+// alone unless the policy is forced.
+package prune
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// Reasons a file is removed or skipped.
+const (
+	ReasonUnlisted   = "unlisted"
+	ReasonExpired    = "expired"
+	ReasonSuperseded = "superseded"
+	ReasonOrphan     = "orphan"
+	// ReasonModified marks a recorded file whose content no longer matches its checksum.
+	ReasonModified = "modified"
+)
+
+// Policy selects what to prune. Each rule is off in the zero Policy.
+type Policy struct {
+	// Listed, when non-nil, is the current upstream listing; recorded documents missing from it are removed.
+	Listed []scraper.Document
+	// KeepYears, when positive, removes documents from meetings before the last KeepYears calendar years,
+	// counting the year of Now.
+	KeepYears int
+	Now       time.Time
+	// LatestOnly removes all but the most recent of the documents that share a meeting and name, as when the
+	// City posts a revision at a new link. The most recent is the one first seen last, per FirstSeen.
+	LatestOnly bool
+	FirstSeen  map[string]time.Time
+	// Orphans removes files not recorded in metadata.json. Their provenance is unknown, so they are only
+	// removed when Force is set.
+	Orphans bool
+	// Force also removes files of unknown provenance: orphans and recorded files that have been modified.
+	Force bool
+	// Protect lists path.Match patterns, relative to the directory with forward slashes, for files and
+	// directories that are never considered, such as metadata.json.
+	Protect []string
+}
+
+// Action is one file the plan removes or skips.
+type Action struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	ID     string `json:"id,omitempty"`
+	Link   string `json:"link,omitempty"`
+	Size   int64  `json:"size"`
+	// Note explains a skipped action.
+	Note string `json:"note,omitempty"`
+}
+
+// Plan is the outcome of applying a Policy to a directory.
+type Plan struct {
+	Remove  []Action `json:"remove"`
+	Skipped []Action `json:"skipped"`
+	// Bytes is the total size of the files to remove.
+	Bytes int64 `json:"bytes"`
+	// Keep is the recorded documents that remain, for rewriting metadata.json.
+	Keep []scraper.Document `json:"-"`
+}
+
+// NewPlan works out what policy removes from dir, where docs are the documents recorded in metadata.json. It
+// reads the directory but changes nothing.
+func NewPlan(dir string, docs []scraper.Document, policy Policy) (*Plan, error) {
+	if policy.Listed != nil && len(policy.Listed) == 0 {
+		return nil, errors.New("prune: the upstream listing is empty; refusing to treat every document as unlisted")
+	}
+	if policy.KeepYears > 0 && policy.Now.IsZero() {
+		policy.Now = time.Now()
+	}
+
+	reasons := make(map[int]string)
+	if policy.Listed != nil {
+		listed := make(map[string]bool, len(policy.Listed))
+		for _, doc := range policy.Listed {
+			listed[doc.Link] = true
+		}
+		for i, doc := range docs {
+			if !listed[doc.Link] {
+				reasons[i] = ReasonUnlisted
+			}
+		}
+	}
+	if policy.KeepYears > 0 {
+		first := policy.Now.Year() - policy.KeepYears + 1
+		for i, doc := range docs {
+			if _, ok := reasons[i]; !ok && !doc.Date.IsZero() && doc.Date.Year() < first {
+				reasons[i] = ReasonExpired
+			}
+		}
+	}
+	if policy.LatestOnly {
+		for i := range superseded(docs, policy.FirstSeen) {
+			if _, ok := reasons[i]; !ok {
+				reasons[i] = ReasonSuperseded
+			}
+		}
+	}
+
+	plan := &Plan{Remove: make([]Action, 0), Skipped: make([]Action, 0), Keep: make([]scraper.Document, 0)}
+	// A file still named by a document that stays is never removed, even if another entry pointing at it goes.
+	kept := make(map[string]bool)
+	for i, doc := range docs {
+		if _, ok := reasons[i]; !ok && doc.FileName != "" {
+			kept[doc.FileName] = true
+		}
+	}
+	planned := make(map[string]bool)
+	for i, doc := range docs {
+		reason, ok := reasons[i]
+		if !ok {
+			plan.Keep = append(plan.Keep, doc)
+			continue
+		}
+		if doc.FileName == "" || kept[doc.FileName] || planned[doc.FileName] || protected(doc.FileName, policy.Protect) {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(doc.FileName)) {
+			plan.Keep = append(plan.Keep, doc)
+			plan.Skipped = append(plan.Skipped, Action{Path: doc.FileName, Reason: reason, ID: doc.ID, Link: doc.Link, Note: "file name outside the directory"})
+			continue
+		}
+		planned[doc.FileName] = true
+		action := Action{Path: doc.FileName, Reason: reason, ID: doc.ID, Link: doc.Link}
+		full := filepath.Join(dir, filepath.FromSlash(doc.FileName))
+		info, err := os.Stat(full)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Nothing on disk; dropping the entry is all there is to do.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("prune: %w", err)
+		}
+		action.Size = info.Size()
+		if doc.Checksum != "" {
+			sum, err := checksum(full)
+			if err != nil {
+				return nil, fmt.Errorf("prune: %w", err)
+			}
+			if sum != doc.Checksum && !policy.Force {
+				action.Note = ReasonModified + ": content does not match the recorded checksum; pass -force to remove"
+				plan.Keep = append(plan.Keep, doc)
+				plan.Skipped = append(plan.Skipped, action)
+				continue
+			}
+		}
+		plan.add(action)
+	}
+
+	if policy.Orphans {
+		recorded := make(map[string]bool, len(docs))
+		for _, doc := range docs {
+			recorded[doc.FileName] = true
+		}
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, p)
+			rel = filepath.ToSlash(rel)
+			if rel == "." {
+				return nil
+			}
+			if protected(rel, policy.Protect) || strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || recorded[rel] {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			action := Action{Path: rel, Reason: ReasonOrphan, Size: info.Size()}
+			if !policy.Force {
+				action.Note = "unknown provenance: not recorded in metadata.json; pass -force to remove"
+				plan.Skipped = append(plan.Skipped, action)
+				return nil
+			}
+			plan.add(action)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("prune: %w", err)
+		}
+	}
+	return plan, nil
+}
+
+func (p *Plan) add(a Action) {
+	p.Remove = append(p.Remove, a)
+	p.Bytes += a.Size
+}
+
+// Apply removes the planned files from dir, and any directories the removals leave empty.
+func (p *Plan) Apply(dir string) error {
+	dir = filepath.Clean(dir)
+	errs := make([]error, 0)
+	for _, a := range p.Remove {
+		full := filepath.Join(dir, filepath.FromSlash(a.Path))
+		if err := os.Remove(full); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("prune: %w", err))
+			continue
+		}
+		for parent := filepath.Dir(full); parent != dir && strings.HasPrefix(parent, dir); parent = filepath.Dir(parent) {
+			if os.Remove(parent) != nil {
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// superseded returns the indexes of documents that share a meeting and name with a more recent one.
+func superseded(docs []scraper.Document, firstSeen map[string]time.Time) map[int]bool {
+	type key struct {
+		code string
+		date int64
+		name string
+	}
+	groups := make(map[key][]int)
+	for i, doc := range docs {
+		k := key{doc.Meeting.Code, doc.Date.Unix(), strings.ToLower(doc.Name)}
+		groups[k] = append(groups[k], i)
+	}
+	out := make(map[int]bool)
+	for _, idx := range groups {
+		if len(idx) < 2 {
+			continue
+		}
+		// Order by first seen; the listing order breaks ties, later entries being newer.
+		latest := slices.MaxFunc(idx, func(a, b int) int {
+			if c := firstSeen[documentID(docs[a])].Compare(firstSeen[documentID(docs[b])]); c != 0 {
+				return c
+			}
+			return a - b
+		})
+		for _, i := range idx {
+			if i != latest {
+				out[i] = true
+			}
+		}
+	}
+	return out
+}
+
+func documentID(doc scraper.Document) string {
+	if doc.ID != "" {
+		return doc.ID
+	}
+	return scraper.DocumentID(doc.Link)
+}
+
+func protected(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		// A pattern naming a directory protects everything in it.
+		if strings.HasPrefix(rel, strings.TrimSuffix(pattern, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
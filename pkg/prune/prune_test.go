@@ -0,0 +1,127 @@
+package prune
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// setup writes a file for each document and returns the documents with their checksums.
+func setup(t *testing.T, dir string, docs []scraper.Document) []scraper.Document {
+	t.Helper()
+	for i := range docs {
+		content := "%PDF-1.4 " + docs[i].Link
+		path := filepath.Join(dir, filepath.FromSlash(docs[i].FileName))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		docs[i].Checksum = hex.EncodeToString(sum[:])
+	}
+	return docs
+}
+
+func doc(link, name string, year int, file string) scraper.Document {
+	return scraper.Document{
+		Link:     link,
+		Name:     name,
+		Meeting:  scraper.CC,
+		Date:     time.Date(year, time.March, 4, 0, 0, 0, 0, time.UTC),
+		FileName: file,
+	}
+}
+
+func paths(actions []Action) string {
+	out := make([]string, 0, len(actions))
+	for _, a := range actions {
+		out = append(out, a.Path+":"+a.Reason)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ",")
+}
+
+func TestNewPlan(t *testing.T) {
+	dir := t.TempDir()
+	docs := setup(t, dir, []scraper.Document{
+		doc("https://example.org/a.pdf", "Agenda.pdf", 2024, "2024/agenda.pdf"),
+		doc("https://example.org/withdrawn.pdf", "Withdrawn.pdf", 2024, "2024/withdrawn.pdf"),
+		doc("https://example.org/old.pdf", "Old.pdf", 2019, "2019/old.pdf"),
+		doc("https://example.org/minutes.pdf", "Minutes.pdf", 2024, "2024/minutes-v1.pdf"),
+		doc("https://example.org/minutes.pdf?v=2", "Minutes.pdf", 2024, "2024/minutes-v2.pdf"),
+		doc("https://example.org/edited.pdf", "Edited.pdf", 2018, "2018/edited.pdf"),
+	})
+	if err := os.WriteFile(filepath.Join(dir, "2018", "edited.pdf"), []byte("changed by hand"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"stray.pdf", "metadata.json", ".put-123"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listed := []scraper.Document{docs[0], docs[2], docs[3], docs[4], docs[5]}
+	policy := Policy{
+		Listed:     listed,
+		KeepYears:  3,
+		Now:        time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+		LatestOnly: true,
+		FirstSeen: map[string]time.Time{
+			scraper.DocumentID(docs[3].Link): time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+			scraper.DocumentID(docs[4].Link): time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+		},
+		Orphans: true,
+		Protect: []string{"metadata.json"},
+	}
+	plan, err := NewPlan(dir, docs, policy)
+	if err != nil {
+		t.Fatalf("NewPlan returned error: %v", err)
+	}
+	if got := paths(plan.Remove); got != "2019/old.pdf:expired,2024/minutes-v1.pdf:superseded,2024/withdrawn.pdf:unlisted" {
+		t.Fatalf("unexpected removals: %s", got)
+	}
+	if got := paths(plan.Skipped); got != "2018/edited.pdf:expired,stray.pdf:orphan" {
+		t.Fatalf("unexpected skips: %s", got)
+	}
+	if len(plan.Keep) != 3 || plan.Bytes == 0 {
+		t.Fatalf("unexpected plan: keep %d, bytes %d", len(plan.Keep), plan.Bytes)
+	}
+
+	if err := plan.Apply(dir); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	for _, gone := range []string{"2019", "2024/withdrawn.pdf", "2024/minutes-v1.pdf"} {
+		if _, err := os.Stat(filepath.Join(dir, gone)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed: %v", gone, err)
+		}
+	}
+	for _, kept := range []string{"2024/agenda.pdf", "2024/minutes-v2.pdf", "2018/edited.pdf", "stray.pdf", "metadata.json", ".put-123"} {
+		if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+			t.Errorf("expected %s to be kept: %v", kept, err)
+		}
+	}
+
+	policy.Force = true
+	plan, err = NewPlan(dir, plan.Keep, policy)
+	if err != nil {
+		t.Fatalf("NewPlan returned error: %v", err)
+	}
+	if got := paths(plan.Remove); got != "2018/edited.pdf:expired,stray.pdf:orphan" {
+		t.Fatalf("unexpected forced removals: %s", got)
+	}
+}
+
+func TestNewPlanRefusesEmptyListing(t *testing.T) {
+	if _, err := NewPlan(t.TempDir(), nil, Policy{Listed: []scraper.Document{}}); err == nil {
+		t.Fatalf("expected an error for an empty listing")
+	}
+}
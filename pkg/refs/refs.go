@@ -0,0 +1,187 @@
+// Package refs extracts by-law, council resolution and report numbers from document text and indexes
+// where each one is mentioned.
+package refs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// Kind identifies the type of a reference.
+type Kind string
+
+const (
+	Bylaw      Kind = "bylaw"
+	Resolution Kind = "resolution"
+	Report     Kind = "report"
+)
+
+// Ref is a normalized identifier found in document text.
+type Ref struct {
+	Kind Kind   `json:"kind"`
+	ID   string `json:"id"`
+}
+
+func (r Ref) String() string {
+	return r.ID
+}
+
+var (
+	// By-law 123-2024, Bylaw No. 123-2024, By-law Number 123-2024
+	bylawRe = regexp.MustCompile(`(?i)\bby-?\s?laws?\s+(?:no\.?\s*|number\s+|#\s*)?(\d{1,5})\s*[-/]\s*(\d{4})\b`)
+	// CR456/2024, CR 456/2024, C.R. 456-2024
+	resolutionRe = regexp.MustCompile(`(?i)\bc\.?\s?r\.?\s?(\d{1,5})\s*[/-]\s*(\d{4})\b`)
+	// S 89/2024, C 12/2024
+	reportRe = regexp.MustCompile(`\b([SC])\s?(\d{1,5})\s*/\s*(\d{4})\b`)
+)
+
+// Extract returns the distinct references in text, in order of first appearance.
+func Extract(text string) []Ref {
+	type found struct {
+		pos int
+		ref Ref
+	}
+	var all []found
+	for _, m := range bylawRe.FindAllStringSubmatchIndex(text, -1) {
+		all = append(all, found{m[0], bylaw(text[m[2]:m[3]], text[m[4]:m[5]])})
+	}
+	for _, m := range resolutionRe.FindAllStringSubmatchIndex(text, -1) {
+		all = append(all, found{m[0], resolution(text[m[2]:m[3]], text[m[4]:m[5]])})
+	}
+	for _, m := range reportRe.FindAllStringSubmatchIndex(text, -1) {
+		all = append(all, found{m[0], report(text[m[2]:m[3]], text[m[4]:m[5]], text[m[6]:m[7]])})
+	}
+	slices.SortStableFunc(all, func(a, b found) int { return a.pos - b.pos })
+
+	out := make([]Ref, 0, len(all))
+	seen := make(map[Ref]bool)
+	for _, f := range all {
+		if !seen[f.ref] {
+			seen[f.ref] = true
+			out = append(out, f.ref)
+		}
+	}
+	return out
+}
+
+// Parse normalizes a user supplied identifier such as "cr 456/2024" or "Bylaw 123-2024".
+func Parse(s string) (Ref, error) {
+	refs := Extract(s)
+	if len(refs) != 1 {
+		return Ref{}, fmt.Errorf("refs: unrecognized reference %q", s)
+	}
+	return refs[0], nil
+}
+
+func trimNumber(n string) string {
+	v, err := strconv.Atoi(n)
+	if err != nil {
+		return n
+	}
+	return strconv.Itoa(v)
+}
+
+func bylaw(num, year string) Ref {
+	return Ref{Kind: Bylaw, ID: fmt.Sprintf("By-law %s-%s", trimNumber(num), year)}
+}
+
+func resolution(num, year string) Ref {
+	return Ref{Kind: Resolution, ID: fmt.Sprintf("CR%s/%s", trimNumber(num), year)}
+}
+
+func report(series, num, year string) Ref {
+	return Ref{Kind: Report, ID: fmt.Sprintf("%s %s/%s", series, trimNumber(num), year)}
+}
+
+// Entry records the references found in one indexed Document.
+type Entry struct {
+	Document scraper.Document `json:"document"`
+	// Pages maps each reference ID to the 1-based pages it appears on.
+	Pages map[string][]int `json:"pages"`
+}
+
+// Match is a Document that mentions a reference, with the pages it appears on.
+type Match struct {
+	Document scraper.Document `json:"document"`
+	Pages    []int            `json:"pages"`
+}
+
+// Index is a cross-reference of identifiers to the Documents that mention them, keyed by Document link.
+type Index struct {
+	Entries map[string]Entry `json:"entries"`
+}
+
+// NewIndex returns an empty Index.
+func NewIndex() *Index {
+	return &Index{Entries: make(map[string]Entry)}
+}
+
+// Load reads an Index from path. A missing file returns an empty Index.
+func Load(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewIndex(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	idx := NewIndex()
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("refs: decode %s: %w", path, err)
+	}
+	if idx.Entries == nil {
+		idx.Entries = make(map[string]Entry)
+	}
+	return idx, nil
+}
+
+// Save writes the Index to path as JSON.
+func (idx *Index) Save(path string) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Indexed reports whether doc is already indexed with the same checksum.
+func (idx *Index) Indexed(doc scraper.Document) bool {
+	e, ok := idx.Entries[doc.Link]
+	return ok && e.Document.Checksum == doc.Checksum
+}
+
+// Add indexes the references found in the text of each page of doc, replacing any previous entry.
+func (idx *Index) Add(doc scraper.Document, pages []string) {
+	entry := Entry{Document: doc, Pages: make(map[string][]int)}
+	for i, text := range pages {
+		for _, ref := range Extract(text) {
+			entry.Pages[ref.ID] = append(entry.Pages[ref.ID], i+1)
+		}
+	}
+	idx.Entries[doc.Link] = entry
+}
+
+// Lookup returns the Documents that mention ref in chronological order.
+func (idx *Index) Lookup(ref Ref) []Match {
+	out := make([]Match, 0)
+	for _, e := range idx.Entries {
+		if pages, ok := e.Pages[ref.ID]; ok {
+			out = append(out, Match{Document: e.Document, Pages: pages})
+		}
+	}
+	slices.SortFunc(out, func(a, b Match) int {
+		if c := a.Document.Date.Compare(b.Document.Date); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Document.Name, b.Document.Name)
+	})
+	return out
+}
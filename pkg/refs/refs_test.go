@@ -0,0 +1,81 @@
+package refs
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+func TestExtract(t *testing.T) {
+	text := "That By-law No. 123-2024 BE ADOPTED per CR 456/2024 and report S 089/2024; " +
+		"see also Bylaw 123-2024, C.R.457-2024 and C 12/2024."
+
+	got := Extract(text)
+	want := []Ref{
+		{Kind: Bylaw, ID: "By-law 123-2024"},
+		{Kind: Resolution, ID: "CR456/2024"},
+		{Kind: Report, ID: "S 89/2024"},
+		{Kind: Resolution, ID: "CR457/2024"},
+		{Kind: Report, ID: "C 12/2024"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Extract => %v, want %v", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	ref, err := Parse("cr456/2024")
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if ref.ID != "CR456/2024" {
+		t.Fatalf("Parse => %q, want %q", ref.ID, "CR456/2024")
+	}
+
+	if _, err := Parse("agenda"); err == nil {
+		t.Fatalf("expected error for unrecognized reference")
+	}
+}
+
+func TestIndexLookup(t *testing.T) {
+	council := scraper.Document{
+		Link: "https://example.invalid/council.pdf",
+		Name: "council.pdf",
+		Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC),
+	}
+	committee := scraper.Document{
+		Link: "https://example.invalid/committee.pdf",
+		Name: "committee.pdf",
+		Date: time.Date(2024, time.February, 7, 0, 0, 0, 0, time.UTC),
+	}
+
+	idx := NewIndex()
+	idx.Add(council, []string{"Minutes", "CR456/2024 carried", "Ratified CR456/2024"})
+	idx.Add(committee, []string{"Recommended as CR456/2024"})
+
+	path := filepath.Join(t.TempDir(), "refs.json")
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	matches := loaded.Lookup(Ref{Kind: Resolution, ID: "CR456/2024"})
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matches))
+	}
+	if matches[0].Document.Name != "committee.pdf" || matches[1].Document.Name != "council.pdf" {
+		t.Fatalf("matches not in chronological order: %+v", matches)
+	}
+	if !reflect.DeepEqual(matches[1].Pages, []int{2, 3}) {
+		t.Fatalf("unexpected pages: %v", matches[1].Pages)
+	}
+	if !loaded.Indexed(council) {
+		t.Fatalf("expected council document to be indexed")
+	}
+}
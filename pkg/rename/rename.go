@@ -0,0 +1,190 @@
+// Package rename moves the files in a download directory to new names, such as those a new file name template
+// gives them. Files may trade names or move in cycles, and a failure part way through puts every file back
+// where it was.
+package rename
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// Move is one file to move. A file recorded for several documents that are named differently ends up under each
+// of their names: the first is a rename, the others hard links to it.
+type Move struct {
+	From string   `json:"from"`
+	To   []string `json:"to"`
+	// Missing is set when the file isn't on disk; only its record changes.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Plan is the set of moves that gives documents their new names.
+type Plan struct {
+	Moves []Move `json:"moves"`
+}
+
+// Moved returns the number of files the plan moves, leaving out missing ones.
+func (p *Plan) Moved() int {
+	n := 0
+	for _, m := range p.Moves {
+		if !m.Missing {
+			n++
+		}
+	}
+	return n
+}
+
+// The file operations Apply uses, replaced in tests to make them fail.
+var (
+	osRename = os.Rename
+	osLink   = os.Link
+)
+
+// NewPlan works out the moves that give each recorded document in dir its new name, names[i] for docs[i].
+// Documents without a file name are skipped. A file shared by documents that are named differently keeps every
+// name they need, its current one included. It refuses moves that would leave the directory or overwrite a file
+// that stays.
+func NewPlan(dir string, docs []scraper.Document, names []string) (*Plan, error) {
+	if len(names) != len(docs) {
+		return nil, fmt.Errorf("rename: %d names for %d documents", len(names), len(docs))
+	}
+	// Every name each file needs, including its current one when a document that shares it keeps its name.
+	files := make([]Move, 0)
+	byFile := make(map[string]int)
+	for i, doc := range docs {
+		to := names[i]
+		if doc.FileName == "" {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(doc.FileName)) || !filepath.IsLocal(filepath.FromSlash(to)) {
+			return nil, fmt.Errorf("rename: %s -> %s: file name outside %s", doc.FileName, to, dir)
+		}
+		f, ok := byFile[doc.FileName]
+		if !ok {
+			f = len(files)
+			byFile[doc.FileName] = f
+			files = append(files, Move{From: doc.FileName})
+		}
+		if !slices.Contains(files[f].To, to) {
+			files[f].To = append(files[f].To, to)
+		}
+	}
+
+	index := make(map[string]int)
+	p := &Plan{Moves: make([]Move, 0)}
+	for _, m := range files {
+		if len(m.To) == 1 && m.To[0] == m.From {
+			continue
+		}
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(m.From)))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("rename: %w", err)
+		}
+		m.Missing = err != nil
+		index[m.From] = len(p.Moves)
+		p.Moves = append(p.Moves, m)
+	}
+
+	// A destination may be a file that is itself moving away, but nothing else, and only one file may move to it.
+	targets := make(map[string]string)
+	for _, m := range p.Moves {
+		for _, to := range m.To {
+			if from, ok := targets[to]; ok {
+				return nil, fmt.Errorf("rename: %s and %s both move to %s", from, m.From, to)
+			}
+			targets[to] = m.From
+			if _, moving := index[to]; moving {
+				continue
+			}
+			if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(to))); err == nil {
+				return nil, fmt.Errorf("rename: %s -> %s: destination exists", m.From, to)
+			}
+		}
+	}
+	return p, nil
+}
+
+// Apply makes the moves in two steps, through temporary names, so files can trade names. When a step fails, the
+// steps already made are undone in reverse, so the directory is as it was and the records still match it. Only
+// if undoing fails too are files left under .rename-N- names; the error lists them. Directories left empty are
+// removed once every move has been made.
+func (p *Plan) Apply(dir string) error {
+	var undo []func() error
+	rollback := func(err error) error {
+		errs := []error{err}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if uerr := undo[i](); uerr != nil {
+				errs = append(errs, fmt.Errorf("rename: undo: %w", uerr))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	move := func(from, to string) error {
+		if err := osRename(from, to); err != nil {
+			return err
+		}
+		undo = append(undo, func() error { return osRename(to, from) })
+		return nil
+	}
+
+	temps := make([]string, len(p.Moves))
+	for i, m := range p.Moves {
+		if m.Missing {
+			continue
+		}
+		from := filepath.Join(dir, filepath.FromSlash(m.From))
+		temps[i] = filepath.Join(filepath.Dir(from), fmt.Sprintf(".rename-%d-%s", i, filepath.Base(from)))
+		if err := move(from, temps[i]); err != nil {
+			return rollback(fmt.Errorf("rename: %w", err))
+		}
+	}
+	for i, m := range p.Moves {
+		if m.Missing {
+			continue
+		}
+		first := filepath.Join(dir, filepath.FromSlash(m.To[0]))
+		for j, to := range m.To {
+			dest := filepath.Join(dir, filepath.FromSlash(to))
+			if _, err := os.Stat(filepath.Dir(dest)); errors.Is(err, os.ErrNotExist) {
+				if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+					return rollback(fmt.Errorf("rename: %w", err))
+				}
+				undo = append(undo, func() error {
+					removeEmptyParents(dir, dest)
+					return nil
+				})
+			}
+			if j == 0 {
+				if err := move(temps[i], dest); err != nil {
+					return rollback(fmt.Errorf("rename: %s -> %s: %w", m.From, to, err))
+				}
+				continue
+			}
+			if err := osLink(first, dest); err != nil {
+				return rollback(fmt.Errorf("rename: %s -> %s: %w", m.From, to, err))
+			}
+			undo = append(undo, func() error { return os.Remove(dest) })
+		}
+	}
+	for _, m := range p.Moves {
+		if !m.Missing {
+			removeEmptyParents(dir, filepath.Join(dir, filepath.FromSlash(m.From)))
+		}
+	}
+	return nil
+}
+
+// removeEmptyParents removes the directories between file and dir that are empty.
+func removeEmptyParents(dir, file string) {
+	dir = filepath.Clean(dir)
+	for parent := filepath.Dir(file); parent != dir && strings.HasPrefix(parent, dir); parent = filepath.Dir(parent) {
+		if os.Remove(parent) != nil {
+			return
+		}
+	}
+}
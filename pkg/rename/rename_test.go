@@ -0,0 +1,211 @@
+package rename
+
+import (
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// setup writes files, a map of slash-separated names to contents, into a new directory.
+func setup(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// snapshot returns the files in dir with their contents, and its directories with a trailing slash.
+func snapshot(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	out := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			out[rel+"/"] = ""
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		out[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// renames returns documents recorded under the first of each pair and the names the second gives them.
+func renames(pairs ...[2]string) ([]scraper.Document, []string) {
+	docs := make([]scraper.Document, 0, len(pairs))
+	names := make([]string, 0, len(pairs))
+	for i, p := range pairs {
+		docs = append(docs, scraper.Document{Link: "https://example.org/" + string(rune('a'+i)) + ".pdf", FileName: p[0]})
+		names = append(names, p[1])
+	}
+	return docs, names
+}
+
+func TestPlanApply(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		moves [][2]string
+		want  map[string]string
+		// linked are destinations that must be the same file.
+		linked []string
+	}{
+		{
+			name:  "into directories",
+			files: map[string]string{"a.pdf": "A"},
+			moves: [][2]string{{"a.pdf", "2024/cc/a.pdf"}},
+			want:  map[string]string{"2024/": "", "2024/cc/": "", "2024/cc/a.pdf": "A"},
+		},
+		{
+			name:  "back to flat",
+			files: map[string]string{"2024/cc/a.pdf": "A", "2024/keep.txt": "K"},
+			moves: [][2]string{{"2024/cc/a.pdf", "a.pdf"}},
+			want:  map[string]string{"a.pdf": "A", "2024/": "", "2024/keep.txt": "K"},
+		},
+		{
+			name:  "swap",
+			files: map[string]string{"a.pdf": "A", "b.pdf": "B"},
+			moves: [][2]string{{"a.pdf", "b.pdf"}, {"b.pdf", "a.pdf"}},
+			want:  map[string]string{"a.pdf": "B", "b.pdf": "A"},
+		},
+		{
+			name:  "cycle",
+			files: map[string]string{"a.pdf": "A", "b.pdf": "B", "c.pdf": "C"},
+			moves: [][2]string{{"a.pdf", "b.pdf"}, {"b.pdf", "c.pdf"}, {"c.pdf", "a.pdf"}},
+			want:  map[string]string{"a.pdf": "C", "b.pdf": "A", "c.pdf": "B"},
+		},
+		{
+			name:   "extra destinations",
+			files:  map[string]string{"shared.pdf": "S"},
+			moves:  [][2]string{{"shared.pdf", "cc/shared.pdf"}, {"shared.pdf", "dhs/shared.pdf"}},
+			want:   map[string]string{"cc/": "", "cc/shared.pdf": "S", "dhs/": "", "dhs/shared.pdf": "S"},
+			linked: []string{"cc/shared.pdf", "dhs/shared.pdf"},
+		},
+		{
+			name:   "shared file keeps its name for one document",
+			files:  map[string]string{"x.pdf": "X"},
+			moves:  [][2]string{{"x.pdf", "x.pdf"}, {"x.pdf", "y.pdf"}},
+			want:   map[string]string{"x.pdf": "X", "y.pdf": "X"},
+			linked: []string{"x.pdf", "y.pdf"},
+		},
+		{
+			name:   "shared file keeps its name for a later document",
+			files:  map[string]string{"x.pdf": "X"},
+			moves:  [][2]string{{"x.pdf", "sub/y.pdf"}, {"x.pdf", "x.pdf"}},
+			want:   map[string]string{"x.pdf": "X", "sub/": "", "sub/y.pdf": "X"},
+			linked: []string{"x.pdf", "sub/y.pdf"},
+		},
+		{
+			name:  "missing file",
+			files: map[string]string{"b.pdf": "B"},
+			moves: [][2]string{{"gone.pdf", "new.pdf"}, {"b.pdf", "b.pdf"}},
+			want:  map[string]string{"b.pdf": "B"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := setup(t, tc.files)
+			docs, names := renames(tc.moves...)
+			plan, err := NewPlan(dir, docs, names)
+			if err != nil {
+				t.Fatalf("NewPlan returned error: %v", err)
+			}
+			if err := plan.Apply(dir); err != nil {
+				t.Fatalf("Apply returned error: %v", err)
+			}
+			if got := snapshot(t, dir); !maps.Equal(got, tc.want) {
+				t.Fatalf("after Apply: %v, want %v", got, tc.want)
+			}
+			if len(tc.linked) == 2 {
+				a, _ := os.Stat(filepath.Join(dir, filepath.FromSlash(tc.linked[0])))
+				b, _ := os.Stat(filepath.Join(dir, filepath.FromSlash(tc.linked[1])))
+				if a == nil || b == nil || !os.SameFile(a, b) {
+					t.Fatalf("%v are not hard links to one file", tc.linked)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPlanRefuses(t *testing.T) {
+	for name, moves := range map[string][][2]string{
+		"destination exists": {{"a.pdf", "b.pdf"}},
+		"outside":            {{"a.pdf", "../a.pdf"}},
+		"absolute":           {{"a.pdf", "/tmp/a.pdf"}},
+		"same destination":   {{"a.pdf", "c.pdf"}, {"b.pdf", "c.pdf"}},
+	} {
+		dir := setup(t, map[string]string{"a.pdf": "A", "b.pdf": "B"})
+		docs, names := renames(moves...)
+		if _, err := NewPlan(dir, docs, names); err == nil {
+			t.Errorf("%s: NewPlan succeeded, want error", name)
+		}
+	}
+}
+
+func TestApplyRollsBack(t *testing.T) {
+	files := map[string]string{"a.pdf": "A", "b.pdf": "B", "c.pdf": "C", "2024/shared.pdf": "S"}
+	moves := [][2]string{
+		{"a.pdf", "b.pdf"}, {"b.pdf", "c.pdf"}, {"c.pdf", "a.pdf"},
+		{"2024/shared.pdf", "cc/2024/shared.pdf"}, {"2024/shared.pdf", "dhs/2024/shared.pdf"},
+	}
+	injected := errors.New("injected failure")
+	defer func() { osRename, osLink = os.Rename, os.Link }()
+
+	// Fail each file operation in turn; every failure must leave the directory as it was.
+	for fail := 1; ; fail++ {
+		dir := setup(t, files)
+		before := snapshot(t, dir)
+		calls := 0
+		failing := func(op func(string, string) error) func(string, string) error {
+			return func(from, to string) error {
+				if calls++; calls == fail {
+					return injected
+				}
+				return op(from, to)
+			}
+		}
+		osRename, osLink = failing(os.Rename), failing(os.Link)
+
+		docs, names := renames(moves...)
+		plan, err := NewPlan(dir, docs, names)
+		if err != nil {
+			t.Fatalf("NewPlan returned error: %v", err)
+		}
+		err = plan.Apply(dir)
+		if calls < fail {
+			if err != nil {
+				t.Fatalf("Apply returned error: %v", err)
+			}
+			if fail == 1 {
+				t.Fatalf("Apply made no file operations")
+			}
+			break
+		}
+		if !errors.Is(err, injected) {
+			t.Fatalf("operation %d: Apply = %v, want the injected failure", fail, err)
+		}
+		if got := snapshot(t, dir); !maps.Equal(got, before) {
+			t.Fatalf("operation %d failed: directory is %v, want %v", fail, got, before)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package scraper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // America/Toronto must resolve on hosts without a zoneinfo database, e.g. Windows.
+)
+
+// DefaultTimeZone is the IANA zone of the City of Windsor, where meetings are held.
+const DefaultTimeZone = "America/Toronto"
+
+// DefaultLocation is DefaultTimeZone, the location listing dates are read in unless Options.Location says
+// otherwise.
+var DefaultLocation = mustLoadLocation(DefaultTimeZone)
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+var (
+	dateLayout = "Monday, January 2, 2006"
+	dateRegex  = regexp.MustCompile(`\b(?:Monday|Tuesday|Wednesday|Thursday|Friday|Saturday|Sunday),\s+(January|February|March|April|May|June|July|August|September|October|November|December)\s+\d{1,2},\s+\d{4}\b`)
+	// clock12Regex matches times such as "6:00 PM", "6 p.m." and "4:30pm".
+	clock12Regex = regexp.MustCompile(`(?i)\b(1[0-2]|0?[1-9])(?::([0-5]\d))?\s*([ap])\.?\s*m\b\.?`)
+	// clock24Regex matches times such as "18:00".
+	clock24Regex = regexp.MustCompile(`\b([01]?\d|2[0-3]):([0-5]\d)\b`)
+)
+
+// parseMeetingTime returns the meeting date in a listing title, in loc. When the title also gives a start time
+// the result is that time of day; otherwise it is midnight.
+func parseMeetingTime(title string, loc *time.Location) (time.Time, error) {
+	dateStr := dateRegex.FindString(title)
+	if dateStr == "" {
+		return time.Time{}, ErrNoMeetingDate
+	}
+	date, err := time.ParseInLocation(dateLayout, dateStr, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse meeting date %q: %w", dateStr, err)
+	}
+	hour, minute, ok := startTime(strings.Replace(title, dateStr, "", 1))
+	if !ok {
+		return date, nil
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, loc), nil
+}
+
+// startTime finds a time of day in s, preferring a 12-hour time with AM or PM.
+func startTime(s string) (hour, minute int, ok bool) {
+	if m := clock12Regex.FindStringSubmatch(s); m != nil {
+		hour, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			minute, _ = strconv.Atoi(m[2])
+		}
+		hour %= 12
+		if strings.EqualFold(m[3], "p") {
+			hour += 12
+		}
+		return hour, minute, true
+	}
+	if m := clock24Regex.FindStringSubmatch(s); m != nil {
+		hour, _ = strconv.Atoi(m[1])
+		minute, _ = strconv.Atoi(m[2])
+		return hour, minute, true
+	}
+	return 0, 0, false
+}
+
+// HasStartTime reports whether t carries a meeting start time rather than just a date at midnight.
+func HasStartTime(t time.Time) bool {
+	return t.Hour() != 0 || t.Minute() != 0 || t.Second() != 0
+}
+
+// SameMeetingTime reports whether a and b are the same date and time of day as written, whatever their
+// locations. Dates recorded before documents carried a time zone are midnight UTC; they match the same date
+// read in DefaultLocation.
+func SameMeetingTime(a, b time.Time) bool {
+	return civil(a).Equal(civil(b))
+}
+
+// civil returns the date and time of day of t, as written, in UTC.
+func civil(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// calendarDay returns the date of t, as written, at midnight UTC.
+func calendarDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// OnOrAfter returns a FilterFunc for documents whose meeting is on or after t. A t at midnight stands for its
+// whole day: meetings on that date match, compared by the date each time was written with, so a date the
+// user typed and a meeting date agree whatever time zones they were read in. Otherwise meetings at or after
+// the instant t match.
+func OnOrAfter(t time.Time) FilterFunc {
+	dateOnly := !HasStartTime(t)
+	return func(docs []Document) []Document {
+		out := make([]Document, 0)
+		for _, doc := range docs {
+			if dateOnly && !calendarDay(doc.Date).Before(calendarDay(t)) || !dateOnly && !doc.Date.Before(t) {
+				out = append(out, doc)
+			}
+		}
+		return out
+	}
+}
+
+// OnOrBefore returns a FilterFunc for documents whose meeting is on or before t. A t at midnight stands for its
+// whole day, as for OnOrAfter; otherwise meetings at or before the instant t match.
+func OnOrBefore(t time.Time) FilterFunc {
+	dateOnly := !HasStartTime(t)
+	return func(docs []Document) []Document {
+		out := make([]Document, 0)
+		for _, doc := range docs {
+			if dateOnly && !calendarDay(doc.Date).After(calendarDay(t)) || !dateOnly && !doc.Date.After(t) {
+				out = append(out, doc)
+			}
+		}
+		return out
+	}
+}
@@ -0,0 +1,36 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoMeetingDate is wrapped by a ParseError when a listing title has no meeting date.
+var ErrNoMeetingDate = errors.New("could not find meeting date")
+
+// HTTPStatusError is returned when a server answers with a status other than 200 OK.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	// Status is the status line text, e.g. "404 Not Found".
+	Status string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return "unexpected status " + e.Status
+}
+
+// ParseError is returned when a listing entry can't be turned into a Document.
+type ParseError struct {
+	// Title is the listing title that failed to parse.
+	Title string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("scraper: parse title %q: %v", e.Title, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
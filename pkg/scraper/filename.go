@@ -0,0 +1,203 @@
+package scraper
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultFileNameTemplate is the file name schema ApplyFileNameSchema uses: one flat directory of
+// YYYY_MM_DD-CODE-name.ext files.
+const DefaultFileNameTemplate = "{date}-{meeting.code}-{name}{ext}"
+
+var defaultFileNameTemplate = MustParseFileNameTemplate(DefaultFileNameTemplate)
+
+// fileNameFields are the fields a FileNameTemplate can refer to. Each value is sanitized the same way as the
+// default schema, so any template yields names of lower-case letters, digits and underscores, plus the literal
+// text of the template.
+var fileNameFields = map[string]func(doc Document) string{
+	"year":  func(doc Document) string { return doc.Date.Format("2006") },
+	"month": func(doc Document) string { return doc.Date.Format("01") },
+	"day":   func(doc Document) string { return doc.Date.Format("02") },
+	"date":  func(doc Document) string { return doc.Date.Format("2006_01_02") },
+	"meeting.code": func(doc Document) string {
+		if code := normalizeMeetingCode(doc.Meeting.Code); code != "" {
+			return code
+		}
+		return "UNKNOWN"
+	},
+	"meeting.name": func(doc Document) string {
+		if name := normalizeFileSegment(doc.Meeting.Name); name != "" {
+			return name
+		}
+		return "unknown"
+	},
+	"name": func(doc Document) string {
+		base, _ := splitExt(doc.Name)
+		if name := normalizeFileSegment(base); name != "" {
+			return name
+		}
+		return "document"
+	},
+	"ext": func(doc Document) string {
+		_, ext := splitExt(doc.Name)
+		return ext
+	},
+	"role": func(doc Document) string { return doc.Role() },
+	"id": func(doc Document) string {
+		if doc.ID != "" {
+			return normalizeFileSegment(doc.ID)
+		}
+		return DocumentID(doc.Link)
+	},
+}
+
+// dateFields are the fields that need a meeting date.
+var dateFields = []string{"year", "month", "day", "date"}
+
+// FileNameTemplate names downloaded documents. A template is literal text with fields in braces, such as
+// "{year}/{meeting.code}/{date}-{role}-{name}.pdf"; slashes make directories. The fields are:
+//
+//	{year} {month} {day}  meeting date parts: 2024, 03, 15
+//	{date}                meeting date: 2024_03_15
+//	{meeting.code}        meeting type code: CC
+//	{meeting.name}        meeting type name: city_council
+//	{name}                document name without its extension: city_council_agenda
+//	{ext}                 lower-case extension with its dot, .pdf when the name has none
+//	{role}                what the document is, from its name: agenda, minutes, report, ...
+//	{id}                  the document ID
+type FileNameTemplate struct {
+	text  string
+	parts []templatePart
+	dated bool
+}
+
+// templatePart is either literal text or a field.
+type templatePart struct {
+	literal string
+	field   func(Document) string
+}
+
+// ParseFileNameTemplate parses a template. Literal text may contain letters, digits, '_', '-', '.' and '/';
+// the template must name a relative path inside the download directory.
+func ParseFileNameTemplate(text string) (*FileNameTemplate, error) {
+	t := &FileNameTemplate{text: text}
+	rest := text
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			open = len(rest)
+		}
+		if literal := rest[:open]; literal != "" {
+			if i := strings.IndexFunc(literal, func(r rune) bool { return !isTemplateLiteral(r) }); i >= 0 {
+				return nil, fmt.Errorf("scraper: file name template %q: character %q not allowed", text, literal[i])
+			}
+			t.parts = append(t.parts, templatePart{literal: literal})
+		}
+		rest = rest[open:]
+		if rest == "" {
+			break
+		}
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("scraper: file name template %q: unclosed {", text)
+		}
+		name := rest[1:end]
+		field, ok := fileNameFields[name]
+		if !ok {
+			return nil, fmt.Errorf("scraper: file name template %q: unknown field {%s}", text, name)
+		}
+		if slices.Contains(dateFields, name) {
+			t.dated = true
+		}
+		t.parts = append(t.parts, templatePart{field: field})
+		rest = rest[end+1:]
+	}
+	if len(t.parts) == 0 {
+		return nil, fmt.Errorf("scraper: file name template is empty")
+	}
+	for _, segment := range strings.Split(text, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("scraper: file name template %q: must be a relative path without empty, . or .. elements", text)
+		}
+	}
+	return t, nil
+}
+
+// MustParseFileNameTemplate is like ParseFileNameTemplate but panics if the template is invalid.
+func MustParseFileNameTemplate(text string) *FileNameTemplate {
+	t, err := ParseFileNameTemplate(text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// String returns the template text.
+func (t *FileNameTemplate) String() string {
+	return t.text
+}
+
+// Format returns the file name of doc, or "" when the template uses the meeting date and doc has none.
+func (t *FileNameTemplate) Format(doc Document) string {
+	if t.dated && doc.Date.IsZero() {
+		return ""
+	}
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.field != nil {
+			b.WriteString(part.field(doc))
+		} else {
+			b.WriteString(part.literal)
+		}
+	}
+	return b.String()
+}
+
+// ApplyFileNameTemplate sets the document file name using t.
+func (d *Document) ApplyFileNameTemplate(t *FileNameTemplate) {
+	d.FileName = t.Format(*d)
+}
+
+// documentRoles are the roles Role recognises, in the order it looks for them: an "Agenda Addendum" is an
+// addendum and "Minutes" that mention an agenda are minutes.
+var documentRoles = []struct{ role, word string }{
+	{"minutes", "minutes"},
+	{"addendum", "addendum"},
+	{"agenda", "agenda"},
+	{"bylaw", "bylaw"},
+	{"bylaw", "by_law"},
+	{"presentation", "presentation"},
+	{"correspondence", "correspondence"},
+	{"report", "report"},
+}
+
+// Role returns what the document is, judged from its name: minutes, addendum, agenda, bylaw, presentation,
+// correspondence, report, or document when the name says none of these.
+func (d Document) Role() string {
+	base, _ := splitExt(d.Name)
+	name := normalizeFileSegment(base)
+	for _, r := range documentRoles {
+		if strings.Contains(name, r.word) {
+			return r.role
+		}
+	}
+	return "document"
+}
+
+// splitExt splits a document name into its base and lower-case extension, defaulting the extension to .pdf.
+func splitExt(name string) (string, string) {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return name, ".pdf"
+	}
+	if len(name) > len(ext) {
+		name = name[:len(name)-len(ext)]
+	}
+	return name, ext
+}
+
+func isTemplateLiteral(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-./", r)
+}
@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// trackingParams are query parameters added for analytics, which don't change the document a link serves.
+// Parameters starting with utm_ are dropped as well.
+var trackingParams = []string{"fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid", "_ga", "_gl"}
+
+// CanonicalLink resolves href, as found on the page at base, to the absolute link a Document records:
+//
+//   - relative and protocol-relative hrefs are resolved against base, and dot segments removed
+//   - the scheme and host are lower-cased and a default port dropped
+//   - percent-encoding is normalized: escapes of letters, digits and -._~ are decoded, other escapes
+//     upper-cased, and characters that can't appear in a URL, such as spaces, escaped
+//   - the fragment and tracking query parameters such as utm_source are removed
+//   - http is upgraded to https when upgradeHTTPS is set
+func CanonicalLink(base *url.URL, href string, upgradeHTTPS bool) (string, error) {
+	ref, err := url.Parse(normalizeEscapes(strings.TrimSpace(href)))
+	if err != nil {
+		return "", fmt.Errorf("scraper: link %q: %w", href, err)
+	}
+	u := ref
+	if base != nil {
+		u = base.ResolveReference(ref)
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return "", fmt.Errorf("scraper: link %q: not an absolute URL", href)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if upgradeHTTPS && u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	u.Host = strings.ToLower(u.Host)
+	if host, port, err := net.SplitHostPort(u.Host); err == nil &&
+		(u.Scheme == "http" && port == "80" || u.Scheme == "https" && port == "443") {
+		u.Host = host
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]"
+		}
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = stripTracking(u.RawQuery)
+	u.ForceQuery = false
+	u.Fragment, u.RawFragment = "", ""
+	return u.String(), nil
+}
+
+// stripTracking removes tracking parameters from a raw query, leaving the others as they were.
+func stripTracking(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	kept := make([]string, 0)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		key = strings.ToLower(key)
+		if pair == "" || strings.HasPrefix(key, "utm_") || slices.Contains(trackingParams, key) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	return strings.Join(kept, "&")
+}
+
+// normalizeEscapes rewrites a URL string with escapes of unreserved characters decoded, other escapes in upper
+// case, and bytes that may not appear in a URL, including a '%' that starts no escape, escaped. Reserved
+// characters are left alone, so the URL keeps its structure.
+func normalizeEscapes(s string) string {
+	const reserved = ":/?#[]@!$&'()*+,;="
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			if v := unhex(s[i+1])<<4 | unhex(s[i+2]); isUnreserved(v) {
+				b.WriteByte(v)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+		case isUnreserved(c) || strings.IndexByte(reserved, c) >= 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
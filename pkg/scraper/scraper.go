@@ -2,6 +2,8 @@ package scraper
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -30,8 +32,11 @@ var (
 	Other   = MeetingType{Code: "Other", Name: "Other", SearchTerms: []string{"other", "inauguralmeetingofcitycouncil", "accountabilitytransparencyorientation"}}
 )
 
+// MeetingTypes lists the known meeting types in the order GetMeetingType matches them.
+var MeetingTypes = []MeetingType{CC, DHSC, Special, ETP, CSSC, Other}
+
 func (mt MeetingType) hasString(s string) bool {
-	return s == mt.Code || s == mt.Name || slices.Contains(mt.SearchTerms, s)
+	return strings.EqualFold(s, mt.Code) || s == normalizeMeetingName(mt.Name) || slices.Contains(mt.SearchTerms, s)
 }
 
 var searchRe = regexp.MustCompile(`[^a-zA-z0-9]+`)
@@ -66,47 +71,30 @@ func GetMeetingType(meeting string) MeetingType {
 
 // Document represents the metadata associated with a given upstream document.
 type Document struct {
-	Link     string      `json:"link"`
+	ID   string `json:"id,omitempty"`
+	Link string `json:"link"`
+	// RawLink is the href as written on the listing page, when it differs from the canonical Link.
+	RawLink  string      `json:"rawLink,omitempty"`
 	Name     string      `json:"name"`
 	Meeting  MeetingType `json:"meeting"`
 	Date     time.Time   `json:"date"`
 	RawTitle string      `json:"rawTitle"`
 	FileName string      `json:"fileName"`
 	Checksum string      `json:"checksum,omitempty"`
+	// Wards and Addresses are extracted from the document text; see the location package.
+	Wards     []int    `json:"wards,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
 }
 
-// ApplyFileNameSchema normalizes the document file name using the canonical schema.
-func (d *Document) ApplyFileNameSchema() {
-	d.FileName = buildDocumentFileName(*d)
+// DocumentID returns a stable identifier for the document at link.
+func DocumentID(link string) string {
+	sum := sha256.Sum256([]byte(link))
+	return hex.EncodeToString(sum[:8])
 }
 
-func buildDocumentFileName(doc Document) string {
-	if doc.Date.IsZero() {
-		return ""
-	}
-
-	code := normalizeMeetingCode(doc.Meeting.Code)
-	if code == "" {
-		code = "UNKNOWN"
-	}
-
-	baseName := doc.Name
-	ext := strings.ToLower(path.Ext(baseName))
-	if ext == "" {
-		ext = ".pdf"
-	}
-
-	if ext != "" && len(baseName) > len(ext) {
-		baseName = baseName[:len(baseName)-len(ext)]
-	}
-
-	nameSegment := normalizeFileSegment(baseName)
-	if nameSegment == "" {
-		nameSegment = "document"
-	}
-
-	dateSegment := doc.Date.Format("2006_01_02")
-	return fmt.Sprintf("%s-%s-%s%s", dateSegment, code, nameSegment, ext)
+// ApplyFileNameSchema normalizes the document file name using the canonical schema, DefaultFileNameTemplate.
+func (d *Document) ApplyFileNameSchema() {
+	d.ApplyFileNameTemplate(defaultFileNameTemplate)
 }
 
 func normalizeMeetingCode(code string) string {
@@ -150,6 +138,86 @@ func normalizeFileSegment(input string) string {
 	return out
 }
 
+// Meeting groups the documents posted for one meeting, identified by its type and date.
+type Meeting struct {
+	Type      MeetingType `json:"type"`
+	Date      time.Time   `json:"date"`
+	Title     string      `json:"title"`
+	Documents []Document  `json:"documents"`
+}
+
+// DuplicateSet is a group of documents at different links with identical content.
+type DuplicateSet struct {
+	Checksum  string     `json:"checksum"`
+	Meetings  int        `json:"meetings"`
+	Documents []Document `json:"documents"`
+}
+
+// Duplicates groups documents with the same checksum. Documents without a checksum are ignored. Sets with the
+// most documents come first.
+func Duplicates(docs []Document) []DuplicateSet {
+	index := make(map[string]int)
+	sets := make([]DuplicateSet, 0)
+	for _, doc := range docs {
+		if doc.Checksum == "" {
+			continue
+		}
+		i, ok := index[doc.Checksum]
+		if !ok {
+			i = len(sets)
+			index[doc.Checksum] = i
+			sets = append(sets, DuplicateSet{Checksum: doc.Checksum})
+		}
+		if !slices.ContainsFunc(sets[i].Documents, func(d Document) bool { return d.Link == doc.Link }) {
+			sets[i].Documents = append(sets[i].Documents, doc)
+		}
+	}
+
+	out := make([]DuplicateSet, 0)
+	for _, set := range sets {
+		if len(set.Documents) < 2 {
+			continue
+		}
+		set.Meetings = len(GroupMeetings(set.Documents))
+		out = append(out, set)
+	}
+	slices.SortStableFunc(out, func(a, b DuplicateSet) int {
+		if len(a.Documents) != len(b.Documents) {
+			return len(b.Documents) - len(a.Documents)
+		}
+		return strings.Compare(a.Checksum, b.Checksum)
+	})
+	return out
+}
+
+// GroupMeetings groups documents by meeting type and date, ordered by date and then meeting code.
+func GroupMeetings(docs []Document) []Meeting {
+	type key struct {
+		code string
+		date time.Time
+	}
+	index := make(map[key]int)
+	meetings := make([]Meeting, 0)
+	for _, doc := range docs {
+		// Group by the time as written, so dates recorded in UTC by older versions join the same meeting.
+		k := key{code: doc.Meeting.Code, date: civil(doc.Date)}
+		i, ok := index[k]
+		if !ok {
+			i = len(meetings)
+			index[k] = i
+			meetings = append(meetings, Meeting{Type: doc.Meeting, Date: doc.Date, Title: doc.RawTitle})
+		}
+		meetings[i].Documents = append(meetings[i].Documents, doc)
+	}
+	slices.SortStableFunc(meetings, func(a, b Meeting) int {
+		if c := a.Date.Compare(b.Date); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Type.Code, b.Type.Code)
+	})
+	return meetings
+}
+
 // FilterFunc is a function type that returns a subset of the input documents.
 type FilterFunc func([]Document) []Document
 
@@ -224,57 +292,99 @@ func ByStringInName(str string) FilterFunc {
 
 // GetDocuments fetches and parses data from the upstream and returns a slice of Document. It currently only supports PDFs.
 func GetDocuments(ctx context.Context) ([]Document, error) {
-	cards, err := getHtmlCards(ctx, http.DefaultClient)
+	return GetDocumentsWithClient(ctx, http.DefaultClient)
+}
+
+// GetDocumentsWithClient is GetDocuments with the listing fetched through client.
+func GetDocumentsWithClient(ctx context.Context, client *http.Client) ([]Document, error) {
+	return GetDocumentsWithOptions(ctx, Options{Client: client})
+}
+
+// Options configures GetDocumentsWithOptions.
+type Options struct {
+	// Client fetches the listing; it defaults to http.DefaultClient.
+	Client *http.Client
+	// Location is the time zone of the municipality. Meeting dates and start times in listing titles are read
+	// in it. It defaults to DefaultLocation.
+	Location *time.Location
+	// ListingURL is the page listing the meetings; it defaults to ListingURL. Relative links on it are resolved
+	// against it, or against its <base href> when it has one, after any redirects.
+	ListingURL string
+	// UpgradeHTTPS rewrites http document links to https.
+	UpgradeHTTPS bool
+}
+
+// GetDocumentsWithOptions is GetDocuments configured by opts. Document dates are in opts.Location: midnight
+// for meetings listed by date alone, or the start time when the title gives one.
+func GetDocumentsWithOptions(ctx context.Context, opts Options) ([]Document, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Location == nil {
+		opts.Location = DefaultLocation
+	}
+	if opts.ListingURL == "" {
+		opts.ListingURL = ListingURL
+	}
+	cards, base, err := getHtmlCards(ctx, opts.Client, opts.ListingURL)
 	if err != nil {
 		return nil, err
 	}
 
-	return getDocumentFromCards(cards)
+	return getDocumentFromCards(cards, base, opts)
 }
 
-// getDocumentFromCards returns a slice of Document from a slice of htmlCard.
-func getDocumentFromCards(cards []htmlCard) ([]Document, error) {
+// getDocumentFromCards returns a slice of Document from a slice of htmlCard, with links resolved against base.
+func getDocumentFromCards(cards []htmlCard, base *url.URL, opts Options) ([]Document, error) {
 	docs := make([]Document, 0)
 	for _, card := range cards {
-		for _, link := range card.Links {
+		for _, href := range card.Links {
 			title, err := url.PathUnescape(card.Title)
 			if err != nil {
 				title = card.Title
 			}
 
-			if path.Ext(link) == ".pdf" {
-				doc, err := parseDocument(link, title)
-				if err != nil {
-					return nil, err
+			link, err := CanonicalLink(base, href, opts.UpgradeHTTPS)
+			if err != nil {
+				// Links that aren't documents, such as mailto: or javascript:, needn't resolve.
+				if path.Ext(strings.TrimSpace(href)) != ".pdf" {
+					continue
 				}
-				docs = append(docs, doc)
+				return nil, err
+			}
+			u, err := url.Parse(link)
+			if err != nil || path.Ext(u.Path) != ".pdf" {
+				continue
+			}
+			doc, err := parseDocument(link, title, opts.Location)
+			if err != nil {
+				return nil, err
+			}
+			if href != link {
+				doc.RawLink = href
 			}
+			docs = append(docs, doc)
 		}
 	}
 	return docs, nil
 }
 
-var (
-	dateLayout = "Monday, January 2, 2006"
-	dateRegex  = regexp.MustCompile(`\b(?:Monday|Tuesday|Wednesday|Thursday|Friday|Saturday|Sunday),\s+(January|February|March|April|May|June|July|August|September|October|November|December)\s+\d{1,2},\s+\d{4}\b`)
-)
-
-// parseDocument returns a Document from a given htmlCard link and title
-func parseDocument(link string, title string) (Document, error) {
-	linkName := path.Base(link)
+// parseDocument returns a Document from a given htmlCard link and title, reading the meeting date in loc.
+func parseDocument(link string, title string, loc *time.Location) (Document, error) {
+	linkPath := link
+	if u, err := url.Parse(link); err == nil {
+		linkPath = u.EscapedPath()
+	}
+	linkName := path.Base(linkPath)
 	name, err := url.PathUnescape(linkName)
 	if err != nil {
 		name = linkName
 	}
 
 	meetingDate := strings.Split(title, " - ")
-	dateStr := dateRegex.FindString(title)
-	if dateStr == "" {
-		return Document{}, fmt.Errorf("scraper: could not find meeting date in title %q", title)
-	}
-	date, err := time.Parse(dateLayout, dateStr)
+	date, err := parseMeetingTime(title, loc)
 	if err != nil {
-		return Document{}, fmt.Errorf("scraper: parse meeting date %q: %w", dateStr, err)
+		return Document{}, &ParseError{Title: title, Err: err}
 	}
 
 	meetingName := title
@@ -283,6 +393,7 @@ func parseDocument(link string, title string) (Document, error) {
 	}
 	meeting := GetMeetingType(meetingName)
 	doc := Document{
+		ID:       DocumentID(link),
 		Link:     link,
 		Meeting:  meeting,
 		Name:     name,
@@ -294,27 +405,56 @@ func parseDocument(link string, title string) (Document, error) {
 	return doc, nil
 }
 
-// getHtmlCards performs a GET request to the upstream and returns a slice of htmlCard.
-func getHtmlCards(ctx context.Context, client *http.Client) ([]htmlCard, error) {
-	const meetingUrl = "https://opendata.citywindsor.ca/Tools/CouncilAgendas?returnUrl=https://citywindsor.ca/cityhall/City-Council-Meetings/Pages/default.aspx"
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meetingUrl, nil)
+// ListingURL is the upstream page listing council meetings and their documents.
+const ListingURL = "https://opendata.citywindsor.ca/Tools/CouncilAgendas?returnUrl=https://citywindsor.ca/cityhall/City-Council-Meetings/Pages/default.aspx"
+
+// getHtmlCards performs a GET request to listingURL and returns a slice of htmlCard, along with the URL their
+// links are relative to: the page URL after redirects, or its <base href>.
+func getHtmlCards(ctx context.Context, client *http.Client, listingURL string) ([]htmlCard, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listingURL, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("scraper: unexpected status code %s", resp.Status)
+		return nil, nil, fmt.Errorf("scraper: %w", &HTTPStatusError{URL: listingURL, StatusCode: resp.StatusCode, Status: resp.Status})
 	}
 
 	n, err := html.Parse(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	base := req.URL
+	if resp.Request != nil && resp.Request.URL != nil {
+		base = resp.Request.URL
+	}
+	if href := baseFromNodeRecursive(n); href != "" {
+		if u, err := base.Parse(normalizeEscapes(strings.TrimSpace(href))); err == nil {
+			base = u
+		}
+	}
+	return cardsFromNodeRecursive(n), base, nil
+}
+
+// baseFromNodeRecursive returns the href of the first <base> element, or "".
+func baseFromNodeRecursive(node *html.Node) string {
+	if node.Type == html.ElementNode && node.Data == "base" {
+		for _, attr := range node.Attr {
+			if attr.Key == "href" {
+				return attr.Val
+			}
+		}
+	}
+	for c := node.FirstChild; c != nil; c = c.NextSibling {
+		if href := baseFromNodeRecursive(c); href != "" {
+			return href
+		}
 	}
-	return cardsFromNodeRecursive(n), nil
+	return ""
 }
 
 // htmlCard is a html.Node with an extracted title and slice of links
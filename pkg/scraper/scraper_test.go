@@ -1,6 +1,13 @@
 package scraper
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
 	"testing"
 	"time"
 )
@@ -38,3 +45,258 @@ func TestApplyFileNameSchemaWithFallbacks(t *testing.T) {
 		t.Fatalf("ApplyFileNameSchema fallback => %q, want %q", doc.FileName, want)
 	}
 }
+
+func TestFileNameTemplate(t *testing.T) {
+	doc := Document{
+		ID:      "3f1c9a0b2d4e5f60",
+		Name:    "Revised Agenda Addendum (2).PDF",
+		Meeting: DHSC,
+		Date:    time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC),
+	}
+	for _, tc := range []struct{ template, want string }{
+		{DefaultFileNameTemplate, "2024_03_05-DHSC-revised_agenda_addendum_2.pdf"},
+		{"{year}/{meeting.code}/{date}-{role}-{name}.pdf", "2024/DHSC/2024_03_05-addendum-revised_agenda_addendum_2.pdf"},
+		{"{meeting.name}/{year}-{month}-{day}_{id}{ext}", "development_heritage_standing_committee/2024-03-05_3f1c9a0b2d4e5f60.pdf"},
+	} {
+		tmpl, err := ParseFileNameTemplate(tc.template)
+		if err != nil {
+			t.Fatalf("ParseFileNameTemplate(%q): %v", tc.template, err)
+		}
+		if got := tmpl.Format(doc); got != tc.want {
+			t.Fatalf("Format(%q) => %q, want %q", tc.template, got, tc.want)
+		}
+	}
+
+	undated := MustParseFileNameTemplate("{year}/{name}{ext}")
+	if got := undated.Format(Document{Name: "a.pdf"}); got != "" {
+		t.Fatalf("Format without a date => %q, want empty", got)
+	}
+
+	for _, bad := range []string{"", "{nope}.pdf", "{name", "/{name}.pdf", "../{name}.pdf", "{year}//{name}.pdf", "{name} copy.pdf"} {
+		if _, err := ParseFileNameTemplate(bad); err == nil {
+			t.Fatalf("ParseFileNameTemplate(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestRole(t *testing.T) {
+	for name, want := range map[string]string{
+		"City Council Agenda.pdf":        "agenda",
+		"Agenda Addendum.pdf":            "addendum",
+		"Minutes - Regular Meeting.pdf":  "minutes",
+		"By-law 12-2024.pdf":             "bylaw",
+		"Delegation Presentation.pdf":    "presentation",
+		"Administrative Report S 12.pdf": "report",
+		"Notice.pdf":                     "document",
+	} {
+		if got := (Document{Name: name}).Role(); got != want {
+			t.Fatalf("Role(%q) => %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestGetMeetingType(t *testing.T) {
+	for _, input := range []string{"CC", "cc", "City Council", "City Council Meeting"} {
+		if got := GetMeetingType(input); got.Code != CC.Code {
+			t.Fatalf("GetMeetingType(%q) => %q, want %q", input, got.Code, CC.Code)
+		}
+	}
+	if got := GetMeetingType("Development & Heritage Standing Committee"); got.Code != DHSC.Code {
+		t.Fatalf("GetMeetingType(DHSC name) => %q, want %q", got.Code, DHSC.Code)
+	}
+}
+
+func TestGroupMeetings(t *testing.T) {
+	march := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, time.February, 7, 0, 0, 0, 0, time.UTC)
+	docs := []Document{
+		{Name: "agenda.pdf", Meeting: CC, Date: march},
+		{Name: "agenda.pdf", Meeting: DHSC, Date: feb},
+		{Name: "minutes.pdf", Meeting: CC, Date: march},
+	}
+
+	meetings := GroupMeetings(docs)
+	if len(meetings) != 2 {
+		t.Fatalf("expected 2 meetings, got %d", len(meetings))
+	}
+	if meetings[0].Type.Code != DHSC.Code || meetings[1].Type.Code != CC.Code {
+		t.Fatalf("meetings not ordered by date: %+v", meetings)
+	}
+	if len(meetings[1].Documents) != 2 {
+		t.Fatalf("expected 2 documents for the council meeting, got %d", len(meetings[1].Documents))
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	march := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, time.February, 7, 0, 0, 0, 0, time.UTC)
+	docs := []Document{
+		{Link: "https://example.invalid/a.pdf", Meeting: CC, Date: march, Checksum: "aaa"},
+		{Link: "https://example.invalid/b.pdf", Meeting: DHSC, Date: feb, Checksum: "aaa"},
+		{Link: "https://example.invalid/c.pdf", Meeting: CC, Date: march, Checksum: "ccc"},
+		{Link: "https://example.invalid/c.pdf", Meeting: CC, Date: march, Checksum: "ccc"},
+		{Link: "https://example.invalid/d.pdf", Meeting: CC, Date: march},
+		{Link: "https://example.invalid/e.pdf", Meeting: CC, Date: march},
+	}
+
+	sets := Duplicates(docs)
+	if len(sets) != 1 {
+		t.Fatalf("expected 1 duplicate set, got %+v", sets)
+	}
+	if sets[0].Checksum != "aaa" || len(sets[0].Documents) != 2 || sets[0].Meetings != 2 {
+		t.Fatalf("unexpected duplicate set: %+v", sets[0])
+	}
+}
+
+func TestParseDocumentErrors(t *testing.T) {
+	_, err := parseDocument("https://example.org/agenda.pdf", "City Council - Agenda", DefaultLocation)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Title != "City Council - Agenda" || !errors.Is(err, ErrNoMeetingDate) {
+		t.Fatalf("expected a ParseError wrapping ErrNoMeetingDate, got %v", err)
+	}
+
+	doc, err := parseDocument("https://example.org/Agenda%201.pdf", "City Council - Monday, March 4, 2024", DefaultLocation)
+	if err != nil || doc.Name != "Agenda 1.pdf" || doc.Meeting.Code != "CC" {
+		t.Fatalf("parseDocument = %+v, %v", doc, err)
+	}
+}
+
+func TestParseMeetingTime(t *testing.T) {
+	for title, want := range map[string]time.Time{
+		"City Council - Monday, March 4, 2024":                 time.Date(2024, time.March, 4, 0, 0, 0, 0, DefaultLocation),
+		"City Council - Monday, March 4, 2024 - 6:00 PM":       time.Date(2024, time.March, 4, 18, 0, 0, 0, DefaultLocation),
+		"City Council - Monday, March 4, 2024 at 6 p.m.":       time.Date(2024, time.March, 4, 18, 0, 0, 0, DefaultLocation),
+		"DHSC - Wednesday, July 10, 2024, 4:30pm":              time.Date(2024, time.July, 10, 16, 30, 0, 0, DefaultLocation),
+		"Special Meeting 9:00 - Friday, November 1, 2024":      time.Date(2024, time.November, 1, 9, 0, 0, 0, DefaultLocation),
+		"Special Meeting - Friday, November 1, 2024 - 12 a.m.": time.Date(2024, time.November, 1, 0, 0, 0, 0, DefaultLocation),
+		"Item 5 Amendments - Monday, March 4, 2024":            time.Date(2024, time.March, 4, 0, 0, 0, 0, DefaultLocation),
+	} {
+		got, err := parseMeetingTime(title, DefaultLocation)
+		if err != nil {
+			t.Fatalf("parseMeetingTime(%q): %v", title, err)
+		}
+		if !got.Equal(want) || got.Location() != DefaultLocation {
+			t.Fatalf("parseMeetingTime(%q) = %v, want %v", title, got, want)
+		}
+	}
+}
+
+func TestDateFilters(t *testing.T) {
+	docs := []Document{
+		// Recorded by an older version, as midnight UTC.
+		{Name: "legacy.pdf", Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)},
+		{Name: "evening.pdf", Date: time.Date(2024, time.March, 5, 21, 0, 0, 0, DefaultLocation)},
+		{Name: "next.pdf", Date: time.Date(2024, time.March, 6, 0, 0, 0, 0, DefaultLocation)},
+	}
+	names := func(docs []Document) []string {
+		out := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			out = append(out, doc.Name)
+		}
+		return out
+	}
+	day := func(d int) time.Time { return time.Date(2024, time.March, d, 0, 0, 0, 0, DefaultLocation) }
+
+	for _, tc := range []struct {
+		filter FilterFunc
+		want   []string
+	}{
+		// 9 p.m. in Windsor on March 5 is already March 6 in UTC; it still falls on March 5.
+		{OnOrBefore(day(5)), []string{"legacy.pdf", "evening.pdf"}},
+		{OnOrAfter(day(5)), []string{"evening.pdf", "next.pdf"}},
+		{OnOrAfter(day(4)), []string{"legacy.pdf", "evening.pdf", "next.pdf"}},
+		{OnOrBefore(time.Date(2024, time.March, 5, 12, 0, 0, 0, DefaultLocation)), []string{"legacy.pdf"}},
+		{OnOrAfter(time.Date(2024, time.March, 5, 21, 0, 0, 0, DefaultLocation)), []string{"evening.pdf", "next.pdf"}},
+	} {
+		if got := names(tc.filter(docs)); !slices.Equal(got, tc.want) {
+			t.Fatalf("filter => %v, want %v", got, tc.want)
+		}
+	}
+
+	if !SameMeetingTime(docs[0].Date, day(4)) || SameMeetingTime(docs[1].Date, day(5)) {
+		t.Fatalf("SameMeetingTime compares the date and time as written")
+	}
+}
+
+func TestCanonicalLink(t *testing.T) {
+	base, _ := url.Parse("https://opendata.citywindsor.ca/Tools/CouncilAgendas?returnUrl=x")
+	for _, tc := range []struct {
+		href    string
+		upgrade bool
+		want    string
+	}{
+		{"/Agendas/2024/foo.pdf", false, "https://opendata.citywindsor.ca/Agendas/2024/foo.pdf"},
+		{"Agendas/../Docs/./foo.pdf", false, "https://opendata.citywindsor.ca/Tools/Docs/foo.pdf"},
+		{"//Citywindsor.CA:443/a.pdf", false, "https://citywindsor.ca/a.pdf"},
+		{"http://citywindsor.ca:80/a.pdf", false, "http://citywindsor.ca/a.pdf"},
+		{"http://citywindsor.ca/a.pdf", true, "https://citywindsor.ca/a.pdf"},
+		{" /a/Agenda (1).pdf ", false, "https://opendata.citywindsor.ca/a/Agenda%20(1).pdf"},
+		{"/a/Agenda%20(1).pdf", false, "https://opendata.citywindsor.ca/a/Agenda%20(1).pdf"},
+		{"/a/%7euser/r%c3%a9sum%C3%A9.pdf", false, "https://opendata.citywindsor.ca/a/~user/r%C3%A9sum%C3%A9.pdf"},
+		{"/a/résumé.pdf", false, "https://opendata.citywindsor.ca/a/r%C3%A9sum%C3%A9.pdf"},
+		{"/a/100%.pdf", false, "https://opendata.citywindsor.ca/a/100%25.pdf"},
+		{"/a.pdf?id=7&utm_source=mail&fbclid=x&v=2#page=3", false, "https://opendata.citywindsor.ca/a.pdf?id=7&v=2"},
+		{"/a.pdf?utm_campaign=x#top", false, "https://opendata.citywindsor.ca/a.pdf"},
+	} {
+		got, err := CanonicalLink(base, tc.href, tc.upgrade)
+		if err != nil || got != tc.want {
+			t.Errorf("CanonicalLink(%q) = %q, %v, want %q", tc.href, got, err, tc.want)
+		}
+	}
+	if _, err := CanonicalLink(nil, "/a.pdf", false); err == nil {
+		t.Errorf("CanonicalLink of a relative link without a base succeeded")
+	}
+}
+
+func TestGetDocumentsResolvesLinks(t *testing.T) {
+	page := `<html><head>%s</head><body>
+<div class="CA_CouncilAgenda"><strong>City Council - Monday, March 4, 2024</strong>
+<a href="/Agendas/2024/Agenda%%201.pdf">Agenda</a>
+<a href="minutes.pdf#page=2">Minutes</a>
+<a href="//docs.example.org/report.pdf?utm_source=site">Report</a>
+<a href="mailto:clerks@example.org">Email</a>
+<a href="https://example.org/Agendas/2024/Agenda%%201.pdf">Same agenda</a>
+</div></body></html>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/Tools/CouncilAgendas", http.StatusFound)
+		case "/based":
+			fmt.Fprintf(w, page, `<base href="https://example.org/Clerks/">`)
+		default:
+			fmt.Fprintf(w, page, "")
+		}
+	}))
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	docs, err := GetDocumentsWithOptions(context.Background(), Options{Client: srv.Client(), ListingURL: srv.URL + "/old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ link, raw string }{
+		{"http://" + host + "/Agendas/2024/Agenda%201.pdf", "/Agendas/2024/Agenda%201.pdf"},
+		{"http://" + host + "/Tools/minutes.pdf", "minutes.pdf#page=2"},
+		{"http://docs.example.org/report.pdf", "//docs.example.org/report.pdf?utm_source=site"},
+		{"https://example.org/Agendas/2024/Agenda%201.pdf", ""},
+	}
+	if len(docs) != len(want) {
+		t.Fatalf("got %d documents, want %d: %+v", len(docs), len(want), docs)
+	}
+	for i, w := range want {
+		if docs[i].Link != w.link || docs[i].RawLink != w.raw || docs[i].ID != DocumentID(w.link) {
+			t.Errorf("document %d: link %q raw %q, want %q raw %q", i, docs[i].Link, docs[i].RawLink, w.link, w.raw)
+		}
+	}
+	if docs[0].Name != "Agenda 1.pdf" {
+		t.Errorf("name = %q, want Agenda 1.pdf", docs[0].Name)
+	}
+
+	docs, err = GetDocumentsWithOptions(context.Background(), Options{Client: srv.Client(), ListingURL: srv.URL + "/based", UpgradeHTTPS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 4 || docs[1].Link != "https://example.org/Clerks/minutes.pdf" || docs[2].Link != "https://docs.example.org/report.pdf" {
+		t.Fatalf("links with <base> and UpgradeHTTPS: %+v", docs)
+	}
+}
@@ -0,0 +1,515 @@
+// Package server exposes the document catalogue as a JSON HTTP API.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/daterange"
+	"github.com/dntiontk/civic-code/pkg/feed"
+	"github.com/dntiontk/civic-code/pkg/ical"
+	"github.com/dntiontk/civic-code/pkg/location"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+	"github.com/itlightning/dateparse"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// FetchFunc returns the current catalogue. It is called on every refresh.
+type FetchFunc func(ctx context.Context) ([]scraper.Document, error)
+
+// Config configures a Server.
+type Config struct {
+	// DownloadDir is the directory PDFs are served from.
+	DownloadDir string
+	// Fetch loads the catalogue; it defaults to scraper.GetDocuments.
+	Fetch FetchFunc
+	// RefreshInterval is the time between background refreshes; zero disables them.
+	RefreshInterval time.Duration
+	// FirstSeenPath, when set, persists when each document was first observed so feed entries keep their
+	// timestamps across restarts.
+	FirstSeenPath string
+	// Location is the time zone dates in query parameters are read in and calendars are written in; it defaults
+	// to scraper.DefaultLocation.
+	Location *time.Location
+	// BaseURL is the public URL of the server, e.g. "https://council.example.org", that feeds link to. When it is
+	// empty, links use the scheme and Host of each request.
+	BaseURL string
+	// TrustProxy takes the scheme and host of requests without a BaseURL from the X-Forwarded-Proto and
+	// X-Forwarded-Host headers. Set it only behind a reverse proxy that sets them, since any client can.
+	TrustProxy bool
+}
+
+// Server serves the document catalogue and keeps it up to date.
+type Server struct {
+	cfg Config
+
+	// update serializes SetDocuments, so the first-seen times each call builds on are the latest, while mu is
+	// only held to swap in the new state.
+	update    sync.Mutex
+	mu        sync.RWMutex
+	docs      []scraper.Document
+	byID      map[string]int
+	refreshed time.Time
+	firstSeen feed.FirstSeen
+}
+
+// New returns a Server with an empty catalogue; call Refresh or Run to load it.
+func New(cfg Config) *Server {
+	if cfg.Fetch == nil {
+		cfg.Fetch = scraper.GetDocuments
+	}
+	if cfg.Location == nil {
+		cfg.Location = scraper.DefaultLocation
+	}
+	firstSeen := feed.FirstSeen{}
+	if cfg.FirstSeenPath != "" {
+		loaded, err := feed.LoadFirstSeen(cfg.FirstSeenPath)
+		if err != nil {
+			log.Printf("server: %v", err)
+		} else {
+			firstSeen = loaded
+		}
+	}
+	return &Server{cfg: cfg, byID: make(map[string]int), firstSeen: firstSeen}
+}
+
+// SetDocuments replaces the catalogue.
+func (s *Server) SetDocuments(docs []scraper.Document) {
+	byID := make(map[string]int, len(docs))
+	sorted := slices.Clone(docs)
+	for i := range sorted {
+		if sorted[i].ID == "" {
+			sorted[i].ID = scraper.DocumentID(sorted[i].Link)
+		}
+	}
+	slices.SortStableFunc(sorted, func(a, b scraper.Document) int {
+		return b.Date.Compare(a.Date)
+	})
+	for i, doc := range sorted {
+		byID[doc.ID] = i
+	}
+
+	s.update.Lock()
+	defer s.update.Unlock()
+	s.mu.RLock()
+	firstSeen := maps.Clone(s.firstSeen)
+	s.mu.RUnlock()
+	if firstSeen == nil {
+		firstSeen = feed.FirstSeen{}
+	}
+	refreshed := time.Now()
+	firstSeen.Observe(sorted, refreshed)
+	// Save outside mu, so requests aren't held up by file I/O.
+	if s.cfg.FirstSeenPath != "" {
+		if err := firstSeen.Save(s.cfg.FirstSeenPath); err != nil {
+			log.Printf("server: save first-seen times: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.docs = sorted
+	s.byID = byID
+	s.refreshed = refreshed
+	s.firstSeen = firstSeen
+	s.mu.Unlock()
+}
+
+// Documents returns the current catalogue, newest first.
+func (s *Server) Documents() []scraper.Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.docs
+}
+
+// Refresh fetches the catalogue and replaces the current one. On error the current catalogue is kept.
+func (s *Server) Refresh(ctx context.Context) error {
+	docs, err := s.cfg.Fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("server: refresh: %w", err)
+	}
+	s.SetDocuments(docs)
+	log.Printf("server: catalogue refreshed with %d documents", len(docs))
+	return nil
+}
+
+// Run refreshes the catalogue every RefreshInterval until ctx is done.
+func (s *Server) Run(ctx context.Context) {
+	if s.cfg.RefreshInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+}
+
+// Handler returns the HTTP handler for the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /documents", s.handleList)
+	mux.HandleFunc("GET /documents/{id}", s.handleGet)
+	mux.HandleFunc("GET /documents/{id}/pdf", s.handlePDF)
+	mux.HandleFunc("GET /search", s.handleSearch)
+	mux.HandleFunc("GET /meeting-types", s.handleMeetingTypes)
+	mux.HandleFunc("GET /feeds/{file}", s.handleFeed)
+	mux.HandleFunc("GET /feeds/{code}/{file}", s.handleFeed)
+	mux.HandleFunc("GET /calendar.ics", s.handleCalendar)
+	mux.HandleFunc("GET /calendar/{file}", s.handleCalendar)
+	return mux
+}
+
+// Page is a paginated list of documents.
+type Page struct {
+	Len   int                `json:"len"`
+	Total int                `json:"total"`
+	Page  int                `json:"page"`
+	Pages int                `json:"pages"`
+	Limit int                `json:"limit"`
+	Items []scraper.Document `json:"items"`
+}
+
+// errorBody is the JSON body of error responses.
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filters, err := Filters(q, s.cfg.Location)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	docs := s.Documents()
+	for _, filter := range filters {
+		docs = filter(docs)
+	}
+	s.writePage(w, r, docs)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	if query == "" {
+		writeError(w, r, http.StatusBadRequest, errors.New("missing q parameter"))
+		return
+	}
+	docs := make([]scraper.Document, 0)
+	for _, doc := range s.Documents() {
+		if matchesQuery(doc, query) {
+			docs = append(docs, doc)
+		}
+	}
+	s.writePage(w, r, docs)
+}
+
+// matchesQuery reports whether every word of query appears in the name, title, meeting or addresses of doc.
+func matchesQuery(doc scraper.Document, query string) bool {
+	haystack := strings.ToLower(strings.Join(append([]string{
+		doc.Name, doc.RawTitle, doc.Meeting.Code, doc.Meeting.Name,
+	}, doc.Addresses...), " "))
+	for _, word := range strings.Fields(query) {
+		if !strings.Contains(haystack, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, docs []scraper.Document) {
+	q := r.URL.Query()
+	page, err := intParam(q, "page", 1)
+	if err != nil || page < 1 {
+		writeError(w, r, http.StatusBadRequest, fmt.Errorf("invalid page %q", q.Get("page")))
+		return
+	}
+	limit, err := intParam(q, "limit", defaultLimit)
+	if err != nil || limit < 1 {
+		writeError(w, r, http.StatusBadRequest, fmt.Errorf("invalid limit %q", q.Get("limit")))
+		return
+	}
+	limit = min(limit, maxLimit)
+
+	start := min((page-1)*limit, len(docs))
+	end := min(start+limit, len(docs))
+	items := docs[start:end]
+	writeJSON(w, r, http.StatusOK, Page{
+		Len:   len(items),
+		Total: len(docs),
+		Page:  page,
+		Pages: (len(docs) + limit - 1) / limit,
+		Limit: limit,
+		Items: items,
+	})
+}
+
+func (s *Server) lookup(id string) (scraper.Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.byID[id]
+	if !ok {
+		return scraper.Document{}, false
+	}
+	return s.docs[i], true
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	doc, ok := s.lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, errors.New("document not found"))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, doc)
+}
+
+func (s *Server) handlePDF(w http.ResponseWriter, r *http.Request) {
+	doc, ok := s.lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, errors.New("document not found"))
+		return
+	}
+	name := filepath.FromSlash(doc.FileName)
+	if doc.FileName == "" || s.cfg.DownloadDir == "" || !filepath.IsLocal(name) {
+		writeError(w, r, http.StatusNotFound, errors.New("document has not been downloaded"))
+		return
+	}
+
+	f, err := os.Open(filepath.Join(s.cfg.DownloadDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, r, http.StatusNotFound, errors.New("document has not been downloaded"))
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if doc.Checksum != "" {
+		w.Header().Set("ETag", strconv.Quote(doc.Checksum))
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", path.Base(doc.FileName)))
+	http.ServeContent(w, r, doc.FileName, info.ModTime(), f)
+}
+
+func (s *Server) handleMeetingTypes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, scraper.MeetingTypes)
+}
+
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	render, contentType := feed.Atom, "application/atom+xml"
+	switch r.PathValue("file") {
+	case "atom.xml":
+	case "rss.xml":
+		render, contentType = feed.RSS, "application/rss+xml"
+	default:
+		writeError(w, r, http.StatusNotFound, errors.New("unknown feed"))
+		return
+	}
+
+	opts := feed.Options{BaseURL: s.baseURL(r) + "/feeds"}
+	if code := r.PathValue("code"); code != "" {
+		opts.MeetingType = scraper.GetMeetingType(code)
+		if opts.MeetingType.Code == "Unknown" {
+			writeError(w, r, http.StatusNotFound, fmt.Errorf("unknown meeting type %q", code))
+			return
+		}
+	}
+
+	s.mu.RLock()
+	opts.FirstSeen = maps.Clone(s.firstSeen)
+	docs := s.docs
+	s.mu.RUnlock()
+
+	data, err := render(docs, opts)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	writeBody(w, r, http.StatusOK, contentType+"; charset=utf-8", data)
+}
+
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	docs := s.Documents()
+	if file := r.PathValue("file"); file != "" {
+		code, ok := strings.CutSuffix(file, ".ics")
+		mt := scraper.GetMeetingType(code)
+		if !ok || mt.Code == "Unknown" {
+			writeError(w, r, http.StatusNotFound, fmt.Errorf("unknown calendar %q", file))
+			return
+		}
+		docs = scraper.ByMeetingType(mt)(docs)
+	}
+
+	// Stamp events with the refresh time so the body, and its ETag, only change when the catalogue does.
+	s.mu.RLock()
+	refreshed := s.refreshed
+	s.mu.RUnlock()
+
+	data, err := ical.Calendar(scraper.GroupMeetings(docs), ical.Options{Location: s.cfg.Location, Now: refreshed})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	writeBody(w, r, http.StatusOK, "text/calendar; charset=utf-8", data)
+}
+
+// baseURL returns the configured BaseURL, or else the scheme and host the request was addressed to.
+func (s *Server) baseURL(r *http.Request) string {
+	if s.cfg.BaseURL != "" {
+		return strings.TrimSuffix(s.cfg.BaseURL, "/")
+	}
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if s.cfg.TrustProxy {
+		// A chain of proxies lists a value per hop; the first is what the client asked for.
+		first := func(name string) string {
+			v, _, _ := strings.Cut(r.Header.Get(name), ",")
+			return strings.TrimSpace(v)
+		}
+		if proto := first("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwd := first("X-Forwarded-Host"); fwd != "" {
+			host = fwd
+		}
+	}
+	return scheme + "://" + host
+}
+
+// Filters builds FilterFuncs from the same parameters as the doc-search flags: year, before, after, range,
+// meetingType, docName, ward and address. Dates and ranges are read in loc. A range of since-last-run is
+// refused; the server keeps no runs.
+func Filters(q url.Values, loc *time.Location) ([]scraper.FilterFunc, error) {
+	filters := make([]scraper.FilterFunc, 0)
+	if v := q.Get("year"); v != "" {
+		year, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid year %q", v)
+		}
+		filters = append(filters, scraper.ByYear(year))
+	}
+	if v := q.Get("before"); v != "" {
+		before, err := dateparse.ParseIn(v, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid before %q: %w", v, err)
+		}
+		filters = append(filters, scraper.OnOrBefore(before))
+	}
+	if v := q.Get("after"); v != "" {
+		after, err := dateparse.ParseIn(v, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid after %q: %w", v, err)
+		}
+		filters = append(filters, scraper.OnOrAfter(after))
+	}
+	if v := q.Get("range"); v != "" {
+		r, err := daterange.Parse(v, daterange.Options{Location: loc})
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %w", v, err)
+		}
+		filters = append(filters, r.Filters()...)
+	}
+	if v := q.Get("meetingType"); v != "" {
+		filters = append(filters, scraper.ByMeetingType(scraper.GetMeetingType(v)))
+	}
+	if v := q.Get("docName"); v != "" {
+		filters = append(filters, scraper.ByStringInName(v))
+	}
+	if v := q.Get("ward"); v != "" {
+		ward, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ward %q", v)
+		}
+		filters = append(filters, location.ByWard(ward))
+	}
+	if v := q.Get("address"); v != "" {
+		filters = append(filters, location.ByAddress(v))
+	}
+	return filters, nil
+}
+
+func intParam(q url.Values, key string, def int) (int, error) {
+	v := q.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// writeJSON encodes v and writes it with writeBody.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeBody(w, r, status, "application/json", buf.Bytes())
+}
+
+// writeBody writes body with a strong ETag, answering conditional requests with 304.
+func writeBody(w http.ResponseWriter, r *http.Request, status int, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", contentType)
+	if status == http.StatusOK && etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	writeJSON(w, r, status, errorBody{Error: err.Error()})
+}
+
+// etagMatches reports whether an If-None-Match header matches etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
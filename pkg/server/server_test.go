@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/feed"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+func newTestServer(t *testing.T, dir string) *httptest.Server {
+	t.Helper()
+	docs := []scraper.Document{
+		{Link: "https://example.invalid/a.pdf", Name: "a.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)},
+		{Link: "https://example.invalid/b.pdf", Name: "b.pdf", Meeting: scraper.DHSC, Date: time.Date(2024, time.February, 7, 0, 0, 0, 0, time.UTC)},
+		{Link: "https://example.invalid/c.pdf", Name: "c.pdf", Meeting: scraper.CC, Date: time.Date(2023, time.May, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for i := range docs {
+		docs[i].ApplyFileNameSchema()
+	}
+
+	s := New(Config{
+		DownloadDir: dir,
+		Fetch: func(context.Context) ([]scraper.Document, error) {
+			return docs, nil
+		},
+	})
+	if err := s.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh returned error: %v", err)
+	}
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func getJSON(t *testing.T, url string, v any) *http.Response {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s: %v", url, err)
+		}
+	}
+	return resp
+}
+
+func TestListDocuments(t *testing.T) {
+	srv := newTestServer(t, t.TempDir())
+
+	var page Page
+	getJSON(t, srv.URL+"/documents?meetingType=CC&limit=1", &page)
+	if page.Total != 2 || page.Pages != 2 || page.Len != 1 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if page.Items[0].Name != "a.pdf" {
+		t.Fatalf("expected newest document first, got %q", page.Items[0].Name)
+	}
+
+	getJSON(t, srv.URL+"/documents?meetingType=CC&limit=1&page=2", &page)
+	if page.Len != 1 || page.Items[0].Name != "c.pdf" {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+
+	if resp := getJSON(t, srv.URL+"/documents?year=abc", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid year, got %d", resp.StatusCode)
+	}
+}
+
+func TestETag(t *testing.T) {
+	srv := newTestServer(t, t.TempDir())
+
+	resp := getJSON(t, srv.URL+"/documents", nil)
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("expected ETag header")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/documents", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("conditional GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", resp.StatusCode)
+	}
+}
+
+func TestGetDocumentAndPDF(t *testing.T) {
+	dir := t.TempDir()
+	srv := newTestServer(t, dir)
+	id := scraper.DocumentID("https://example.invalid/a.pdf")
+
+	var doc scraper.Document
+	getJSON(t, srv.URL+"/documents/"+id, &doc)
+	if doc.Name != "a.pdf" {
+		t.Fatalf("unexpected document: %+v", doc)
+	}
+
+	if resp := getJSON(t, srv.URL+"/documents/"+id+"/pdf", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 before download, got %d", resp.StatusCode)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, doc.FileName), []byte("%PDF-1.4"), 0o644); err != nil {
+		t.Fatalf("write pdf: %v", err)
+	}
+	resp, err := http.Get(srv.URL + "/documents/" + id + "/pdf")
+	if err != nil {
+		t.Fatalf("GET pdf: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "%PDF-1.4" {
+		t.Fatalf("unexpected pdf response: %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Type") != "application/pdf" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	if resp := getJSON(t, srv.URL+"/documents/missing", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown id, got %d", resp.StatusCode)
+	}
+}
+
+func TestSearchAndMeetingTypes(t *testing.T) {
+	srv := newTestServer(t, t.TempDir())
+
+	var page Page
+	getJSON(t, srv.URL+"/search?q=development+b.pdf", &page)
+	if page.Total != 1 || page.Items[0].Name != "b.pdf" {
+		t.Fatalf("unexpected search results: %+v", page)
+	}
+
+	var types []scraper.MeetingType
+	getJSON(t, srv.URL+"/meeting-types", &types)
+	if len(types) != len(scraper.MeetingTypes) {
+		t.Fatalf("expected %d meeting types, got %d", len(scraper.MeetingTypes), len(types))
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	srv := newTestServer(t, t.TempDir())
+
+	for path, contentType := range map[string]string{
+		"/feeds/atom.xml":      "application/atom+xml; charset=utf-8",
+		"/feeds/cc/rss.xml":    "application/rss+xml; charset=utf-8",
+		"/feeds/dhsc/atom.xml": "application/atom+xml; charset=utf-8",
+	} {
+		resp := getJSON(t, srv.URL+path, nil)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentType {
+			t.Fatalf("GET %s => %d %q", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+	}
+
+	if resp := getJSON(t, srv.URL+"/feeds/nope/atom.xml", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown meeting type, got %d", resp.StatusCode)
+	}
+}
+
+func TestFeedBaseURL(t *testing.T) {
+	forwarded := http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"council.example.org, proxy.internal"}}
+	for name, tc := range map[string]struct {
+		cfg    Config
+		header http.Header
+		want   string
+	}{
+		"request":              {want: "http://example.com/feeds/atom.xml"},
+		"forwarded, untrusted": {header: forwarded, want: "http://example.com/feeds/atom.xml"},
+		"forwarded, trusted":   {cfg: Config{TrustProxy: true}, header: forwarded, want: "https://council.example.org/feeds/atom.xml"},
+		"configured":           {cfg: Config{BaseURL: "https://docs.example.org/", TrustProxy: true}, header: forwarded, want: "https://docs.example.org/feeds/atom.xml"},
+	} {
+		s := New(tc.cfg)
+		s.SetDocuments([]scraper.Document{{Link: "https://example.invalid/a.pdf", Name: "a.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)}})
+		req := httptest.NewRequest(http.MethodGet, "/feeds/atom.xml", nil)
+		maps.Copy(req.Header, tc.header)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), `href="`+tc.want+`"`) {
+			t.Errorf("%s: feed doesn't link %s:\n%s", name, tc.want, rec.Body)
+		}
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	srv := newTestServer(t, t.TempDir())
+
+	resp, err := http.Get(srv.URL + "/calendar/cc.ics")
+	if err != nil {
+		t.Fatalf("GET calendar: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/calendar; charset=utf-8" {
+		t.Fatalf("unexpected calendar response: %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if got := strings.Count(string(body), "BEGIN:VEVENT"); got != 2 {
+		t.Fatalf("expected 2 council events, got %d", got)
+	}
+
+	if resp := getJSON(t, srv.URL+"/calendar/nope.ics", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown calendar, got %d", resp.StatusCode)
+	}
+}
+
+func TestSetDocumentsFirstSeen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "first-seen.json")
+	a := scraper.Document{Link: "https://example.invalid/a.pdf", Name: "a.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)}
+	b := scraper.Document{Link: "https://example.invalid/b.pdf", Name: "b.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)}
+	s := New(Config{FirstSeenPath: path})
+	handler := s.Handler()
+
+	// Refreshes and reads run concurrently; go test -race checks the locking.
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_ = s.Documents()
+					handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/feeds/atom.xml", nil))
+				}
+			}
+		}()
+	}
+	s.SetDocuments([]scraper.Document{a})
+	first, err := feed.LoadFirstSeen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		s.SetDocuments([]scraper.Document{a, b})
+	}
+	close(stop)
+	wg.Wait()
+
+	seen, err := feed.LoadFirstSeen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idA, idB := scraper.DocumentID(a.Link), scraper.DocumentID(b.Link)
+	if len(seen) != 2 || !seen[idA].Equal(first[idA]) || seen[idB].IsZero() {
+		t.Fatalf("first-seen times = %v, want a kept at %v and b added", seen, first[idA])
+	}
+	if docs := s.Documents(); len(docs) != 2 || docs[0].Name != "b.pdf" {
+		t.Fatalf("Documents = %+v", docs)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	vancouver, err := time.LoadLocation("America/Vancouver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 9 p.m. in Windsor is 6 p.m. in Vancouver.
+	docs := []scraper.Document{{Name: "evening.pdf", Date: time.Date(2024, time.March, 5, 21, 0, 0, 0, scraper.DefaultLocation)}}
+	q := url.Values{"after": {"2024-03-05 19:00"}}
+	for _, tc := range []struct {
+		loc  *time.Location
+		want int
+	}{
+		{scraper.DefaultLocation, 1},
+		{vancouver, 0},
+	} {
+		filters, err := Filters(q, tc.loc)
+		if err != nil {
+			t.Fatalf("Filters(%s) returned error: %v", tc.loc, err)
+		}
+		got := docs
+		for _, f := range filters {
+			got = f(got)
+		}
+		if len(got) != tc.want {
+			t.Errorf("after 19:00 in %s matched %d documents, want %d", tc.loc, len(got), tc.want)
+		}
+	}
+}
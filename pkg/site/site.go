@@ -0,0 +1,348 @@
+// Package site renders a static HTML archive of documents with pages per year, meeting type and meeting, and a
+// JSON index for client-side search.
+package site
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/feed"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+//go:embed templates
+var defaults embed.FS
+
+// Options configures a generated site.
+type Options struct {
+	// Title of the site; defaults to "Windsor Council Documents".
+	Title string
+	// TemplateDir holds templates and assets that replace the embedded defaults of the same name:
+	// layout.html, index.html, year.html, type.html, meeting.html, search.html, style.css and search.js.
+	TemplateDir string
+	// PDFDir is the directory documents were downloaded to. Documents whose FileName exists there are copied
+	// into the site's pdfs directory and linked locally; others link to the city's website.
+	PDFDir string
+	// Now is the generation time shown in page footers; it defaults to time.Now().
+	Now time.Time
+}
+
+// SearchEntry is an element of search-index.json.
+type SearchEntry struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Title   string `json:"title"`
+	Meeting string `json:"meeting"`
+	Code    string `json:"code"`
+	Date    string `json:"date"`
+	Page    string `json:"page"`
+	PDF     string `json:"pdf"`
+}
+
+type yearLink struct {
+	Year int
+	Path string
+}
+
+type typeLink struct {
+	Type     scraper.MeetingType
+	Path     string
+	Meetings int
+}
+
+type documentView struct {
+	scraper.Document
+	Href     string
+	Mirrored bool
+}
+
+type meetingView struct {
+	Type      scraper.MeetingType
+	Date      time.Time
+	Title     string
+	Path      string
+	Href      string
+	Documents []documentView
+}
+
+// page is the data passed to every template.
+type page struct {
+	SiteTitle string
+	Title     string
+	// Root is the relative path from the page to the site root, e.g. "../".
+	Root      string
+	Generated time.Time
+	Count     int
+	Years     []yearLink
+	Types     []typeLink
+	All       []meetingView
+	Meetings  []meetingView
+	Meeting   meetingView
+}
+
+// Generate writes the site for docs to dir.
+func Generate(dir string, docs []scraper.Document, opts Options) error {
+	if opts.Title == "" {
+		opts.Title = "Windsor Council Documents"
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	g := &generator{dir: dir, opts: opts, mirrored: make(map[string]bool)}
+
+	for _, sub := range []string{"years", "types", "meetings", "pdfs"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+	if err := g.copyPDFs(docs); err != nil {
+		return err
+	}
+	for _, asset := range []string{"style.css", "search.js"} {
+		data, err := g.read(asset)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, asset), data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	meetings := scraper.GroupMeetings(docs)
+	slices.Reverse(meetings)
+	base := page{SiteTitle: opts.Title, Generated: opts.Now, Count: len(docs)}
+
+	years := make(map[int][]scraper.Meeting)
+	for _, m := range meetings {
+		years[m.Date.Year()] = append(years[m.Date.Year()], m)
+	}
+	for y := range years {
+		base.Years = append(base.Years, yearLink{Year: y, Path: "years/" + strconv.Itoa(y) + ".html"})
+	}
+	slices.SortFunc(base.Years, func(a, b yearLink) int { return b.Year - a.Year })
+
+	byType := make(map[string][]scraper.Meeting)
+	for _, m := range meetings {
+		byType[m.Type.Code] = append(byType[m.Type.Code], m)
+	}
+	for _, mt := range feed.MeetingTypes(docs) {
+		if n := len(byType[mt.Code]); n > 0 {
+			base.Types = append(base.Types, typeLink{Type: mt, Path: "types/" + typeSlug(mt) + ".html", Meetings: n})
+		}
+	}
+
+	index := base
+	index.All = g.views(meetings, "")
+	index.Meetings = index.All[:min(len(index.All), 20)]
+	if err := g.render("index.html", "index.html", index); err != nil {
+		return err
+	}
+
+	search := base
+	search.Title = "Search"
+	if err := g.render("search.html", "search.html", search); err != nil {
+		return err
+	}
+
+	for _, y := range base.Years {
+		p := base
+		p.Root = "../"
+		p.Title = strconv.Itoa(y.Year)
+		p.Meetings = g.views(years[y.Year], p.Root)
+		if err := g.render("year.html", y.Path, p); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range base.Types {
+		p := base
+		p.Root = "../"
+		p.Title = t.Type.Name
+		p.Meetings = g.views(byType[t.Type.Code], p.Root)
+		if err := g.render("type.html", t.Path, p); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range g.views(meetings, "../") {
+		p := base
+		p.Root = "../"
+		p.Title = m.Type.Name + " " + m.Date.Format("2006-01-02")
+		p.Meeting = m
+		if err := g.render("meeting.html", m.Path, p); err != nil {
+			return err
+		}
+	}
+
+	return g.writeIndex(meetings)
+}
+
+type generator struct {
+	dir      string
+	opts     Options
+	mirrored map[string]bool
+}
+
+// read returns a template or asset from TemplateDir, falling back to the embedded default.
+func (g *generator) read(name string) ([]byte, error) {
+	if g.opts.TemplateDir != "" {
+		data, err := os.ReadFile(filepath.Join(g.opts.TemplateDir, name))
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return defaults.ReadFile("templates/" + name)
+}
+
+// render executes the layout with the content defined by the named page template and writes it to path.
+func (g *generator) render(name, path string, data page) error {
+	layout, err := g.read("layout.html")
+	if err != nil {
+		return err
+	}
+	content, err := g.read(name)
+	if err != nil {
+		return err
+	}
+	t, err := template.New("layout.html").Parse(string(layout))
+	if err != nil {
+		return fmt.Errorf("site: parse layout.html: %w", err)
+	}
+	if _, err := t.New(name).Parse(string(content)); err != nil {
+		return fmt.Errorf("site: parse %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "layout.html", data); err != nil {
+		return fmt.Errorf("site: render %s: %w", path, err)
+	}
+	return os.WriteFile(filepath.Join(g.dir, filepath.FromSlash(path)), buf.Bytes(), 0o644)
+}
+
+// views prepares meetings for a page at root.
+func (g *generator) views(meetings []scraper.Meeting, root string) []meetingView {
+	out := make([]meetingView, 0, len(meetings))
+	for _, m := range meetings {
+		v := meetingView{Type: m.Type, Date: m.Date, Title: m.Title, Path: meetingPath(m)}
+		v.Href = root + v.Path
+		for _, doc := range m.Documents {
+			dv := documentView{Document: doc, Href: doc.Link}
+			if g.mirrored[doc.FileName] {
+				dv.Href, dv.Mirrored = root+"pdfs/"+doc.FileName, true
+			}
+			v.Documents = append(v.Documents, dv)
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// writeIndex writes search-index.json with paths relative to the site root.
+func (g *generator) writeIndex(meetings []scraper.Meeting) error {
+	entries := make([]SearchEntry, 0)
+	for _, m := range g.views(meetings, "") {
+		for _, doc := range m.Documents {
+			id := doc.ID
+			if id == "" {
+				id = scraper.DocumentID(doc.Link)
+			}
+			entries = append(entries, SearchEntry{
+				ID:      id,
+				Name:    doc.Name,
+				Title:   m.Title,
+				Meeting: m.Type.Name,
+				Code:    m.Type.Code,
+				Date:    m.Date.Format("2006-01-02"),
+				Page:    m.Path,
+				PDF:     doc.Href,
+			})
+		}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(g.dir, "search-index.json"), data, 0o644)
+}
+
+// copyPDFs mirrors downloaded documents into the site, hard-linking where possible.
+func (g *generator) copyPDFs(docs []scraper.Document) error {
+	if g.opts.PDFDir == "" {
+		return nil
+	}
+	for _, doc := range docs {
+		if doc.FileName == "" || g.mirrored[doc.FileName] || !filepath.IsLocal(doc.FileName) {
+			continue
+		}
+		src := filepath.Join(g.opts.PDFDir, doc.FileName)
+		info, err := os.Stat(src)
+		if err != nil {
+			continue
+		}
+		dst := filepath.Join(g.dir, "pdfs", doc.FileName)
+		if existing, err := os.Stat(dst); err == nil && existing.Size() == info.Size() && !existing.ModTime().Before(info.ModTime()) {
+			g.mirrored[doc.FileName] = true
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return fmt.Errorf("site: copy %s: %w", doc.FileName, err)
+		}
+		_ = os.Remove(dst)
+		if err := os.Link(src, dst); err != nil {
+			if err := copyFile(src, dst); err != nil {
+				return fmt.Errorf("site: copy %s: %w", doc.FileName, err)
+			}
+		}
+		g.mirrored[doc.FileName] = true
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func typeSlug(mt scraper.MeetingType) string {
+	if mt.Code == "" {
+		return "unknown"
+	}
+	return strings.ToLower(mt.Code)
+}
+
+// meetingPath returns the path of a meeting page relative to the site root, e.g. "meetings/2024-03-04-cc.html".
+// Like the meeting's iCalendar UID, it includes the start time as written when there is one, e.g.
+// "meetings/2024-03-04-1630-cc.html", so meetings of one type on the same day get pages of their own.
+func meetingPath(m scraper.Meeting) string {
+	when := m.Date.Format("2006-01-02")
+	if scraper.HasStartTime(m.Date) {
+		when = m.Date.Format("2006-01-02-1504")
+	}
+	return "meetings/" + when + "-" + typeSlug(m.Type) + ".html"
+}
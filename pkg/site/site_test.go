@@ -0,0 +1,99 @@
+package site
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+func TestGenerate(t *testing.T) {
+	pdfDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(pdfDir, "2024_03_04-CC-agenda.pdf"), []byte("%PDF-1.4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	templates := t.TempDir()
+	if err := os.WriteFile(filepath.Join(templates, "type.html"), []byte(`{{define "content"}}<h1>Custom {{.Title}}</h1>{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []scraper.Document{
+		{Name: "agenda.pdf", FileName: "2024_03_04-CC-agenda.pdf", Link: "https://example.invalid/agenda.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC), RawTitle: "City Council Meeting - Monday, March 4, 2024"},
+		{Name: "minutes.pdf", FileName: "2023_11_20-CC-minutes.pdf", Link: "https://example.invalid/minutes.pdf", Meeting: scraper.CC, Date: time.Date(2023, time.November, 20, 0, 0, 0, 0, time.UTC)},
+		{Name: "<agenda>.pdf", Link: "https://example.invalid/dhsc.pdf", Meeting: scraper.DHSC, Date: time.Date(2024, time.March, 6, 0, 0, 0, 0, time.UTC)},
+	}
+	out := t.TempDir()
+	if err := Generate(out, docs, Options{TemplateDir: templates, PDFDir: pdfDir}); err != nil {
+		t.Fatalf("Generate returned error: %v", err)
+	}
+
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(out, path))
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		return string(data)
+	}
+
+	for _, path := range []string{"index.html", "search.html", "style.css", "search.js", "years/2023.html", "years/2024.html", "pdfs/2024_03_04-CC-agenda.pdf"} {
+		read(path)
+	}
+
+	meeting := read("meetings/2024-03-04-cc.html")
+	if !strings.Contains(meeting, `href="../pdfs/2024_03_04-CC-agenda.pdf"`) || !strings.Contains(meeting, `href="../style.css"`) {
+		t.Fatalf("meeting page doesn't link the mirrored PDF:\n%s", meeting)
+	}
+	if !strings.Contains(read("meetings/2024-03-06-dhsc.html"), `href="https://example.invalid/dhsc.pdf">&lt;agenda&gt;.pdf</a>`) {
+		t.Fatalf("expected unmirrored PDF to link to the listing and be escaped")
+	}
+	if !strings.Contains(read("types/cc.html"), "<h1>Custom City Council</h1>") {
+		t.Fatalf("expected template override to be used")
+	}
+	year := read("years/2024.html")
+	if !strings.Contains(year, `href="../meetings/2024-03-04-cc.html"`) || strings.Contains(year, "2023-11-20") {
+		t.Fatalf("unexpected year page:\n%s", year)
+	}
+
+	var index []SearchEntry
+	if err := json.Unmarshal([]byte(read("search-index.json")), &index); err != nil {
+		t.Fatalf("decode search index: %v", err)
+	}
+	if len(index) != 3 || index[0].Date != "2024-03-06" || index[1].PDF != "pdfs/2024_03_04-CC-agenda.pdf" || index[1].Page != "meetings/2024-03-04-cc.html" {
+		t.Fatalf("unexpected search index: %+v", index)
+	}
+}
+
+func TestGenerateSameDayAndUnknownMeetings(t *testing.T) {
+	day := func(hour int) time.Time {
+		return time.Date(2024, time.March, 4, hour, 0, 0, 0, scraper.DefaultLocation)
+	}
+	board := scraper.GetMeetingType("Windsor Police Services Board")
+	docs := []scraper.Document{
+		{Name: "morning.pdf", Link: "https://example.invalid/morning.pdf", Meeting: scraper.Special, Date: day(10)},
+		{Name: "evening.pdf", Link: "https://example.invalid/evening.pdf", Meeting: scraper.Special, Date: day(18)},
+		{Name: "board.pdf", Link: "https://example.invalid/board.pdf", Meeting: board, Date: day(0)},
+	}
+	out := t.TempDir()
+	if err := Generate(out, docs, Options{}); err != nil {
+		t.Fatalf("Generate returned error: %v", err)
+	}
+
+	for path, want := range map[string]string{
+		"meetings/2024-03-04-1000-special.html": "morning.pdf",
+		"meetings/2024-03-04-1800-special.html": "evening.pdf",
+		"types/unknown.html":                    "2024-03-04-unknown.html",
+	} {
+		data, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("%s doesn't mention %s:\n%s", path, want, data)
+		}
+	}
+}
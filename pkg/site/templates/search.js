@@ -0,0 +1,28 @@
+(function () {
+  var input = document.getElementById("q");
+  var results = document.getElementById("results");
+  var index = [];
+
+  function render() {
+    var terms = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+    results.innerHTML = "";
+    if (terms.length === 0) return;
+    index.filter(function (d) {
+      var text = (d.name + " " + d.title + " " + d.meeting + " " + d.date).toLowerCase();
+      return terms.every(function (t) { return text.indexOf(t) >= 0; });
+    }).slice(0, 200).forEach(function (d) {
+      var li = document.createElement("li");
+      var a = document.createElement("a");
+      a.href = d.page;
+      a.textContent = d.date + " " + d.meeting + ": " + d.name;
+      li.appendChild(a);
+      results.appendChild(li);
+    });
+  }
+
+  fetch("search-index.json").then(function (r) { return r.json(); }).then(function (data) {
+    index = data;
+    render();
+  });
+  input.addEventListener("input", render);
+})();
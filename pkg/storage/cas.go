@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LinkMode controls how names point at blobs in a CAS.
+type LinkMode string
+
+const (
+	// LinkManifest records names only in the manifest. It works with any Storage.
+	LinkManifest LinkMode = "manifest"
+	// LinkHard makes each name a hard link to its blob. It requires a Local store.
+	LinkHard LinkMode = "hardlink"
+	// LinkSymlink makes each name a relative symbolic link to its blob. It requires a Local store.
+	LinkSymlink LinkMode = "symlink"
+)
+
+// Reserved keys of a CAS layout.
+const (
+	ManifestKey = "manifest.json"
+	blobPrefix  = "blobs/sha256/"
+)
+
+// ManifestEntry is the blob a name refers to.
+type ManifestEntry struct {
+	Checksum string    `json:"sha256"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+}
+
+// CAS is a content-addressed Storage. Content is stored once under blobs/sha256/<xx>/<sha256> in the
+// underlying store, and names map to blobs through manifest.json and, for a Local store, links.
+type CAS struct {
+	base  Storage
+	local *Local
+	mode  LinkMode
+
+	mu       sync.Mutex
+	manifest map[string]ManifestEntry
+}
+
+// NewCAS returns a CAS over base, loading its manifest.
+func NewCAS(ctx context.Context, base Storage, mode LinkMode) (*CAS, error) {
+	c := &CAS{base: base, mode: mode, manifest: make(map[string]ManifestEntry)}
+	switch mode {
+	case LinkManifest:
+	case LinkHard, LinkSymlink:
+		local, ok := base.(*Local)
+		if !ok {
+			return nil, fmt.Errorf("storage: %s layout needs a local directory", mode)
+		}
+		c.local = local
+	default:
+		return nil, fmt.Errorf("storage: unknown link mode %q", mode)
+	}
+
+	rc, err := base.Open(ctx, ManifestKey)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(&c.manifest); err != nil {
+		return nil, fmt.Errorf("storage: decode %s: %w", ManifestKey, err)
+	}
+	return c, nil
+}
+
+// BlobKey returns the key of the blob with the given checksum.
+func BlobKey(checksum string) string {
+	if len(checksum) < 2 {
+		return blobPrefix + checksum
+	}
+	return blobPrefix + checksum[:2] + "/" + checksum
+}
+
+// Manifest returns a copy of the name to blob mapping.
+func (c *CAS) Manifest() map[string]ManifestEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]ManifestEntry, len(c.manifest))
+	for k, v := range c.manifest {
+		out[k] = v
+	}
+	return out
+}
+
+func (c *CAS) key(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if key == ManifestKey || strings.HasPrefix(key, "blobs/") {
+		return "", fmt.Errorf("storage: %q is reserved: %w", key, ErrInvalidKey)
+	}
+	return key, nil
+}
+
+// Put stores the blob unless identical content is already present and points key at it.
+func (c *CAS) Put(ctx context.Context, key string, r io.Reader, checksum string) (Object, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	tempFile, err := os.CreateTemp("", "cas-put-*")
+	if err != nil {
+		return Object{}, fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}()
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempFile, hasher), contextReader{ctx, r})
+	if err != nil {
+		return Object{}, fmt.Errorf("copy: %w", err)
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if checksum != "" && checksum != sum {
+		return Object{}, fmt.Errorf("%w (expected %s, got %s)", ErrChecksumMismatch, checksum, sum)
+	}
+
+	blob := BlobKey(sum)
+	if !c.hasBlob(ctx, blob, size) {
+		if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+			return Object{}, err
+		}
+		if _, err := c.base.Put(ctx, blob, tempFile, sum); err != nil {
+			return Object{}, err
+		}
+	}
+
+	if err := c.link(key, blob); err != nil {
+		return Object{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous, had := c.manifest[key]
+	entry := ManifestEntry{Checksum: sum, Size: size, ModTime: time.Now().UTC()}
+	c.manifest[key] = entry
+	if err := c.saveLocked(ctx); err != nil {
+		return Object{}, err
+	}
+	if had && previous.Checksum != sum {
+		c.collectLocked(ctx, previous.Checksum)
+	}
+	return Object{Key: key, Size: size, Checksum: sum, ModTime: entry.ModTime}, nil
+}
+
+// hasBlob reports whether blob is already stored. Local blobs are checked without rehashing them.
+func (c *CAS) hasBlob(ctx context.Context, blob string, size int64) bool {
+	if c.local != nil {
+		p, err := c.local.path(blob)
+		if err != nil {
+			return false
+		}
+		info, err := os.Stat(p)
+		return err == nil && info.Size() == size
+	}
+	obj, err := c.base.Stat(ctx, blob)
+	return err == nil && obj.Size == size
+}
+
+// link points the file for key at blob in the link modes.
+func (c *CAS) link(key, blob string) error {
+	if c.local == nil {
+		return nil
+	}
+	name, err := c.local.path(key)
+	if err != nil {
+		return err
+	}
+	target, err := c.local.path(blob)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Create the link under a temporary name and rename it over the old file, so readers never see a gap.
+	tmp := filepath.Join(filepath.Dir(name), tempPrefix+filepath.Base(name))
+	_ = os.Remove(tmp)
+	if c.mode == LinkHard {
+		err = os.Link(target, tmp)
+	} else {
+		var rel string
+		rel, err = filepath.Rel(filepath.Dir(name), target)
+		if err == nil {
+			err = os.Symlink(rel, tmp)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("storage: link %s: %w", key, err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("storage: link %s: %w", key, err)
+	}
+	return nil
+}
+
+func (c *CAS) entry(key string) (string, ManifestEntry, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return "", ManifestEntry{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.manifest[key]
+	if !ok {
+		return "", ManifestEntry{}, fmt.Errorf("storage: %s: %w", key, fs.ErrNotExist)
+	}
+	return key, e, nil
+}
+
+// Stat answers from the manifest.
+func (c *CAS) Stat(_ context.Context, key string) (Object, error) {
+	key, e, err := c.entry(key)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, Size: e.Size, Checksum: e.Checksum, ModTime: e.ModTime}, nil
+}
+
+func (c *CAS) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	_, e, err := c.entry(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.base.Open(ctx, BlobKey(e.Checksum))
+}
+
+// Delete removes the name and, once no other name refers to it, the blob.
+func (c *CAS) Delete(ctx context.Context, key string) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.manifest[key]
+	if !ok {
+		return nil
+	}
+	if c.local != nil {
+		if err := c.local.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	delete(c.manifest, key)
+	if err := c.saveLocked(ctx); err != nil {
+		return err
+	}
+	c.collectLocked(ctx, e.Checksum)
+	return nil
+}
+
+// List returns the names in the manifest.
+func (c *CAS) List(_ context.Context, prefix string) ([]Object, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	objects := make([]Object, 0)
+	for key, e := range c.manifest {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, Object{Key: key, Size: e.Size, Checksum: e.Checksum, ModTime: e.ModTime})
+		}
+	}
+	slices.SortFunc(objects, func(a, b Object) int { return strings.Compare(a.Key, b.Key) })
+	return objects, nil
+}
+
+// collectLocked deletes the blob for checksum when no name refers to it.
+func (c *CAS) collectLocked(ctx context.Context, checksum string) {
+	for _, e := range c.manifest {
+		if e.Checksum == checksum {
+			return
+		}
+	}
+	_ = c.base.Delete(ctx, BlobKey(checksum))
+}
+
+func (c *CAS) saveLocked(ctx context.Context) error {
+	data, err := json.MarshalIndent(c.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := c.base.Put(ctx, ManifestKey, bytes.NewReader(data), ""); err != nil {
+		return fmt.Errorf("storage: save %s: %w", ManifestKey, err)
+	}
+	return nil
+}
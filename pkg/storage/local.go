@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// tempPrefix marks in-progress Puts, which List skips.
+const tempPrefix = ".put-"
+
+// Local stores files in a directory. Keys map to paths below Dir.
+type Local struct {
+	Dir string
+}
+
+// NewLocal returns a Local rooted at dir.
+func NewLocal(dir string) *Local {
+	return &Local{Dir: dir}
+}
+
+func (l *Local) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file next to the destination and renames it into place once the checksum is known.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, checksum string) (Object, error) {
+	dest, err := l.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return Object{}, fmt.Errorf("create dir: %w", err)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(dest), tempPrefix+"*")
+	if err != nil {
+		return Object{}, fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempFile, hasher), contextReader{ctx, r})
+	if err != nil {
+		return Object{}, fmt.Errorf("copy: %w", err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		return Object{}, fmt.Errorf("flush temp file: %w", err)
+	}
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if checksum != "" && checksum != sum {
+		return Object{}, fmt.Errorf("%w (expected %s, got %s)", ErrChecksumMismatch, checksum, sum)
+	}
+	if err := tempFile.Close(); err != nil {
+		return Object{}, fmt.Errorf("close temp file: %w", err)
+	}
+	if err := os.Rename(tempFile.Name(), dest); err != nil {
+		return Object{}, fmt.Errorf("move temp file: %w", err)
+	}
+
+	obj := Object{Key: filepath.ToSlash(mustRel(l.Dir, dest)), Size: size, Checksum: sum}
+	if info, err := os.Stat(dest); err == nil {
+		obj.ModTime = info.ModTime()
+	}
+	return obj, nil
+}
+
+// Stat reads the file to compute its checksum.
+func (l *Local) Stat(_ context.Context, key string) (Object, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return Object{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Object{}, err
+	}
+	if info.IsDir() {
+		return Object{}, fmt.Errorf("storage: %s: %w", key, fs.ErrNotExist)
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return Object{}, err
+	}
+	return Object{
+		Key:      filepath.ToSlash(mustRel(l.Dir, p)),
+		Size:     info.Size(),
+		Checksum: hex.EncodeToString(hasher.Sum(nil)),
+		ModTime:  info.ModTime(),
+	}, nil
+}
+
+func (l *Local) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks Dir. It doesn't compute checksums.
+func (l *Local) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := make([]Object, 0)
+	err := filepath.WalkDir(l.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == l.Dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return nil
+		}
+		key := filepath.ToSlash(mustRel(l.Dir, p))
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(objects, func(a, b Object) int { return strings.Compare(a.Key, b.Key) })
+	return objects, nil
+}
+
+func mustRel(base, target string) string {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return target
+	}
+	return rel
+}
+
+// contextReader stops a copy when ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
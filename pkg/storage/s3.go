@@ -0,0 +1,389 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the hex SHA-256 of an empty payload.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// checksumMeta is the user metadata header Put records the SHA-256 checksum in.
+const checksumMeta = "X-Amz-Meta-Sha256"
+
+// S3Config configures an S3 store.
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g. "http://localhost:9000" for MinIO. It defaults to
+	// "https://s3.<region>.amazonaws.com".
+	Endpoint string
+	// Region defaults to "us-east-1".
+	Region string
+	Bucket string
+	// Prefix is prepended to every key.
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// VirtualHosted addresses the bucket as a subdomain of the endpoint instead of the first path segment.
+	VirtualHosted bool
+	// Client sends the requests; it defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// S3 stores files in a bucket of an S3-compatible object store. Requests are signed with AWS Signature
+// Version 4.
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	now      func() time.Time
+}
+
+// NewS3 returns an S3 store for cfg.
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("storage: s3: missing bucket")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+	if cfg.Prefix != "" {
+		cfg.Prefix += "/"
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("storage: s3: invalid endpoint %q", cfg.Endpoint)
+	}
+	return &S3{cfg: cfg, endpoint: u, now: time.Now}, nil
+}
+
+// Put spools the content to a temporary file to compute its size and checksum before uploading it, so the
+// payload is signed and the store verifies it.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, checksum string) (Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+	tempFile, err := os.CreateTemp("", "s3-put-*")
+	if err != nil {
+		return Object{}, fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempFile, hasher), contextReader{ctx, r})
+	if err != nil {
+		return Object{}, fmt.Errorf("copy: %w", err)
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if checksum != "" && checksum != sum {
+		return Object{}, fmt.Errorf("%w (expected %s, got %s)", ErrChecksumMismatch, checksum, sum)
+	}
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		return Object{}, err
+	}
+
+	req, err := s.request(ctx, http.MethodPut, key, nil, io.NopCloser(tempFile))
+	if err != nil {
+		return Object{}, err
+	}
+	req.ContentLength = size
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(checksumMeta, sum)
+	resp, err := s.do(req, sum)
+	if err != nil {
+		return Object{}, err
+	}
+	resp.Body.Close()
+	return Object{Key: key, Size: size, Checksum: sum, ModTime: s.now()}, nil
+}
+
+// Stat reads the checksum Put recorded in the object's metadata; it is empty for objects uploaded by other tools.
+func (s *S3) Stat(ctx context.Context, key string) (Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+	req, err := s.request(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	resp, err := s.do(req, emptySHA256)
+	if err != nil {
+		return Object{}, err
+	}
+	resp.Body.Close()
+	obj := Object{Key: key, Size: resp.ContentLength, Checksum: resp.Header.Get(checksumMeta)}
+	obj.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return obj, nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := s.request(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, emptySHA256)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	req, err := s.request(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, emptySHA256)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listResult is the body of a ListObjectsV2 response.
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through ListObjectsV2. Listings don't include checksums.
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := make([]Object, 0)
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.cfg.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := s.request(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, emptySHA256)
+		if err != nil {
+			return nil, err
+		}
+		var res listResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("storage: s3: decode listing: %w", err)
+		}
+		for _, c := range res.Contents {
+			objects = append(objects, Object{Key: strings.TrimPrefix(c.Key, s.cfg.Prefix), Size: c.Size, ModTime: c.LastModified})
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+	slices.SortFunc(objects, func(a, b Object) int { return strings.Compare(a.Key, b.Key) })
+	return objects, nil
+}
+
+// request builds an unsigned request for key, or for the bucket when key is empty.
+func (s *S3) request(ctx context.Context, method, key string, query url.Values, body io.ReadCloser) (*http.Request, error) {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.VirtualHosted {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	} else {
+		p += "/" + escape(s.cfg.Bucket, false)
+	}
+	if key != "" {
+		p += "/" + escape(s.cfg.Prefix+key, true)
+	} else if !s.cfg.VirtualHosted {
+		p += "/"
+	}
+	if p == "" {
+		p = "/"
+	}
+	u.RawPath = p
+	u.Path, _ = url.PathUnescape(p)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Body = body
+	}
+	return req, nil
+}
+
+// do signs and sends req, turning error responses into errors.
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, s.now())
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("storage: s3 %s: %w", req.Method, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var apiErr struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+	target := strings.TrimPrefix(req.URL.Path, "/")
+	if resp.StatusCode == http.StatusNotFound && apiErr.Code != "NoSuchBucket" {
+		return nil, fmt.Errorf("storage: s3 %s: %w", target, fs.ErrNotExist)
+	}
+	msg := resp.Status
+	if apiErr.Code != "" {
+		msg = apiErr.Code + ": " + apiErr.Message
+	}
+	return nil, fmt.Errorf("storage: s3 %s %s: %s", req.Method, target, msg)
+}
+
+// sign adds AWS Signature Version 4 headers to req. It signs the host, every x-amz-* header and the
+// Content-Type, Content-MD5 and Range headers when they are set.
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonical, signedHeaders := canonicalRequest(req, payloadHash)
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+	signature := hex.EncodeToString(hmacSHA256(signingKey(s.cfg.SecretKey, day, s.cfg.Region, "s3"), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalRequest returns the SigV4 canonical request for req and its signed header list.
+func canonicalRequest(req *http.Request, payloadHash string) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" || lower == "range" {
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			headers[lower] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	b.WriteString(req.Method + "\n")
+	b.WriteString(req.URL.EscapedPath() + "\n")
+	b.WriteString(canonicalQuery(req.URL.Query()) + "\n")
+	for _, name := range names {
+		b.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	b.WriteString("\n" + signed + "\n" + payloadHash)
+	return b.String(), signed
+}
+
+// canonicalQuery encodes query sorted by key with SigV4 escaping.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := slices.Clone(query[k])
+		slices.Sort(values)
+		for _, v := range values {
+			parts = append(parts, escape(k, false)+"="+escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escape percent-encodes everything but unreserved characters, and "/" when keepSlash is set.
+func escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteString("%" + strings.ToUpper(strconv.FormatUint(uint64(c)|0x100, 16)[1:]))
+		}
+	}
+	return b.String()
+}
+
+func signingKey(secret, day, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), day)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,86 @@
+// Package storage abstracts where downloaded files are kept, with implementations for a local directory and
+// S3-compatible object stores such as MinIO.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrChecksumMismatch is returned by Put when the content doesn't match the expected checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrInvalidKey is returned for keys that are empty, absolute or escape the store with "..".
+var ErrInvalidKey = errors.New("invalid key")
+
+// Object describes a stored file.
+type Object struct {
+	Key  string
+	Size int64
+	// Checksum is the hex SHA-256 of the content. List may leave it empty when the backend doesn't return it.
+	Checksum string
+	ModTime  time.Time
+}
+
+// Storage stores files under slash-separated keys. Methods return an error wrapping fs.ErrNotExist for
+// missing keys.
+type Storage interface {
+	// Put streams r to key and returns the stored object. When checksum is set and the content's SHA-256
+	// differs, Put returns an error wrapping ErrChecksumMismatch and leaves any existing object in place.
+	Put(ctx context.Context, key string, r io.Reader, checksum string) (Object, error)
+	// Stat returns the object at key, including its checksum.
+	Stat(ctx context.Context, key string) (Object, error)
+	// Open returns the content of key.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose keys start with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// Open returns the Storage for a location: a directory path or file:// URL for Local, or
+// "s3://bucket/prefix?endpoint=http://localhost:9000&region=us-east-1" for S3, with credentials from
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY. Without an endpoint, S3 uses AWS's regional endpoint.
+func Open(location string) (Storage, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// Plain paths, including Windows drive letters.
+		return NewLocal(location), nil
+	}
+	switch u.Scheme {
+	case "file":
+		return NewLocal(u.Path), nil
+	case "s3":
+		q := u.Query()
+		return NewS3(S3Config{
+			Endpoint:      q.Get("endpoint"),
+			Region:        q.Get("region"),
+			Bucket:        u.Host,
+			Prefix:        strings.TrimPrefix(u.Path, "/"),
+			AccessKey:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:     os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			VirtualHosted: q.Get("virtualHosted") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("storage: unsupported location %q", location)
+	}
+}
+
+// cleanKey validates key and returns it in canonical form.
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("storage: %q: %w", key, ErrInvalidKey)
+	}
+	clean := path.Clean(key)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("storage: %q: %w", key, ErrInvalidKey)
+	}
+	return clean, nil
+}
@@ -0,0 +1,161 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recorder is an http.RoundTripper that writes every request and response to a Writer.
+type Recorder struct {
+	// Next sends the requests; it defaults to http.DefaultTransport.
+	Next   http.RoundTripper
+	Writer *Writer
+	// Now returns the capture time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// Client returns an http.Client that records through rec.
+func (rec *Recorder) Client() *http.Client {
+	return &http.Client{Transport: rec}
+}
+
+// RoundTrip sends req and records the exchange once the response body has been read in full. The request asks
+// for an identity encoding so the recorded payload is what the server sent.
+func (rec *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := rec.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	now := time.Now
+	if rec.Now != nil {
+		now = rec.Now
+	}
+
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	date := now()
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	reqRecord := NewRecord(TypeRequest, date, "application/http;msgtype=request", requestBlock(req))
+	respRecord := NewRecord(TypeResponse, date, "application/http;msgtype=response", responseBlock(resp, body))
+	for _, r := range []Record{reqRecord, respRecord} {
+		r.Header.Set("WARC-Target-URI", req.URL.String())
+	}
+	reqRecord.Header.Set("WARC-Concurrent-To", respRecord.Header.Get("WARC-Record-ID"))
+	respRecord.Header.Set("WARC-Payload-Digest", Digest(body))
+
+	if err := rec.Writer.Write(respRecord); err != nil {
+		return nil, fmt.Errorf("warc: %w", err)
+	}
+	if err := rec.Writer.Write(reqRecord); err != nil {
+		return nil, fmt.Errorf("warc: %w", err)
+	}
+	return resp, nil
+}
+
+func requestBlock(req *http.Request) []byte {
+	var b bytes.Buffer
+	target := req.URL.RequestURI()
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", req.Method, target)
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&b, "Host: %s\r\n", host)
+	_ = req.Header.WriteSubset(&b, map[string]bool{"Host": true})
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// responseBlock serialises the response. Transfer encodings have already been removed from body, so
+// Transfer-Encoding is dropped and Content-Length is set to the payload length.
+func responseBlock(resp *http.Response, body []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+	header := resp.Header.Clone()
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	_ = header.Write(&b)
+	b.WriteString("\r\n")
+	b.Write(body)
+	return b.Bytes()
+}
+
+// Problem is a record that failed verification.
+type Problem struct {
+	RecordID  string
+	TargetURI string
+	Err       error
+}
+
+// Verify reads every record from r and checks the block digests and, for responses, the payload digests. It
+// returns the number of records read and the records that failed.
+func Verify(r io.Reader) (int, []Problem, error) {
+	wr, err := NewReader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	count := 0
+	problems := make([]Problem, 0)
+	for {
+		rec, err := wr.Next()
+		if errors.Is(err, io.EOF) {
+			return count, problems, nil
+		}
+		if err != nil {
+			return count, problems, err
+		}
+		count++
+		if err := verifyRecord(rec); err != nil {
+			problems = append(problems, Problem{
+				RecordID:  rec.Header.Get("WARC-Record-ID"),
+				TargetURI: rec.Header.Get("WARC-Target-URI"),
+				Err:       err,
+			})
+		}
+	}
+}
+
+func verifyRecord(rec Record) error {
+	if want := rec.Header.Get("WARC-Block-Digest"); want != "" && strings.HasPrefix(want, "sha256:") {
+		if got := Digest(rec.Block); got != want {
+			return fmt.Errorf("block digest %s, recorded %s", got, want)
+		}
+	}
+	want := rec.Header.Get("WARC-Payload-Digest")
+	if rec.Type() != TypeResponse || !strings.HasPrefix(want, "sha256:") {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.Block)), nil)
+	if err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	payload, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("read payload: %w", err)
+	}
+	if got := Digest(payload); got != want {
+		return fmt.Errorf("payload digest %s, recorded %s", got, want)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Package warc writes and reads WARC 1.1 files, the web archive format used by the Internet Archive, so the
+// listing and documents can be preserved as the City served them.
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the WARC version written.
+const Version = "WARC/1.1"
+
+// Record types.
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+	TypeMetadata = "metadata"
+)
+
+// Record is a WARC record. Header holds the named fields; Block is the record content.
+type Record struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+}
+
+// Type returns the WARC-Type of the record.
+func (r Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+// NewRecord returns a record of the given type with a new record ID, the date and a block digest.
+func NewRecord(recordType string, date time.Time, contentType string, block []byte) Record {
+	h := textproto.MIMEHeader{}
+	h.Set("WARC-Type", recordType)
+	h.Set("WARC-Record-ID", NewRecordID())
+	h.Set("WARC-Date", date.UTC().Format(time.RFC3339Nano))
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	h.Set("WARC-Block-Digest", Digest(block))
+	return Record{Header: h, Block: block}
+}
+
+// NewRecordID returns a "<urn:uuid:...>" record ID with a random (version 4) UUID.
+func NewRecordID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Digest returns the labelled SHA-256 digest of data in base32, e.g. "sha256:ABC...".
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// Writer writes records to a WARC file. It is safe for concurrent use.
+type Writer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	gzip bool
+}
+
+// NewWriter returns a Writer. With compress set, each record is written as a separate gzip member, as
+// .warc.gz readers expect.
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{w: w, gzip: compress}
+}
+
+// Write writes one record, filling in Content-Length.
+func (w *Writer) Write(r Record) error {
+	r.Header.Set("Content-Length", strconv.Itoa(len(r.Block)))
+
+	var head strings.Builder
+	head.WriteString(Version + "\r\n")
+	// WARC-Type and WARC-Record-ID first, then the rest in a stable order.
+	keys := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fieldRank(keys[i]) < fieldRank(keys[j]) || fieldRank(keys[i]) == fieldRank(keys[j]) && keys[i] < keys[j]
+	})
+	for _, k := range keys {
+		for _, v := range r.Header[k] {
+			head.WriteString(fieldName(k) + ": " + v + "\r\n")
+		}
+	}
+	head.WriteString("\r\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := w.w
+	var gz *gzip.Writer
+	if w.gzip {
+		gz = gzip.NewWriter(w.w)
+		out = gz
+	}
+	if _, err := io.WriteString(out, head.String()); err != nil {
+		return err
+	}
+	if _, err := out.Write(r.Block); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(out, "\r\n\r\n"); err != nil {
+		return err
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+// fieldName restores the conventional spelling of WARC field names, which MIMEHeader canonicalises, e.g.
+// "Warc-Record-Id" to "WARC-Record-ID".
+func fieldName(k string) string {
+	parts := strings.Split(k, "-")
+	for i, p := range parts {
+		switch p {
+		case "Warc", "Id", "Uri", "Ip":
+			parts[i] = strings.ToUpper(p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func fieldRank(k string) int {
+	switch k {
+	case "Warc-Type":
+		return 0
+	case "Warc-Record-Id":
+		return 1
+	}
+	return 2
+}
+
+// WriteWarcinfo writes a warcinfo record describing the file.
+func (w *Writer) WriteWarcinfo(date time.Time, filename string, fields map[string]string) error {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + ": " + fields[k] + "\r\n")
+	}
+	r := NewRecord(TypeWarcinfo, date, "application/warc-fields", []byte(b.String()))
+	if filename != "" {
+		r.Header.Set("WARC-Filename", filename)
+	}
+	return w.Write(r)
+}
+
+// Reader reads records from a WARC file, compressed or not.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader for r, detecting gzip compression.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{r: bufio.NewReader(gz)}, nil
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF after the last.
+func (r *Reader) Next() (Record, error) {
+	version, err := r.r.ReadString('\n')
+	if err == io.EOF && version == "" {
+		return Record{}, io.EOF
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("warc: read version: %w", err)
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return Record{}, fmt.Errorf("warc: expected version line, got %q", strings.TrimSpace(version))
+	}
+	header, err := textproto.NewReader(r.r).ReadMIMEHeader()
+	if err != nil {
+		return Record{}, fmt.Errorf("warc: read header: %w", err)
+	}
+	n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || n < 0 {
+		return Record{}, fmt.Errorf("warc: invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	block := make([]byte, n)
+	if _, err := io.ReadFull(r.r, block); err != nil {
+		return Record{}, fmt.Errorf("warc: read block: %w", err)
+	}
+	var trailer [4]byte
+	if _, err := io.ReadFull(r.r, trailer[:]); err != nil || string(trailer[:]) != "\r\n\r\n" {
+		return Record{}, fmt.Errorf("warc: missing record trailer")
+	}
+	return Record{Header: header, Block: block}, nil
+}
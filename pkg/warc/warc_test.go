@@ -0,0 +1,108 @@
+package warc
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "identity" {
+			t.Errorf("expected identity encoding, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		// Flushing forces a chunked response, which the recording must still describe correctly.
+		_, _ = io.WriteString(w, "%PDF-1.4 ")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "agenda")
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, compress)
+		if err := w.WriteWarcinfo(time.Now(), "test.warc", map[string]string{"software": "civic-code"}); err != nil {
+			t.Fatalf("WriteWarcinfo returned error: %v", err)
+		}
+		rec := &Recorder{Next: srv.Client().Transport, Writer: w}
+		resp, err := rec.Client().Get(srv.URL + "/agenda.pdf?id=1")
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "%PDF-1.4 agenda" {
+			t.Fatalf("recorder changed the body: %q", body)
+		}
+
+		data := buf.Bytes()
+		if compress != (data[0] == 0x1f) {
+			t.Fatalf("compress=%v but file starts with %x", compress, data[:2])
+		}
+		if !compress && !strings.Contains(string(data), "\r\nWARC-Record-ID: <urn:uuid:") {
+			t.Fatalf("expected conventional field names:\n%s", data)
+		}
+
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("NewReader returned error: %v", err)
+		}
+		types := make([]string, 0)
+		var response, request Record
+		for {
+			rec, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Next returned error: %v", err)
+			}
+			types = append(types, rec.Type())
+			switch rec.Type() {
+			case TypeResponse:
+				response = rec
+			case TypeRequest:
+				request = rec
+			}
+		}
+		if strings.Join(types, ",") != "warcinfo,response,request" {
+			t.Fatalf("unexpected records: %v", types)
+		}
+		if response.Header.Get("WARC-Target-URI") != srv.URL+"/agenda.pdf?id=1" || response.Header.Get("WARC-Payload-Digest") != Digest(body) {
+			t.Fatalf("unexpected response header: %v", response.Header)
+		}
+		if request.Header.Get("WARC-Concurrent-To") != response.Header.Get("WARC-Record-ID") {
+			t.Fatalf("request not linked to response")
+		}
+		if !strings.HasPrefix(string(request.Block), "GET /agenda.pdf?id=1 HTTP/1.1\r\n") {
+			t.Fatalf("unexpected request block:\n%s", request.Block)
+		}
+
+		count, problems, err := Verify(bytes.NewReader(data))
+		if err != nil || count != 3 || len(problems) != 0 {
+			t.Fatalf("Verify = %d, %v, %v", count, problems, err)
+		}
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, false)
+	block := []byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello")
+	rec := NewRecord(TypeResponse, time.Now(), "application/http;msgtype=response", block)
+	rec.Header.Set("WARC-Payload-Digest", Digest([]byte("hello")))
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	tampered := bytes.Replace(buf.Bytes(), []byte("hello"), []byte("jello"), 1)
+	count, problems, err := Verify(bytes.NewReader(tampered))
+	if err != nil || count != 1 || len(problems) != 1 || !strings.Contains(problems[0].Err.Error(), "block digest") {
+		t.Fatalf("Verify = %d, %+v, %v", count, problems, err)
+	}
+}
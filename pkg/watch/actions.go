@@ -0,0 +1,59 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// Command returns an Action that runs a shell command line for each event with the event JSON on stdin.
+// The event type and document ID are also available as CIVIC_EVENT and CIVIC_DOCUMENT_ID.
+func Command(cmdline string) Action {
+	return func(ctx context.Context, ev Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", cmdline)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", cmdline)
+		}
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), "CIVIC_EVENT="+string(ev.Type), "CIVIC_DOCUMENT_ID="+ev.Document.ID)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("command: %w", err)
+		}
+		return nil
+	}
+}
+
+// File returns an Action that appends each event to path as a line of JSON.
+func File(path string) Action {
+	var mu sync.Mutex
+	return func(_ context.Context, ev Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
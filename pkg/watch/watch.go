@@ -0,0 +1,308 @@
+// Package watch polls the document listing, detects new, changed and removed documents against persisted state
+// and runs actions for each change.
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+// EventType describes how a document changed between polls.
+type EventType string
+
+const (
+	Added   EventType = "added"
+	Changed EventType = "changed"
+	Removed EventType = "removed"
+)
+
+// Event is a change to one document.
+type Event struct {
+	Type     EventType        `json:"type"`
+	Time     time.Time        `json:"time"`
+	Document scraper.Document `json:"document"`
+	// Previous is the last known version of a changed or removed document. For a changed document that was
+	// downloaded, comparing its checksum with Document's tells whether the content changed too.
+	Previous *scraper.Document `json:"previous,omitempty"`
+}
+
+// Action is run for every event. Errors are logged and don't stop other actions.
+type Action func(ctx context.Context, ev Event) error
+
+// Config configures a Watcher.
+type Config struct {
+	// Fetch returns the current listing; it defaults to scraper.GetDocuments.
+	Fetch func(ctx context.Context) ([]scraper.Document, error)
+	// Download, when set, is called with added and changed documents before actions run and returns them
+	// updated with checksums and file names. Documents its error reports as downloader.Failures are left out of
+	// the poll's events and state, so the next poll finds them again and retries.
+	Download func(ctx context.Context, docs []scraper.Document) ([]scraper.Document, error)
+	// Actions run for each event in order.
+	Actions []Action
+	// Interval between polls, with a random delay of up to Jitter added to each.
+	Interval time.Duration
+	Jitter   time.Duration
+	// StatePath is the JSON file known documents are persisted to.
+	StatePath string
+	// NotifyExisting runs actions for every listed document on the first poll without prior state. By default
+	// the first poll only records a baseline.
+	NotifyExisting bool
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// entry is the persisted record of a known document.
+type entry struct {
+	Document  scraper.Document `json:"document"`
+	FirstSeen time.Time        `json:"firstSeen"`
+	LastSeen  time.Time        `json:"lastSeen"`
+}
+
+// state is the persisted set of known documents keyed by ID.
+type state struct {
+	Documents map[string]entry `json:"documents"`
+}
+
+// Watcher polls the listing and runs actions on changes.
+type Watcher struct {
+	cfg      Config
+	state    state
+	existing bool
+}
+
+// New returns a Watcher with state loaded from cfg.StatePath.
+func New(cfg Config) (*Watcher, error) {
+	if cfg.Fetch == nil {
+		cfg.Fetch = scraper.GetDocuments
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	w := &Watcher{cfg: cfg, state: state{Documents: make(map[string]entry)}}
+	if cfg.StatePath == "" {
+		return w, nil
+	}
+
+	data, err := os.ReadFile(cfg.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &w.state); err != nil {
+		return nil, fmt.Errorf("watch: decode %s: %w", cfg.StatePath, err)
+	}
+	if w.state.Documents == nil {
+		w.state.Documents = make(map[string]entry)
+	}
+	w.existing = true
+	return w, nil
+}
+
+// Run polls until ctx is done. Poll errors are logged and retried at the next interval.
+func (w *Watcher) Run(ctx context.Context) error {
+	for {
+		if _, err := w.Poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("watch: %v", err)
+		}
+
+		delay := w.cfg.Interval
+		if w.cfg.Jitter > 0 {
+			delay += rand.N(w.cfg.Jitter)
+		}
+		log.Printf("watch: next poll in %s", delay.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Poll fetches the listing once, runs actions for each change and saves the state. It returns the events found.
+func (w *Watcher) Poll(ctx context.Context) ([]Event, error) {
+	docs, err := w.cfg.Fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	now := w.cfg.Now()
+	for i := range docs {
+		if docs[i].ID == "" {
+			docs[i].ID = scraper.DocumentID(docs[i].Link)
+		}
+	}
+
+	events := w.diff(docs, now)
+	baseline := !w.existing && !w.cfg.NotifyExisting
+	w.existing = true
+
+	if w.cfg.Download != nil && !baseline {
+		events = w.download(ctx, events)
+	}
+
+	if baseline {
+		log.Printf("watch: recorded baseline of %d documents", len(docs))
+	} else {
+		log.Printf("watch: %d documents listed, %d changes", len(docs), len(events))
+	}
+
+	for _, ev := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		if !baseline {
+			for _, action := range w.cfg.Actions {
+				if err := action(ctx, ev); err != nil {
+					log.Printf("watch: %s %s: %v", ev.Type, ev.Document.Name, err)
+				}
+			}
+		}
+		w.apply(ev)
+	}
+
+	// Documents that are still listed and unchanged only need their last-seen time bumped.
+	for _, doc := range docs {
+		if e, ok := w.state.Documents[doc.ID]; ok {
+			e.LastSeen = now
+			w.state.Documents[doc.ID] = e
+		}
+	}
+
+	if err := w.save(); err != nil {
+		return events, err
+	}
+	return events, ctx.Err()
+}
+
+// diff compares the listing with the state.
+func (w *Watcher) diff(docs []scraper.Document, now time.Time) []Event {
+	events := make([]Event, 0)
+	listed := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		listed[doc.ID] = true
+		prev, ok := w.state.Documents[doc.ID]
+		if !ok {
+			events = append(events, Event{Type: Added, Time: now, Document: doc})
+			continue
+		}
+		// The listing carries no checksum. The one recorded before describes the old content, so it isn't put on
+		// the event: the document is downloaded afresh and its new checksum compared with Previous afterwards.
+		if changed(prev.Document, doc) {
+			p := prev.Document
+			events = append(events, Event{Type: Changed, Time: now, Document: doc, Previous: &p})
+		}
+	}
+
+	ids := make([]string, 0)
+	for id := range w.state.Documents {
+		if !listed[id] {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		p := w.state.Documents[id].Document
+		events = append(events, Event{Type: Removed, Time: now, Document: p, Previous: &p})
+	}
+	return events
+}
+
+// changed reports whether the listing metadata of a document differs.
+func changed(a, b scraper.Document) bool {
+	return a.Name != b.Name || !scraper.SameMeetingTime(a.Date, b.Date) || a.RawTitle != b.RawTitle ||
+		a.Meeting.Code != b.Meeting.Code
+}
+
+// download fetches added and changed documents and records their checksums on the events. Events for documents
+// that failed to download are dropped.
+func (w *Watcher) download(ctx context.Context, events []Event) []Event {
+	docs := make([]scraper.Document, 0)
+	index := make([]int, 0)
+	for i, ev := range events {
+		if ev.Type == Removed {
+			continue
+		}
+		docs = append(docs, ev.Document)
+		index = append(index, i)
+	}
+	if len(docs) == 0 {
+		return events
+	}
+
+	updated, err := w.cfg.Download(ctx, docs)
+	failed := make(map[int]bool)
+	for _, f := range downloader.Failures(err) {
+		if f.Index >= 0 && f.Index < len(index) {
+			failed[index[f.Index]] = true
+			log.Printf("watch: download %s: %v; retrying at the next poll", f.Document.Name, f.Err)
+		}
+	}
+	if err != nil && len(failed) == 0 {
+		log.Printf("watch: download: %v", err)
+	}
+	for j, i := range index {
+		if j < len(updated) && updated[j].Link != "" {
+			events[i].Document = updated[j]
+		}
+	}
+	kept := make([]Event, 0, len(events))
+	for i, ev := range events {
+		if !failed[i] {
+			kept = append(kept, ev)
+		}
+	}
+	return kept
+}
+
+// apply records an event in the state.
+func (w *Watcher) apply(ev Event) {
+	switch ev.Type {
+	case Removed:
+		delete(w.state.Documents, ev.Document.ID)
+	case Added:
+		w.state.Documents[ev.Document.ID] = entry{Document: ev.Document, FirstSeen: ev.Time, LastSeen: ev.Time}
+	case Changed:
+		e := w.state.Documents[ev.Document.ID]
+		// Without a download the recorded checksum still describes the stored file.
+		if ev.Document.Checksum == "" {
+			ev.Document.Checksum = e.Document.Checksum
+		}
+		e.Document = ev.Document
+		e.LastSeen = ev.Time
+		w.state.Documents[ev.Document.ID] = e
+	}
+}
+
+// save writes the state atomically.
+func (w *Watcher) save() error {
+	if w.cfg.StatePath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(w.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(w.cfg.StatePath), 0o755); err != nil {
+		return err
+	}
+	tmp := w.cfg.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.cfg.StatePath)
+}
@@ -0,0 +1,203 @@
+package watch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dntiontk/civic-code/pkg/downloader"
+	"github.com/dntiontk/civic-code/pkg/scraper"
+)
+
+func TestPoll(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	eventsPath := filepath.Join(dir, "events.jsonl")
+
+	a := scraper.Document{Link: "https://example.invalid/a.pdf", Name: "a.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)}
+	b := scraper.Document{Link: "https://example.invalid/b.pdf", Name: "b.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)}
+	listing := []scraper.Document{a}
+
+	cfg := Config{
+		Fetch: func(context.Context) ([]scraper.Document, error) {
+			return append([]scraper.Document(nil), listing...), nil
+		},
+		Download: func(_ context.Context, docs []scraper.Document) ([]scraper.Document, error) {
+			for i := range docs {
+				docs[i].Checksum = "sum-" + docs[i].Name
+			}
+			return docs, nil
+		},
+		Actions:   []Action{File(eventsPath)},
+		StatePath: statePath,
+	}
+
+	w, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	ctx := context.Background()
+
+	// The first poll without state records a baseline and runs no actions.
+	if _, err := w.Poll(ctx); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if _, err := os.Stat(eventsPath); !os.IsNotExist(err) {
+		t.Fatalf("expected no events for the baseline poll, got err=%v", err)
+	}
+
+	// A restarted watcher picks up the persisted state.
+	w, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	renamed := a
+	renamed.RawTitle = "City Council Meeting - Monday, March 4, 2024 (revised)"
+	listing = []scraper.Document{renamed, b}
+	events, err := w.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != Changed || events[1].Type != Added {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if events[1].Document.Checksum != "sum-b.pdf" {
+		t.Fatalf("expected added document to be downloaded, got %+v", events[1].Document)
+	}
+
+	listing = []scraper.Document{b}
+	events, err = w.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != Removed || events[0].Document.Name != "a.pdf" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	f, err := os.Open(eventsPath)
+	if err != nil {
+		t.Fatalf("open events: %v", err)
+	}
+	defer f.Close()
+	lines := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); lines++ {
+	}
+	if lines != 3 {
+		t.Fatalf("expected 3 event lines, got %d", lines)
+	}
+}
+
+func TestPollChangedDocumentDownloadsAfresh(t *testing.T) {
+	a := scraper.Document{Link: "https://example.invalid/a.pdf", Name: "a.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)}
+	a.ID = scraper.DocumentID(a.Link)
+	listing := []scraper.Document{a}
+	version := "v1"
+	var expected []string
+
+	w, err := New(Config{
+		Fetch: func(context.Context) ([]scraper.Document, error) {
+			return append([]scraper.Document(nil), listing...), nil
+		},
+		Download: func(_ context.Context, docs []scraper.Document) ([]scraper.Document, error) {
+			for i := range docs {
+				expected = append(expected, docs[i].Checksum)
+				docs[i].Checksum = "sum-" + version
+			}
+			return docs, nil
+		},
+		StatePath:      filepath.Join(t.TempDir(), "state.json"),
+		NotifyExisting: true,
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := w.Poll(ctx); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+
+	// The City revises the listing and replaces the PDF.
+	version = "v2"
+	revised := a
+	revised.RawTitle = "City Council Meeting - Monday, March 4, 2024 (revised)"
+	listing = []scraper.Document{revised}
+	events, err := w.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != Changed {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if len(expected) != 2 || expected[1] != "" {
+		t.Fatalf("the changed document was downloaded with checksum %q, want none", expected[len(expected)-1])
+	}
+	if events[0].Document.Checksum != "sum-v2" || events[0].Previous.Checksum != "sum-v1" {
+		t.Fatalf("checksums: document %q, previous %q", events[0].Document.Checksum, events[0].Previous.Checksum)
+	}
+
+	// An unchanged listing is not a change, even though it carries no checksum.
+	if events, err := w.Poll(ctx); err != nil || len(events) != 0 {
+		t.Fatalf("Poll of an unchanged listing = %+v, %v", events, err)
+	}
+}
+
+func TestPollRetriesFailedDownloads(t *testing.T) {
+	a := scraper.Document{Link: "https://example.invalid/a.pdf", Name: "a.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)}
+	b := scraper.Document{Link: "https://example.invalid/b.pdf", Name: "b.pdf", Meeting: scraper.CC, Date: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)}
+	fail := true
+	var downloaded []string
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	w, err := New(Config{
+		Fetch: func(context.Context) ([]scraper.Document, error) {
+			return []scraper.Document{a, b}, nil
+		},
+		Download: func(_ context.Context, docs []scraper.Document) ([]scraper.Document, error) {
+			var errs []error
+			for i := range docs {
+				downloaded = append(downloaded, docs[i].Name)
+				if fail && docs[i].Name == "b.pdf" {
+					errs = append(errs, &downloader.DocumentError{Index: i, Document: docs[i], Err: errors.New("503")})
+					continue
+				}
+				docs[i].Checksum = "sum"
+			}
+			return docs, errors.Join(errs...)
+		},
+		StatePath:      statePath,
+		NotifyExisting: true,
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	ctx := context.Background()
+	events, err := w.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if len(events) != 1 || events[0].Document.Name != "a.pdf" {
+		t.Fatalf("first poll events = %+v, want only a.pdf", events)
+	}
+
+	// The failed document isn't in the saved state, so a new watcher finds it again and retries.
+	fail = false
+	w, err = New(Config{Fetch: w.cfg.Fetch, Download: w.cfg.Download, StatePath: statePath})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	events, err = w.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != Added || events[0].Document.Name != "b.pdf" || events[0].Document.Checksum != "sum" {
+		t.Fatalf("second poll events = %+v, want b.pdf added", events)
+	}
+	if want := []string{"a.pdf", "b.pdf", "b.pdf"}; !slices.Equal(downloaded, want) {
+		t.Fatalf("downloaded %v, want %v", downloaded, want)
+	}
+}